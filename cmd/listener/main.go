@@ -1,67 +1,224 @@
 package main
 
 import (
-	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"time"
+
+	"github.com/ErturkCan/netprobe/pkg/probe"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 func main() {
 	port := flag.Int("port", 12345, "UDP port to listen on")
+	ipv4Only := flag.Bool("4", false, "Listen on IPv4 only")
+	ipv6Only := flag.Bool("6", false, "Listen on IPv6 only")
+	mode := flag.String("mode", "echo", "Reflector mode: echo, stamp or twamp-light")
 	flag.Parse()
 
+	// STAMP and TWAMP reflectors live on their well-known port unless told
+	// otherwise
+	portSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "port" {
+			portSet = true
+		}
+	})
+	switch *mode {
+	case "echo":
+	case "stamp", "twamp-light":
+		if !portSet {
+			*port = probe.STAMPPort
+		}
+	default:
+		log.Fatalf("Unknown mode: %s", *mode)
+	}
+
+	// Listen on the wildcard address of the chosen family; plain "udp"
+	// binds [::] and accepts both IPv4 and IPv6 probes
+	network, stack := "udp", "dual-stack"
+	switch {
+	case *ipv4Only && *ipv6Only:
+		log.Fatal("-4 and -6 are mutually exclusive")
+	case *ipv4Only:
+		network, stack = "udp4", "IPv4"
+	case *ipv6Only:
+		network, stack = "udp6", "IPv6"
+	}
+
 	// Create UDP listener
 	addr := net.UDPAddr{
 		Port: *port,
-		IP:   net.ParseIP("0.0.0.0"),
 	}
 
-	conn, err := net.ListenUDP("udp", &addr)
+	conn, err := net.ListenUDP(network, &addr)
 	if err != nil {
 		log.Fatalf("Failed to listen on UDP %d: %v", *port, err)
 	}
 	defer conn.Close()
 
-	log.Printf("UDP Echo Server listening on :%d", *port)
+	switch *mode {
+	case "stamp":
+		log.Printf("STAMP Session-Reflector listening on %s (%s)", conn.LocalAddr(), stack)
+		log.Println("Ready to receive probes. Press Ctrl+C to stop.")
+		serveReflector(conn, "STAMP", reflectSTAMP)
+		return
+	case "twamp-light":
+		log.Printf("TWAMP-Light Session-Reflector listening on %s (%s)", conn.LocalAddr(), stack)
+		log.Println("Ready to receive probes. Press Ctrl+C to stop.")
+		serveReflector(conn, "TWAMP", reflectTWAMP)
+		return
+	}
+
+	log.Printf("UDP Echo Server listening on %s (%s)", conn.LocalAddr(), stack)
 	log.Println("Ready to receive probes. Press Ctrl+C to stop.")
+	serveEcho(conn)
+}
 
+// serveEcho echoes netprobe UDP probes, adding reflector timestamps to
+// version 2 packets
+func serveEcho(conn *net.UDPConn) {
 	buffer := make([]byte, 4096)
 
 	for {
 		n, remoteAddr, err := conn.ReadFromUDP(buffer)
+		recvTime := time.Now()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.Printf("Read error: %v", err)
 			continue
 		}
 
 		// Extract sequence and send time from payload
 		var sequence uint32
-		var sendTime int64
+		var sendTime time.Time
+		version := probe.PacketV1
 
-		if n >= 12 {
-			sequence = binary.BigEndian.Uint32(buffer[0:4])
-			sendTime = int64(binary.BigEndian.Uint64(buffer[4:12]))
+		if packet, err := probe.ParsePacket(buffer[:n]); err == nil {
+			sequence, sendTime, version = packet.Sequence, packet.T1, packet.Version
 		}
 
-		// Get current timestamp
-		now := time.Now().UnixNano()
-
-		// Log the probe
-		rtt := (now - sendTime) / 1000 // Convert to microseconds
-		fmt.Printf("[%s] Seq=%d Payload=%d bytes RTT=%.3fms\n",
+		// Log the probe; the one-way delay is only meaningful with
+		// synchronized clocks
+		var delay time.Duration
+		if !sendTime.IsZero() {
+			delay = recvTime.Sub(sendTime)
+		}
+		fmt.Printf("[%s] Seq=%d Version=%d Payload=%d bytes Delay=%.3fms\n",
 			remoteAddr.IP.String(),
 			sequence,
+			version,
 			n,
-			float64(rtt)/1000.0,
+			delay.Seconds()*1000,
 		)
 
-		// Echo the packet back
+		// Echo the packet back, adding our receive and transmit times to
+		// version 2 packets as late as possible
+		probe.ReflectPacket(buffer[:n], recvTime, time.Now())
 		_, err = conn.WriteToUDP(buffer[:n], remoteAddr)
 		if err != nil {
 			log.Printf("Write error: %v", err)
 		}
 	}
 }
+
+// reflectFunc answers one test packet, writing the reply into reply and
+// returning its length along with the sender's sequence number
+type reflectFunc func(reply, request []byte, recvTime time.Time, ttl int) (int, uint32, error)
+
+// serveReflector answers test packets as a stateless session-reflector
+func serveReflector(conn *net.UDPConn, protocol string, reflect reflectFunc) {
+	// The reply reports the TTL or hop limit each packet arrived with; a
+	// dual-stack socket needs both options
+	_ = ipv4.NewPacketConn(conn).SetControlMessage(ipv4.FlagTTL, true)
+	_ = ipv6.NewPacketConn(conn).SetControlMessage(ipv6.FlagHopLimit, true)
+
+	buffer := make([]byte, 4096)
+	reply := make([]byte, 4096)
+	oob := make([]byte, 128)
+
+	for {
+		n, oobn, _, remoteAddr, err := conn.ReadMsgUDP(buffer, oob)
+		recvTime := time.Now()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Read error: %v", err)
+			continue
+		}
+
+		ttl := receivedTTL(oob[:oobn])
+		size, sequence, err := reflect(reply, buffer[:n], recvTime, ttl)
+		if err != nil {
+			log.Printf("[%s] Dropped %d bytes: %v", remoteAddr.IP.String(), n, err)
+			continue
+		}
+
+		if _, err := conn.WriteToUDP(reply[:size], remoteAddr); err != nil {
+			log.Printf("Write error: %v", err)
+		}
+
+		fmt.Printf("[%s] %s Seq=%d TTL=%d Payload=%d bytes\n",
+			remoteAddr.IP.String(),
+			protocol,
+			sequence,
+			ttl,
+			n,
+		)
+	}
+}
+
+// reflectSTAMP answers an unauthenticated STAMP test packet (RFC 8762) with
+// a packet of the same size, keeping any bytes past the base packet
+func reflectSTAMP(reply, request []byte, recvTime time.Time, ttl int) (int, uint32, error) {
+	sender, err := probe.ParseSTAMPSenderPacket(request)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	copy(reply, request)
+	packet := probe.NewSTAMPReflectorPacket(sender, recvTime, ttl)
+	packet.Timestamp = time.Now()
+	if err := packet.Marshal(reply[:len(request)]); err != nil {
+		return 0, 0, err
+	}
+	return len(request), sender.Sequence, nil
+}
+
+// reflectTWAMP answers an unauthenticated TWAMP-Test packet (RFC 5357
+// appendix I), carrying over the sender's padding
+func reflectTWAMP(reply, request []byte, recvTime time.Time, ttl int) (int, uint32, error) {
+	sender, err := probe.ParseTWAMPSenderPacket(request)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	packet := probe.NewSTAMPReflectorPacket(sender, recvTime, ttl)
+	packet.Timestamp = time.Now()
+	size, err := probe.ReflectTWAMP(reply, request, &packet)
+	if err != nil {
+		return 0, 0, err
+	}
+	return size, sender.Sequence, nil
+}
+
+// receivedTTL returns the TTL or hop limit a datagram arrived with, or 0 if
+// the kernel did not report it
+func receivedTTL(oob []byte) int {
+	var cm4 ipv4.ControlMessage
+	if cm4.Parse(oob) == nil && cm4.TTL > 0 {
+		return cm4.TTL
+	}
+	var cm6 ipv6.ControlMessage
+	if cm6.Parse(oob) == nil && cm6.HopLimit > 0 {
+		return cm6.HopLimit
+	}
+	return 0
+}
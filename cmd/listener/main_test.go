@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ErturkCan/netprobe/pkg/probe"
+)
+
+func TestServeEchoDualStack(t *testing.T) {
+	// The same wildcard socket the listener opens without -4 or -6
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+	defer conn.Close()
+	go serveEcho(conn)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	for _, target := range []string{"127.0.0.1", "::1"} {
+		t.Run(target, func(t *testing.T) {
+			prober := probe.NewUDPProber(probe.UDPProbeConfig{
+				Target:        target,
+				Port:          port,
+				Count:         3,
+				Interval:      10 * time.Millisecond,
+				Timeout:       time.Second,
+				PacketVersion: probe.PacketV2,
+			})
+			results, err := prober.Probe()
+			if err != nil {
+				t.Fatalf("Probe: %v", err)
+			}
+			if len(results) != 3 {
+				t.Fatalf("got %d results, want 3", len(results))
+			}
+			for _, r := range results {
+				if !r.Success {
+					t.Errorf("probe %d failed: %v", r.Sequence, r.Error)
+				}
+				if r.ReflectorRecv.IsZero() {
+					t.Errorf("probe %d: reflector did not add its timestamps", r.Sequence)
+				}
+			}
+		})
+	}
+}
+
+func TestServeEchoIPv6Only(t *testing.T) {
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{})
+	if err != nil {
+		t.Skipf("cannot listen on udp6: %v", err)
+	}
+	defer conn.Close()
+	go serveEcho(conn)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	prober := probe.NewUDPProber(probe.UDPProbeConfig{
+		Target:  "::1",
+		Port:    port,
+		Count:   1,
+		Timeout: time.Second,
+	})
+	results, err := prober.Probe()
+	if err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("got %+v, want one successful result", results)
+	}
+}
+
+func TestServeReflectorSTAMP(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+	defer conn.Close()
+	go serveReflector(conn, "STAMP", reflectSTAMP)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	for _, target := range []string{"127.0.0.1", "::1"} {
+		t.Run(target, func(t *testing.T) {
+			prober := probe.NewSTAMPProber(probe.STAMPProbeConfig{
+				Target:   target,
+				Port:     port,
+				Count:    3,
+				Interval: 10 * time.Millisecond,
+				Timeout:  time.Second,
+			})
+			results, err := prober.Probe()
+			if err != nil {
+				t.Fatalf("Probe: %v", err)
+			}
+			if len(results) != 3 {
+				t.Fatalf("got %d results, want 3", len(results))
+			}
+			for _, r := range results {
+				if !r.Success {
+					t.Errorf("probe %d failed: %v", r.Sequence, r.Error)
+					continue
+				}
+				if r.ReflectorRecv.IsZero() || r.ReflectorSend.Before(r.ReflectorRecv) {
+					t.Errorf("probe %d: reflector times %v and %v", r.Sequence, r.ReflectorRecv, r.ReflectorSend)
+				}
+			}
+			if _, ok := probe.OneWay(results); !ok {
+				t.Error("no one-way delays from reflector timestamps")
+			}
+		})
+	}
+
+	t.Run("raw packet", func(t *testing.T) {
+		client, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		if err != nil {
+			t.Skipf("cannot dial udp4: %v", err)
+		}
+		defer client.Close()
+
+		// Bytes past the base packet come back unchanged
+		request := make([]byte, probe.STAMPPacketLen+8)
+		copy(request[probe.STAMPPacketLen:], "trailing")
+		sender := probe.STAMPSenderPacket{Sequence: 9, Timestamp: time.Now(), ErrorEstimate: probe.ErrorEstimateSync}
+		if err := sender.Marshal(request); err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if _, err := client.Write(request); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		reply := make([]byte, 4096)
+		n, err := client.Read(reply)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		if n != len(request) || !bytes.Equal(reply[probe.STAMPPacketLen:n], []byte("trailing")) {
+			t.Fatalf("got %d bytes %q, want %d ending in %q", n, reply[:n], len(request), "trailing")
+		}
+		packet, err := probe.ParseSTAMPReflectorPacket(reply[:n])
+		if err != nil {
+			t.Fatalf("ParseSTAMPReflectorPacket: %v", err)
+		}
+		if packet.SenderSequence != 9 || packet.SenderErrorEstimate != probe.ErrorEstimateSync ||
+			!packet.SenderTimestamp.Equal(sender.Timestamp) {
+			t.Errorf("reflected %+v, want sequence 9, error estimate %#x, timestamp %v",
+				packet, probe.ErrorEstimateSync, sender.Timestamp)
+		}
+		if packet.SenderTTL == 0 {
+			t.Error("reflector did not report the TTL")
+		}
+		if packet.ReceiveTimestamp.IsZero() || packet.Timestamp.Before(packet.ReceiveTimestamp) {
+			t.Errorf("reflector times %v and %v", packet.ReceiveTimestamp, packet.Timestamp)
+		}
+	})
+}
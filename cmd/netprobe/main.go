@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ErturkCan/netprobe/pkg/detect"
 	"github.com/ErturkCan/netprobe/pkg/output"
 	"github.com/ErturkCan/netprobe/pkg/probe"
 	"github.com/ErturkCan/netprobe/pkg/stats"
@@ -25,6 +33,12 @@ func main() {
 		probeCommand(os.Args[2:])
 	case "analyze":
 		analyzeCommand(os.Args[2:])
+	case "trace":
+		traceCommand(os.Args[2:])
+	case "mtu":
+		mtuCommand(os.Args[2:])
+	case "compare":
+		compareCommand(os.Args[2:])
 	case "listen":
 		listenCommand(os.Args[2:])
 	case "help", "-h", "--help":
@@ -40,8 +54,12 @@ func printUsage() {
 	fmt.Println(`NetProbe - Network Latency Diagnostic Tool
 
 Usage:
-  netprobe probe [options]    - Send network probes (UDP or ICMP)
+  netprobe probe [options]    - Send network probes (UDP, ICMP, TCP, HTTP, DNS, STAMP or TWAMP-Light)
+  netprobe trace [options]    - Per-hop latency and loss along the path (mtr-style)
+  netprobe mtu [options]      - Discover the path MTU and detect MTU black holes
   netprobe analyze [options]  - Analyze probe results and detect bufferbloat
+  netprobe compare [options] <old.json> <new.json>
+                              - Test whether latency changed between two saved runs
   netprobe listen [options]   - Run UDP echo server
   netprobe help               - Show this help message
 
@@ -49,22 +67,85 @@ Global Options:
   -help                       Show help for specific command`)
 
 	fmt.Println("\nProbe Command:")
-	fmt.Println(`  netprobe probe -type <udp|icmp> -target <host> [options]
+	fmt.Println(`  netprobe probe -type <udp|icmp|tcp|http|dns|stamp|twamp-light> -target <host> [options]
 
   Options:
-    -type string              Probe type: udp or icmp (default: udp)
-    -target string            Target host or IP address (required)
-    -port int                 Target port for UDP (default: 12345)
+    -type string              Probe type: udp, icmp, tcp, http, dns, stamp or twamp-light (default: udp)
+    -target string            Target host, URL for http, or resolver for dns (required)
+    -port int                 Target port for UDP (default: 12345), TCP (default: 80), DNS (default: 53)
+                              or STAMP and TWAMP-Light (default: 862)
     -count int                Number of probes (default: 10)
     -interval duration        Interval between probes (default: 1s)
-    -payload int              Payload size in bytes (default: 12)
+    -payload int              Payload size in bytes (default: 12, 41 for TWAMP-Light)
     -timeout duration         Response timeout (default: 3s)
     -output string            Output format: table or json (default: table)
+    -4                        Use IPv4 only
+    -6                        Use IPv6 only
+    -icmp-mode string         ICMP socket: auto, raw or unprivileged (default: auto)
+    -keepalive                Reuse HTTP connections between requests
+    -insecure                 Skip TLS certificate verification for HTTP
+    -name string              Name to query for DNS (default: example.com)
+    -qtype string             DNS query type: A, AAAA, MX, ... (default: A)
+    -proto string             DNS transport: udp or tcp (default: udp)
+    -kernel-ts                Use kernel socket timestamps for UDP, STAMP, TWAMP and ICMP RTTs (Linux)
+    -packet-version int       UDP packet format: 1, or 2 for one-way delays (default: 1)
+    -window duration          Interval length for time series statistics (default: 10s)
 
 Examples:
   netprobe probe -type udp -target 8.8.8.8
+  netprobe probe -type icmp -target ::1
+  netprobe probe -type tcp -target example.com -port 443
+  netprobe probe -type http -target https://example.com/health
+  netprobe probe -type dns -target 1.1.1.1 -name example.com -qtype AAAA
+  netprobe probe -type stamp -target 192.0.2.1
+  netprobe probe -type twamp-light -target 192.0.2.1 -port 5000
   netprobe probe -type icmp -target google.com -count 20 -interval 500ms
-  netprobe probe -type udp -target localhost -output json`)
+  netprobe probe -type udp -target localhost -output json
+  netprobe probe -type udp -target 10.0.0.5 -packet-version 2`)
+
+	fmt.Println("\nTrace Command:")
+	fmt.Println(`  netprobe trace -target <host> [options]
+
+  Options:
+    -target string            Target host or IP address (required)
+    -type string              Probe type: icmp or udp (default: icmp)
+    -port int                 Destination port for UDP probes (default: 33434)
+    -max-hops int             Maximum number of hops (default: 30)
+    -count int                Number of probes per hop (default: 10)
+    -interval duration        Interval between rounds (default: 1s)
+    -timeout duration         Response timeout (default: 2s)
+    -output string            Output format: table or json (default: table)
+    -4                        Use IPv4 only
+    -6                        Use IPv6 only
+    -icmp-mode string         ICMP socket: auto, raw or unprivileged (default: auto)
+
+  Routers along the path are only visible with raw sockets (root or CAP_NET_RAW).
+
+Examples:
+  netprobe trace -target 8.8.8.8
+  netprobe trace -target example.com -type udp -count 30 -output json`)
+
+	fmt.Println("\nMTU Command:")
+	fmt.Println(`  netprobe mtu -target <host> [options]
+
+  Options:
+    -target string            Target host or IP address (required)
+    -type string              Probe type: icmp or udp (default: icmp)
+    -port int                 Destination port for UDP probes (default: 33434)
+    -min int                  Smallest packet size (default: 68 for IPv4, 1280 for IPv6)
+    -max int                  Largest packet size (default: 1500)
+    -attempts int             Probes per size before it counts as lost (default: 3)
+    -timeout duration         Response timeout (default: 1s)
+    -output string            Output format: table or json (default: table)
+    -4                        Use IPv4 only
+    -6                        Use IPv6 only
+    -icmp-mode string         ICMP socket: auto or raw (default: auto)
+
+  Probes are sent with DF set (Linux only). ICMP probes need a raw socket.
+
+Examples:
+  sudo netprobe mtu -target 10.8.0.1
+  netprobe mtu -target example.com -type udp -max 9000 -output json`)
 
 	fmt.Println("\nAnalyze Command:")
 	fmt.Println(`  netprobe analyze [options]
@@ -79,6 +160,20 @@ Examples:
   netprobe analyze -target 8.8.8.8
   netprobe analyze -target localhost -idle-count 20 -output json`)
 
+	fmt.Println("\nCompare Command:")
+	fmt.Println(`  netprobe compare [options] <old.json> <new.json>
+
+  Options:
+    -output string            Output format: table or json (default: table)
+
+  Compares the RTTs of two reports saved with 'netprobe probe -output json'
+  using Mann-Whitney U and Kolmogorov-Smirnov tests, with bootstrap 95%
+  confidence intervals for the median and p99 differences.
+
+Examples:
+  netprobe probe -type icmp -target 10.0.0.1 -count 200 -output json > before.json
+  netprobe compare before.json after.json`)
+
 	fmt.Println("\nListen Command:")
 	fmt.Println(`  netprobe listen [options]
 
@@ -93,14 +188,25 @@ Examples:
 func probeCommand(args []string) {
 	fs := flag.NewFlagSet("probe", flag.ExitOnError)
 
-	probeType := fs.String("type", "udp", "Probe type: udp or icmp")
-	target := fs.String("target", "", "Target host or IP address")
-	port := fs.Int("port", 12345, "Target port for UDP")
+	probeType := fs.String("type", "udp", "Probe type: udp, icmp, tcp, http, dns, stamp or twamp-light")
+	target := fs.String("target", "", "Target host, URL for http, or resolver for dns")
+	port := fs.Int("port", 12345, "Target port for UDP, TCP, DNS, STAMP or TWAMP-Light")
 	count := fs.Int("count", 10, "Number of probes")
 	interval := fs.Duration("interval", 1*time.Second, "Interval between probes")
 	payload := fs.Int("payload", 12, "Payload size in bytes")
 	timeout := fs.Duration("timeout", 3*time.Second, "Response timeout")
 	outputFormat := fs.String("output", "table", "Output format: table or json")
+	ipv4Only := fs.Bool("4", false, "Use IPv4 only")
+	ipv6Only := fs.Bool("6", false, "Use IPv6 only")
+	icmpMode := fs.String("icmp-mode", "auto", "ICMP socket mode: auto, raw or unprivileged")
+	keepAlive := fs.Bool("keepalive", false, "Reuse HTTP connections between requests")
+	insecure := fs.Bool("insecure", false, "Skip TLS certificate verification for HTTP probes")
+	queryName := fs.String("name", "example.com", "Name to query for DNS probes")
+	queryType := fs.String("qtype", "A", "Query type for DNS probes (A, AAAA, MX, ...)")
+	transport := fs.String("proto", "udp", "Transport for DNS probes: udp or tcp")
+	kernelTS := fs.Bool("kernel-ts", false, "Use kernel socket timestamps for UDP, STAMP, TWAMP and ICMP RTTs (Linux)")
+	packetVersion := fs.Int("packet-version", probe.PacketV1, "UDP probe packet format: 1, or 2 for reflector timestamps")
+	window := fs.Duration("window", stats.DefaultWindowInterval, "Interval length for time series statistics")
 
 	fs.Parse(args)
 
@@ -110,21 +216,58 @@ func probeCommand(args []string) {
 		os.Exit(1)
 	}
 
+	ipVersion := ipVersionFlags(*ipv4Only, *ipv6Only)
+
+	if *packetVersion != probe.PacketV1 && *packetVersion != probe.PacketV2 {
+		fmt.Printf("Error: Unknown packet version: %d\n", *packetVersion)
+		os.Exit(1)
+	}
+
 	switch *probeType {
 	case "udp":
-		probeUDP(*target, *port, *count, *interval, *payload, *timeout, *outputFormat)
+		probeUDP(*target, *port, *count, *interval, *payload, *timeout, ipVersion, *kernelTS, *packetVersion, *window, *outputFormat)
 	case "icmp":
-		probeICMP(*target, *count, *interval, *timeout, *outputFormat)
+		probeICMP(*target, *count, *interval, *timeout, ipVersion, probe.ICMPMode(*icmpMode), *kernelTS, *window, *outputFormat)
+	case "tcp":
+		// The UDP echo port is a poor default for TCP
+		if !isFlagSet(fs, "port") {
+			*port = 80
+		}
+		probeTCP(*target, *port, *count, *interval, *timeout, ipVersion, *window, *outputFormat)
+	case "http":
+		probeHTTP(*target, *count, *interval, *timeout, ipVersion, *keepAlive, *insecure, *window, *outputFormat)
+	case "dns":
+		if !isFlagSet(fs, "port") {
+			*port = 53
+		}
+		probeDNS(*target, *port, *queryName, *queryType, *transport, *count, *interval, *timeout, ipVersion, *window, *outputFormat)
+	case "stamp":
+		if !isFlagSet(fs, "port") {
+			*port = probe.STAMPPort
+		}
+		probeSTAMP(*target, *port, *count, *interval, *timeout, ipVersion, *kernelTS, *window, *outputFormat)
+	case "twamp-light":
+		if !isFlagSet(fs, "port") {
+			*port = probe.STAMPPort
+		}
+		// Pad test packets so replies are the same size unless told otherwise
+		if !isFlagSet(fs, "payload") {
+			*payload = probe.TWAMPReflectorLen
+		}
+		probeTWAMPLight(*target, *port, *count, *interval, *payload, *timeout, ipVersion, *kernelTS, *window, *outputFormat)
 	default:
 		fmt.Printf("Error: Unknown probe type: %s\n", *probeType)
 		os.Exit(1)
 	}
 }
 
-func probeUDP(target string, port, count int, interval time.Duration, payload int, timeout time.Duration, outputFormat string) {
-	fmt.Printf("UDP Probe: target=%s:%d, count=%d, interval=%v, payload=%d bytes\n",
-		target, port, count, interval, payload)
-	fmt.Println()
+func probeUDP(target string, port, count int, interval time.Duration, payload int, timeout time.Duration, ipVersion int, kernelTS bool, packetVersion int, window time.Duration, outputFormat string) {
+	if packetVersion == probe.PacketV2 && payload < probe.PacketV2Len {
+		payload = probe.PacketV2Len
+	}
+	fmt.Fprintf(os.Stderr, "UDP Probe: target=%s, count=%d, interval=%v, payload=%d bytes\n",
+		net.JoinHostPort(target, strconv.Itoa(port)), count, interval, payload)
+	fmt.Fprintln(os.Stderr)
 
 	config := probe.UDPProbeConfig{
 		Target:      target,
@@ -133,96 +276,362 @@ func probeUDP(target string, port, count int, interval time.Duration, payload in
 		Interval:    interval,
 		PayloadSize: payload,
 		Timeout:     timeout,
+		IPVersion:   ipVersion,
+
+		PacketVersion:    packetVersion,
+		KernelTimestamps: kernelTS,
+	}
+
+	runProbe(probe.NewUDPProber(config), "UDP", target, window, outputFormat)
+}
+
+func probeICMP(target string, count int, interval time.Duration, timeout time.Duration, ipVersion int, mode probe.ICMPMode, kernelTS bool, window time.Duration, outputFormat string) {
+	switch mode {
+	case probe.ICMPModeAuto, probe.ICMPModeRaw, probe.ICMPModeUnprivileged:
+	default:
+		fmt.Printf("Error: Unknown ICMP mode: %s\n", mode)
+		os.Exit(1)
 	}
 
-	prober := probe.NewUDPProber(config)
-	results, err := prober.Probe()
+	fmt.Fprintf(os.Stderr, "ICMP Probe: target=%s, count=%d, interval=%v\n",
+		target, count, interval)
+	fmt.Fprintln(os.Stderr)
+
+	config := probe.ICMPProbeConfig{
+		Target:    target,
+		Count:     count,
+		Interval:  interval,
+		Timeout:   timeout,
+		IPVersion: ipVersion,
+		Mode:      mode,
+
+		KernelTimestamps: kernelTS,
+	}
+
+	runProbe(probe.NewICMPProber(config), "ICMP", target, window, outputFormat)
+}
+
+func probeTCP(target string, port, count int, interval time.Duration, timeout time.Duration, ipVersion int, window time.Duration, outputFormat string) {
+	fmt.Fprintf(os.Stderr, "TCP Probe: target=%s, count=%d, interval=%v\n",
+		net.JoinHostPort(target, strconv.Itoa(port)), count, interval)
+	fmt.Fprintln(os.Stderr)
+
+	config := probe.TCPProbeConfig{
+		Target:    target,
+		Port:      port,
+		Count:     count,
+		Interval:  interval,
+		Timeout:   timeout,
+		IPVersion: ipVersion,
+	}
+
+	runProbe(probe.NewTCPProber(config), "TCP", target, window, outputFormat)
+}
+
+func probeHTTP(target string, count int, interval time.Duration, timeout time.Duration, ipVersion int, keepAlive, insecure bool, window time.Duration, outputFormat string) {
+	// Accept a bare host name as shorthand for http://host/
+	url := target
+	if !strings.Contains(url, "://") {
+		url = "http://" + url + "/"
+	}
+
+	fmt.Fprintf(os.Stderr, "HTTP Probe: url=%s, count=%d, interval=%v, keepalive=%v\n",
+		url, count, interval, keepAlive)
+	fmt.Fprintln(os.Stderr)
+
+	config := probe.HTTPProbeConfig{
+		URL:                url,
+		Count:              count,
+		Interval:           interval,
+		Timeout:            timeout,
+		IPVersion:          ipVersion,
+		KeepAlive:          keepAlive,
+		InsecureSkipVerify: insecure,
+	}
+
+	runProbe(probe.NewHTTPProber(config), "HTTP", url, window, outputFormat)
+}
+
+func probeDNS(server string, port int, name, queryType, transport string, count int, interval time.Duration, timeout time.Duration, ipVersion int, window time.Duration, outputFormat string) {
+	qtype, err := probe.ParseDNSType(queryType)
 	if err != nil {
-		log.Fatalf("Probe failed: %v", err)
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	// Extract successful RTTs and calculate statistics
-	var rtts []time.Duration
-	failures := 0
-
-	for _, result := range results {
-		if result.Success {
-			rtts = append(rtts, result.RTT)
-		} else {
-			failures++
-		}
+	fmt.Fprintf(os.Stderr, "DNS Probe: server=%s/%s, query=%s %s, count=%d, interval=%v\n",
+		net.JoinHostPort(server, strconv.Itoa(port)), transport, name, strings.ToUpper(queryType), count, interval)
+	fmt.Fprintln(os.Stderr)
+
+	config := probe.DNSProbeConfig{
+		Server:    server,
+		Port:      port,
+		Name:      name,
+		Type:      qtype,
+		Network:   transport,
+		Count:     count,
+		Interval:  interval,
+		Timeout:   timeout,
+		IPVersion: ipVersion,
 	}
 
-	// Calculate statistics
-	hist := stats.NewLatencyHistogram(len(rtts))
-	hist.AddSamples(rtts)
-	histStats := hist.GetStats()
+	runProbe(probe.NewDNSProber(config), "DNS", server, window, outputFormat)
+}
 
-	// Calculate jitter
-	jitterStats := stats.CalculateJitterStats(rtts)
+func probeSTAMP(target string, port, count int, interval time.Duration, timeout time.Duration, ipVersion int, kernelTS bool, window time.Duration, outputFormat string) {
+	fmt.Fprintf(os.Stderr, "STAMP Probe: target=%s, count=%d, interval=%v\n",
+		net.JoinHostPort(target, strconv.Itoa(port)), count, interval)
+	fmt.Fprintln(os.Stderr)
 
-	// Output results
-	switch outputFormat {
-	case "json":
-		_ = output.WriteProbeResultsJSON(os.Stdout, "UDP", target, results, &histStats, &jitterStats)
-	default:
-		tw := output.NewTableWriter(os.Stdout)
-		_ = tw.WriteProbeResults("UDP", target, rtts, failures)
-		_ = tw.WriteStatistics(histStats)
-		_ = tw.WriteJitterStats(jitterStats)
+	config := probe.STAMPProbeConfig{
+		Target:    target,
+		Port:      port,
+		Count:     count,
+		Interval:  interval,
+		Timeout:   timeout,
+		IPVersion: ipVersion,
+
+		KernelTimestamps: kernelTS,
 	}
+
+	runProbe(probe.NewSTAMPProber(config), "STAMP", target, window, outputFormat)
 }
 
-func probeICMP(target string, count int, interval time.Duration, timeout time.Duration, outputFormat string) {
-	fmt.Printf("ICMP Probe: target=%s, count=%d, interval=%v\n",
-		target, count, interval)
-	fmt.Println()
+func probeTWAMPLight(target string, port, count int, interval time.Duration, payload int, timeout time.Duration, ipVersion int, kernelTS bool, window time.Duration, outputFormat string) {
+	fmt.Fprintf(os.Stderr, "TWAMP-Light Probe: target=%s, count=%d, interval=%v, payload=%d bytes\n",
+		net.JoinHostPort(target, strconv.Itoa(port)), count, interval, payload)
+	fmt.Fprintln(os.Stderr)
 
-	config := probe.ICMPProbeConfig{
-		Target:   target,
-		Count:    count,
-		Interval: interval,
-		Timeout:  timeout,
+	config := probe.TWAMPLightProbeConfig{
+		Target:      target,
+		Port:        port,
+		Count:       count,
+		Interval:    interval,
+		PayloadSize: payload,
+		Timeout:     timeout,
+		IPVersion:   ipVersion,
+
+		KernelTimestamps: kernelTS,
 	}
 
-	prober := probe.NewICMPProber(config)
-	results, err := prober.Probe()
-	if err != nil {
-		log.Fatalf("Probe failed: %v", err)
+	runProbe(probe.NewTWAMPLightProber(config), "TWAMP-Light", target, window, outputFormat)
+}
+
+// ipVersionFlags converts the -4 and -6 flags into an IP version, 0 for either
+func ipVersionFlags(ipv4Only, ipv6Only bool) int {
+	switch {
+	case ipv4Only && ipv6Only:
+		fmt.Println("Error: -4 and -6 are mutually exclusive")
+		os.Exit(1)
+	case ipv4Only:
+		return 4
+	case ipv6Only:
+		return 6
 	}
+	return 0
+}
 
-	// Extract successful RTTs and calculate statistics
-	var rtts []time.Duration
-	failures := 0
-
-	for _, result := range results {
-		if result.Success {
-			rtts = append(rtts, result.RTT)
-		} else {
-			failures++
+// isFlagSet reports whether a flag was given explicitly on the command line
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// runProbe runs any prober and feeds its results through stats and output.
+// Results are streamed as they arrive; on SIGINT the run stops and a
+// summary of the partial results is printed.
+func runProbe(prober probe.Prober, probeType, target string, window time.Duration, outputFormat string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	tw := output.NewTableWriter(os.Stdout)
+	var results []probe.Result
+
+	err := prober.ProbeStream(ctx, func(r probe.Result) {
+		results = append(results, r)
+		if outputFormat != "json" {
+			_ = tw.WriteProbeResult(r)
 		}
+	})
+	stop()
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintf(os.Stderr, "\nInterrupted: summarizing %d completed probes\n", len(results))
+	case err != nil:
+		log.Fatalf("Probe failed: %v", err)
+	}
+	if outputFormat != "json" {
+		fmt.Println()
 	}
 
-	// Calculate statistics
+	// Extract successful RTTs and calculate statistics
+	rtts, _ := probe.SuccessfulRTTs(results)
+
 	hist := stats.NewLatencyHistogram(len(rtts))
 	hist.AddSamples(rtts)
 	histStats := hist.GetStats()
 
+	// Sketch of the RTTs that collectors can merge across reports
+	sketch := stats.NewDDSketch(stats.DefaultSketchAccuracy, stats.DefaultSketchMaxBins)
+	sketch.AddSamples(rtts)
+
 	// Calculate jitter
 	jitterStats := stats.CalculateJitterStats(rtts)
 
+	// IPDV and PDV, pairing results by sequence number rather than
+	// completion order
+	bySequence := make([]probe.Result, len(results))
+	copy(bySequence, results)
+	sort.SliceStable(bySequence, func(i, j int) bool { return bySequence[i].Sequence < bySequence[j].Sequence })
+	variation := stats.NewDelayVariationCalculator()
+	for _, r := range bySequence {
+		if r.Success {
+			variation.AddSample(r.Sequence, r.RTT)
+		}
+	}
+	variationStats := variation.Stats()
+
+	// Latency, loss and jitter per interval, in send order. Probes that
+	// failed before being sent have no send time to file them under.
+	bySendTime := make([]probe.Result, 0, len(results))
+	for _, r := range results {
+		if !r.SendTime.IsZero() {
+			bySendTime = append(bySendTime, r)
+		}
+	}
+	sort.SliceStable(bySendTime, func(i, j int) bool { return bySendTime[i].SendTime.Before(bySendTime[j].SendTime) })
+	windows := stats.NewWindowAggregator(window, stats.DefaultRollingIntervals)
+	for _, r := range bySendTime {
+		windows.Add(r.SendTime, r.RTT, r.Success)
+	}
+	series := windows.Series()
+
+	// Probes whose RTT stands out from their neighbours, in send order
+	spikeDetector := detect.NewSpikeDetector(detect.DefaultSpikeHalfWindow, detect.DefaultSpikeThreshold)
+	spikes := spikeDetector.Detect(bySendTime)
+
+	// Per-phase statistics for multi-step probes such as HTTP
+	phases := probe.RecordedPhases(results)
+	phaseStats := make([]stats.HistogramStats, len(phases))
+	for i, phase := range phases {
+		durations := probe.PhaseDurations(results, phase)
+		phaseHist := stats.NewLatencyHistogram(len(durations))
+		phaseHist.AddSamples(durations)
+		phaseStats[i] = phaseHist.GetStats()
+	}
+
+	// Loss, duplication and reordering by sequence number
+	analyzer := stats.NewSequenceAnalyzer()
+	for _, r := range results {
+		analyzer.AddSent(r.Sequence)
+		if r.Success {
+			analyzer.AddArrival(r.Sequence)
+		}
+	}
+	seqStats := analyzer.Stats()
+	lossModel := stats.FitGilbertElliott(analyzer.LossPattern(), stats.DefaultGmin)
+
+	// E-model voice quality for each built-in codec
+	burstR := stats.BurstRatio(seqStats)
+	voiceScores := make([]stats.VoiceScore, len(stats.Codecs))
+	for i, codec := range stats.Codecs {
+		voiceScores[i] = stats.NewVoiceQuality(codec).Score(histStats.Mean, jitterStats.Estimate, seqStats.LossRate, burstR)
+	}
+
+	// One-way delays for replies that carried reflector timestamps
+	oneWay, hasOneWay := probe.OneWay(results)
+	var forwardStats, reverseStats, processingStats stats.HistogramStats
+	if hasOneWay {
+		forwardStats = durationStats(oneWay.Forward)
+		reverseStats = durationStats(oneWay.Reverse)
+		processingStats = durationStats(oneWay.Processing)
+	}
+
+	// Reply anomalies, socket modes and timestamp sources are only
+	// reported by some probers
+	reporter, hasReplyStats := prober.(probe.ReplyReporter)
+	moder, hasSocketMode := prober.(probe.SocketModeReporter)
+	stamper, hasTimestamps := prober.(probe.TimestampReporter)
+
+	// Duplicate replies never become results, but the prober counts them
+	if hasReplyStats {
+		seqStats.Duplicates = reporter.ReplyStats().Duplicate
+	}
+
 	// Output results
 	switch outputFormat {
 	case "json":
-		_ = output.WriteProbeResultsJSON(os.Stdout, "ICMP", target, results, &histStats, &jitterStats)
+		report := output.NewProbeReportJSON(probeType, target, results, &histStats, &jitterStats)
+		report.SetDistribution(hist)
+		report.SetDelayVariation(variationStats)
+		report.SetSequenceStats(seqStats)
+		report.SetLossModel(lossModel)
+		report.SetLatencySketch(sketch)
+		report.SetTimeSeries(windows.Interval(), windows.Rolling(), series)
+		report.SetSpikes(spikeDetector.HalfWindow(), spikeDetector.Threshold(), spikes)
+		for _, vs := range voiceScores {
+			report.AddVoiceScore(vs)
+		}
+		if hasReplyStats {
+			report.SetReplyStats(reporter.ReplyStats())
+		}
+		if hasSocketMode {
+			report.SocketMode = moder.SocketMode()
+		}
+		if hasTimestamps {
+			report.TimestampSource = stamper.TimestampSource()
+		}
+		for i, phase := range phases {
+			report.AddPhaseStats(phase, phaseStats[i])
+		}
+		if hasOneWay {
+			report.SetOneWayDelays(oneWay.ClockOffset, forwardStats, reverseStats, processingStats)
+		}
+		_ = report.Write(os.Stdout)
 	default:
-		tw := output.NewTableWriter(os.Stdout)
-		_ = tw.WriteProbeResults("ICMP", target, rtts, failures)
-		_ = tw.WriteStatistics(histStats)
+		if hasSocketMode {
+			_ = tw.WriteSocketMode(moder.SocketMode())
+		}
+		if hasTimestamps {
+			_ = tw.WriteTimestampSource(stamper.TimestampSource())
+		}
+		_ = tw.WriteProbeResults(probeType, target, results)
+		_ = tw.WriteDistribution(hist)
+		for i, phase := range phases {
+			_ = tw.WritePhaseStatistics(phase, phaseStats[i])
+		}
+		if hasOneWay {
+			_ = tw.WriteOneWayDelays(oneWay.ClockOffset, forwardStats, reverseStats, processingStats)
+		}
+		_ = tw.WriteSpikes(spikeDetector.HalfWindow(), spikeDetector.Threshold(), spikes)
 		_ = tw.WriteJitterStats(jitterStats)
+		_ = tw.WriteDelayVariation(variationStats)
+		_ = tw.WriteSequenceStats(seqStats)
+		_ = tw.WriteLossModel(lossModel)
+		_ = tw.WriteVoiceQuality(voiceScores)
+		// A single interval would only repeat the statistics above
+		if len(series) > 1 {
+			_ = tw.WriteTimeSeries(windows.Interval(), windows.Rolling(), series)
+		}
+		if hasReplyStats {
+			_ = tw.WriteReplyStats(reporter.ReplyStats())
+		}
 	}
 }
 
+// durationStats summarizes a set of durations with a latency histogram
+func durationStats(durations []time.Duration) stats.HistogramStats {
+	hist := stats.NewLatencyHistogram(len(durations))
+	hist.AddSamples(durations)
+	return hist.GetStats()
+}
+
 func analyzeCommand(args []string) {
 	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
 
@@ -243,29 +652,16 @@ func analyzeCommand(args []string) {
 	fmt.Println("Measuring idle latency...")
 
 	// Create a probe function for the detector
-	probeFn := func(count int) ([]time.Duration, error) {
-		config := probe.UDPProbeConfig{
+	probeFn := detect.ProberFunc(func(count int) probe.Prober {
+		return probe.NewUDPProber(probe.UDPProbeConfig{
 			Target:      *target,
 			Port:        12345,
 			Count:       count,
 			Interval:    100 * time.Millisecond,
 			PayloadSize: 12,
 			Timeout:     3 * time.Second,
-		}
-		prober := probe.NewUDPProber(config)
-		results, err := prober.Probe()
-		if err != nil {
-			return nil, err
-		}
-
-		var rtts []time.Duration
-		for _, r := range results {
-			if r.Success {
-				rtts = append(rtts, r.RTT)
-			}
-		}
-		return rtts, nil
-	}
+		})
+	})
 
 	// Note: Bufferbloat detection requires a proper implementation
 	// For now, we'll just show the concept
@@ -318,6 +714,57 @@ func analyzeCommand(args []string) {
 	}
 }
 
+func compareCommand(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	outputFormat := fs.String("output", "table", "Output format: table or json")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fmt.Println("Error: compare needs an old and a new JSON report")
+		fs.Usage()
+		os.Exit(1)
+	}
+	oldPath, newPath := fs.Arg(0), fs.Arg(1)
+
+	oldReport, err := loadReport(oldPath)
+	if err != nil {
+		log.Fatalf("Failed to load %s: %v", oldPath, err)
+	}
+	newReport, err := loadReport(newPath)
+	if err != nil {
+		log.Fatalf("Failed to load %s: %v", newPath, err)
+	}
+
+	comparison, err := stats.Compare(oldReport.RTTs(), newReport.RTTs())
+	if err != nil {
+		log.Fatalf("Comparison failed: %v", err)
+	}
+
+	switch *outputFormat {
+	case "json":
+		_ = output.WriteComparisonJSON(os.Stdout, oldPath, newPath, comparison)
+	default:
+		tw := output.NewTableWriter(os.Stdout)
+		_ = tw.WriteComparison(reportName(oldPath, oldReport), reportName(newPath, newReport), comparison)
+	}
+}
+
+// loadReport reads a probe report saved with -output json
+func loadReport(path string) (*output.ProbeReportJSON, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return output.ReadProbeReportJSON(f)
+}
+
+// reportName describes a saved report by file, probe type and target
+func reportName(path string, report *output.ProbeReportJSON) string {
+	return fmt.Sprintf("%s, %s probe to %s at %s", path, report.ProbeType, report.Target,
+		time.Unix(report.Timestamp, 0).Format(time.RFC3339))
+}
+
 func listenCommand(args []string) {
 	fs := flag.NewFlagSet("listen", flag.ExitOnError)
 	port := fs.Int("port", 12345, "UDP port to listen on")
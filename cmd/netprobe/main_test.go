@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ErturkCan/netprobe/pkg/output"
+	"github.com/ErturkCan/netprobe/pkg/probe"
+)
+
+// writeReport saves a probe report with the given RTTs, as -output json
+// would, and returns its path
+func writeReport(t *testing.T, name string, rtts []time.Duration) string {
+	t.Helper()
+
+	results := make([]probe.Result, len(rtts)+1)
+	for i, rtt := range rtts {
+		results[i] = probe.Result{Sequence: i + 1, RTT: rtt, Success: true}
+	}
+	// A failed probe must not count as a sample
+	results[len(rtts)] = probe.Result{Sequence: len(rtts) + 1, ErrorClass: probe.ErrorTimeout}
+
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer f.Close()
+	if err := output.NewProbeReportJSON("udp", "192.0.2.1:12345", results, nil, nil).Write(f); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return path
+}
+
+// spread returns n RTTs from base up in steps of 100µs, repeating every 20
+func spread(n int, base time.Duration) []time.Duration {
+	rtts := make([]time.Duration, n)
+	for i := range rtts {
+		rtts[i] = base + time.Duration(i*7%20)*100*time.Microsecond
+	}
+	return rtts
+}
+
+// captureStdout returns what f writes to os.Stdout
+func captureStdout(t *testing.T, f func()) []byte {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- b
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestLoadReport(t *testing.T) {
+	rtts := spread(50, 10*time.Millisecond)
+	report, err := loadReport(writeReport(t, "run.json", rtts))
+	if err != nil {
+		t.Fatalf("loadReport: %v", err)
+	}
+	if report.ProbeType != "udp" || report.Target != "192.0.2.1:12345" {
+		t.Errorf("loaded a %s report for %s", report.ProbeType, report.Target)
+	}
+	got := report.RTTs()
+	if len(got) != len(rtts) {
+		t.Fatalf("loaded %d RTTs, want %d", len(got), len(rtts))
+	}
+	for i := range rtts {
+		if d := got[i] - rtts[i]; d < -time.Nanosecond || d > time.Nanosecond {
+			t.Fatalf("RTT %d = %v, want %v", i, got[i], rtts[i])
+		}
+	}
+
+	if _, err := loadReport(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loaded a missing report")
+	}
+}
+
+func TestCompareCommand(t *testing.T) {
+	oldPath := writeReport(t, "old.json", spread(200, 10*time.Millisecond))
+	newPath := writeReport(t, "new.json", spread(200, 15*time.Millisecond))
+
+	tests := []struct {
+		name       string
+		old, new   string
+		verdict    string
+		medianDiff float64
+	}{
+		{"slower", oldPath, newPath, "Worse", 5},
+		{"faster", newPath, oldPath, "Better", -5},
+		{"same run", oldPath, oldPath, "No significant change", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := captureStdout(t, func() {
+				compareCommand([]string{"-output", "json", tt.old, tt.new})
+			})
+
+			var c output.ComparisonJSON
+			if err := json.Unmarshal(out, &c); err != nil {
+				t.Fatalf("decoding %q: %v", out, err)
+			}
+			if c.Old != tt.old || c.New != tt.new || c.CountOld != 200 || c.CountNew != 200 {
+				t.Errorf("compared %s (%d) with %s (%d)", c.Old, c.CountOld, c.New, c.CountNew)
+			}
+			if c.Verdict != tt.verdict {
+				t.Errorf("verdict %q, want %q", c.Verdict, tt.verdict)
+			}
+			if d := c.MedianDiffMs - tt.medianDiff; d < -1e-6 || d > 1e-6 {
+				t.Errorf("median difference %vms, want %vms", c.MedianDiffMs, tt.medianDiff)
+			}
+		})
+	}
+
+	// The table names both runs and gives the verdict
+	out := captureStdout(t, func() { compareCommand([]string{oldPath, newPath}) })
+	for _, want := range []string{"=== Run Comparison ===", oldPath, newPath, "Worse"} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("table output lacks %q:\n%s", want, out)
+		}
+	}
+}
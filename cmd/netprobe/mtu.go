@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ErturkCan/netprobe/pkg/output"
+	"github.com/ErturkCan/netprobe/pkg/probe"
+)
+
+func mtuCommand(args []string) {
+	fs := flag.NewFlagSet("mtu", flag.ExitOnError)
+
+	target := fs.String("target", "", "Target host or IP address")
+	method := fs.String("type", "icmp", "Probe type: icmp or udp")
+	port := fs.Int("port", 33434, "Destination port for UDP probes")
+	minMTU := fs.Int("min", 0, "Smallest packet size to try (default: 68 for IPv4, 1280 for IPv6)")
+	maxMTU := fs.Int("max", 1500, "Largest packet size to try")
+	attempts := fs.Int("attempts", 3, "Probes per size before it counts as lost")
+	timeout := fs.Duration("timeout", 1*time.Second, "Response timeout")
+	outputFormat := fs.String("output", "table", "Output format: table or json")
+	ipv4Only := fs.Bool("4", false, "Use IPv4 only")
+	ipv6Only := fs.Bool("6", false, "Use IPv6 only")
+	icmpMode := fs.String("icmp-mode", "auto", "ICMP socket mode: auto or raw")
+
+	fs.Parse(args)
+
+	if *target == "" {
+		fmt.Println("Error: -target flag is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	ipVersion := ipVersionFlags(*ipv4Only, *ipv6Only)
+
+	if *method != probe.MTUMethodICMP && *method != probe.MTUMethodUDP {
+		fmt.Printf("Error: Unknown MTU probe type: %s\n", *method)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Path MTU Discovery: target=%s, type=%s, max=%d\n", *target, *method, *maxMTU)
+	fmt.Println()
+
+	discoverer := probe.NewMTUDiscoverer(probe.MTUConfig{
+		Target:    *target,
+		Method:    *method,
+		Port:      *port,
+		MinMTU:    *minMTU,
+		MaxMTU:    *maxMTU,
+		Attempts:  *attempts,
+		Timeout:   *timeout,
+		IPVersion: ipVersion,
+		ICMPMode:  probe.ICMPMode(*icmpMode),
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := discoverer.Discover(ctx)
+	if err != nil {
+		log.Fatalf("MTU discovery failed: %v", err)
+	}
+
+	switch *outputFormat {
+	case "json":
+		_ = output.WriteMTUResultJSON(os.Stdout, *target, *method, result)
+	default:
+		tw := output.NewTableWriter(os.Stdout)
+		_ = tw.WriteMTUResult(*target, result)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ErturkCan/netprobe/pkg/output"
+	"github.com/ErturkCan/netprobe/pkg/probe"
+)
+
+func traceCommand(args []string) {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+
+	target := fs.String("target", "", "Target host or IP address")
+	method := fs.String("type", "icmp", "Probe type: icmp or udp")
+	port := fs.Int("port", 33434, "Destination port for UDP probes")
+	maxHops := fs.Int("max-hops", 30, "Maximum number of hops")
+	rounds := fs.Int("count", 10, "Number of probes per hop")
+	interval := fs.Duration("interval", 1*time.Second, "Interval between rounds")
+	timeout := fs.Duration("timeout", 2*time.Second, "Response timeout")
+	outputFormat := fs.String("output", "table", "Output format: table or json")
+	ipv4Only := fs.Bool("4", false, "Use IPv4 only")
+	ipv6Only := fs.Bool("6", false, "Use IPv6 only")
+	icmpMode := fs.String("icmp-mode", "auto", "ICMP socket mode: auto, raw or unprivileged")
+
+	fs.Parse(args)
+
+	if *target == "" {
+		fmt.Println("Error: -target flag is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	ipVersion := ipVersionFlags(*ipv4Only, *ipv6Only)
+
+	if *method != probe.TraceMethodICMP && *method != probe.TraceMethodUDP {
+		fmt.Printf("Error: Unknown trace type: %s\n", *method)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Trace: target=%s, type=%s, max-hops=%d, count=%d, interval=%v\n",
+		*target, *method, *maxHops, *rounds, *interval)
+	fmt.Println()
+
+	tracer := probe.NewTracer(probe.TraceConfig{
+		Target:    *target,
+		Method:    *method,
+		Port:      *port,
+		MaxHops:   *maxHops,
+		Rounds:    *rounds,
+		Interval:  *interval,
+		Timeout:   *timeout,
+		IPVersion: ipVersion,
+		ICMPMode:  probe.ICMPMode(*icmpMode),
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	completed := 0
+	hops, err := tracer.Trace(ctx, func(round int, hops []*probe.Hop) {
+		completed = round
+		if *outputFormat != "json" {
+			answered := 0
+			for _, hop := range hops {
+				if hop.Received > 0 {
+					answered++
+				}
+			}
+			fmt.Printf("round=%-4d hops=%-4d responding=%d\n", round, len(hops), answered)
+		}
+	})
+	stop()
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintf(os.Stderr, "\nInterrupted: summarizing %d completed rounds\n", completed)
+	case err != nil:
+		log.Fatalf("Trace failed: %v", err)
+	}
+	if *outputFormat != "json" {
+		fmt.Println()
+	}
+
+	switch *outputFormat {
+	case "json":
+		_ = output.WriteTraceJSON(os.Stdout, *target, *method, completed, hops)
+	default:
+		tw := output.NewTableWriter(os.Stdout)
+		_ = tw.WriteTraceHops(*target, completed, hops)
+	}
+}
@@ -55,3 +55,38 @@ func DurationMicros(d time.Duration) int64 {
 func DurationMillis(d time.Duration) float64 {
 	return float64(d.Microseconds()) / 1000.0
 }
+
+// ntpEpochOffset is the number of seconds from the NTP epoch (1900) to the
+// Unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+// NTPTimestamp converts a time to the 64-bit NTP timestamp format: seconds
+// since 1900 in the upper 32 bits and the binary fraction in the lower 32.
+// The zero time encodes as 0; the instant the 2036 era begins, which would
+// also encode as 0, is moved one fraction unit later.
+func NTPTimestamp(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	secs := uint64(t.Unix()+ntpEpochOffset) & 0xffffffff
+	frac := (uint64(t.Nanosecond()) << 32) / uint64(time.Second)
+	if secs == 0 && frac == 0 {
+		frac = 1
+	}
+	return secs<<32 | frac
+}
+
+// FromNTPTimestamp converts a 64-bit NTP timestamp to a time. Seconds with
+// the top bit clear are taken to be in the era starting in 2036, when the
+// 32-bit seconds field wraps.
+func FromNTPTimestamp(ts uint64) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	secs := int64(ts >> 32)
+	if secs < 1<<31 {
+		secs += 1 << 32
+	}
+	nanos := ((ts&0xffffffff)*uint64(time.Second) + 1<<31) >> 32
+	return time.Unix(secs-ntpEpochOffset, int64(nanos))
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNTPTimestamp(t *testing.T) {
+	// The 32-bit seconds field wraps 2^32 seconds after 1900
+	era1 := time.Date(2036, time.February, 7, 6, 28, 16, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want uint64
+	}{
+		{"zero time", time.Time{}, 0},
+		{"Unix epoch", time.Unix(0, 0), ntpEpochOffset << 32},
+		{"half second", time.Unix(0, 500000000), ntpEpochOffset<<32 | 1<<31},
+		{"last second of era 0", era1.Add(-time.Second), 0xffffffff << 32},
+		{"last nanosecond of era 0", era1.Add(-time.Nanosecond), 0xffffffff<<32 | 0xfffffffb},
+		// Would be 0, which means no timestamp
+		{"start of era 1", era1, 1},
+		{"era 1", era1.Add(time.Second + 250*time.Millisecond), 1<<32 | 1<<30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NTPTimestamp(tt.t); got != tt.want {
+				t.Errorf("NTPTimestamp(%v) = %#x, want %#x", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromNTPTimestamp(t *testing.T) {
+	era1 := time.Date(2036, time.February, 7, 6, 28, 16, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		ts   uint64
+		want time.Time
+	}{
+		{"zero", 0, time.Time{}},
+		{"Unix epoch", ntpEpochOffset << 32, time.Unix(0, 0)},
+		// Rounded to the nearest nanosecond
+		{"one fraction unit", ntpEpochOffset<<32 | 1, time.Unix(0, 0)},
+		{"three fraction units", ntpEpochOffset<<32 | 3, time.Unix(0, 1)},
+		{"last second of era 0", 0xffffffff << 32, era1.Add(-time.Second)},
+		{"start of era 1", 1, era1},
+		{"era 1", 1<<32 | 1<<30, era1.Add(time.Second + 250*time.Millisecond)},
+		// The eras are split at 2^31 seconds, in 1968 and 2104
+		{"last second read as era 1", (1<<31 - 1) << 32, era1.Add((1<<31 - 1) * time.Second)},
+		{"first second read as era 0", 1 << 63, time.Date(1968, time.January, 20, 3, 14, 8, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromNTPTimestamp(tt.ts); !got.Equal(tt.want) {
+				t.Errorf("FromNTPTimestamp(%#x) = %v, want %v", tt.ts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNTPTimestampRoundTrip(t *testing.T) {
+	era1 := time.Date(2036, time.February, 7, 6, 28, 16, 0, time.UTC)
+
+	for _, want := range []time.Time{
+		time.Date(2024, time.March, 1, 12, 0, 0, 123456789, time.UTC),
+		era1.Add(-time.Nanosecond),
+		era1,
+		era1.Add(time.Nanosecond),
+		time.Date(2040, time.July, 4, 0, 0, 0, 999999999, time.UTC),
+	} {
+		if got := FromNTPTimestamp(NTPTimestamp(want)); !got.Equal(want) {
+			t.Errorf("round trip of %v gave %v", want, got)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ErturkCan/netprobe/pkg/probe"
 	"github.com/ErturkCan/netprobe/pkg/stats"
 )
 
@@ -20,6 +21,19 @@ func NewBufferbloatDetector(probeFn func(count int) ([]time.Duration, error)) *B
 	}
 }
 
+// ProberFunc adapts a prober factory into a probe function for the detector.
+// Only the RTTs of successful probes are returned.
+func ProberFunc(newProber func(count int) probe.Prober) func(count int) ([]time.Duration, error) {
+	return func(count int) ([]time.Duration, error) {
+		results, err := newProber(count).Probe()
+		if err != nil {
+			return nil, err
+		}
+		rtts, _ := probe.SuccessfulRTTs(results)
+		return rtts, nil
+	}
+}
+
 // BufferbloatResult holds bufferbloat detection results
 type BufferbloatResult struct {
 	IdleLatencyP50    time.Duration
@@ -66,7 +80,7 @@ func (bd *BufferbloatDetector) Detect(idleCount, loadCount int) (BufferbloatResu
 				return
 			case <-ticker.C:
 				// Send probe in background (doesn't accumulate results)
-				_ = bd.probeFn(1)
+				_, _ = bd.probeFn(1)
 			}
 		}
 	}()
@@ -0,0 +1,148 @@
+package detect
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ErturkCan/netprobe/pkg/probe"
+)
+
+// Spike detector defaults
+const (
+	DefaultSpikeHalfWindow = 7   // Probes on each side of the one being tested
+	DefaultSpikeThreshold  = 3.0 // Robust standard deviations above the median
+)
+
+// madScale turns a median absolute deviation into an estimate of the
+// standard deviation of normally distributed data
+const madScale = 1.4826
+
+// Smallest spread assumed around the local median. Without a floor a run of
+// identical RTTs would have a MAD of zero and any slower probe would count
+// as a spike; on fast paths the absolute floor keeps timer and scheduling
+// noise from doing the same.
+const (
+	minSpikeSpread    = 0.05                  // Fraction of the median
+	minSpikeSpreadAbs = 50 * time.Microsecond // Absolute floor
+)
+
+// SpikeDetector finds RTT spikes in a run with a Hampel filter: each probe is
+// compared with the median of a window of probes around it, and flagged when
+// it exceeds that median by more than threshold times the scaled median
+// absolute deviation (MAD) of the window. Median and MAD are barely moved by
+// the spikes themselves, unlike mean and standard deviation, so one 500ms
+// probe stands out even in a short run. Only probes slower than the median
+// are flagged.
+type SpikeDetector struct {
+	halfWindow int     // Probes on each side of the one being tested
+	threshold  float64 // Robust standard deviations for a spike
+}
+
+// NewSpikeDetector creates a spike detector comparing each probe with
+// halfWindow probes on either side. Zero arguments select
+// DefaultSpikeHalfWindow and DefaultSpikeThreshold.
+func NewSpikeDetector(halfWindow int, threshold float64) *SpikeDetector {
+	if halfWindow <= 0 {
+		halfWindow = DefaultSpikeHalfWindow
+	}
+	if threshold <= 0 {
+		threshold = DefaultSpikeThreshold
+	}
+
+	return &SpikeDetector{
+		halfWindow: halfWindow,
+		threshold:  threshold,
+	}
+}
+
+// HalfWindow returns the number of probes on each side of the one tested
+func (sd *SpikeDetector) HalfWindow() int {
+	return sd.halfWindow
+}
+
+// Threshold returns the number of robust standard deviations for a spike
+func (sd *SpikeDetector) Threshold() float64 {
+	return sd.threshold
+}
+
+// Spike is a probe whose RTT stands out from the probes around it
+type Spike struct {
+	Sequence int           // Probe sequence number
+	RTT      time.Duration // Round-trip time of the probe
+	Baseline time.Duration // Median RTT of the surrounding window
+	Score    float64       // Excess over the baseline in robust standard deviations
+	Severity string        // "Minor", "Major" or "Severe"
+}
+
+// Detect scans the successful probes of a run, in the order given, and
+// returns the spikes among them. Results should be in send order. Near the
+// ends of the run the window is shifted so it keeps its full size.
+func (sd *SpikeDetector) Detect(results []probe.Result) []Spike {
+	var series []probe.Result
+	for _, r := range results {
+		if r.Success {
+			series = append(series, r)
+		}
+	}
+
+	n := len(series)
+	size := min(n, 2*sd.halfWindow+1)
+	window := make([]float64, size)
+	deviations := make([]float64, size)
+
+	var spikes []Spike
+	for i, r := range series {
+		start := min(max(0, i-sd.halfWindow), n-size)
+		for j := range window {
+			window[j] = float64(series[start+j].RTT)
+		}
+		median := medianOf(window)
+		for j, v := range window {
+			deviations[j] = math.Abs(v - median)
+		}
+		spread := max(madScale*medianOf(deviations), minSpikeSpread*median, float64(minSpikeSpreadAbs))
+		score := (float64(r.RTT) - median) / spread
+		if score <= sd.threshold {
+			continue
+		}
+		spikes = append(spikes, Spike{
+			Sequence: r.Sequence,
+			RTT:      r.RTT,
+			Baseline: time.Duration(median),
+			Score:    score,
+			Severity: sd.assessSpike(score),
+		})
+	}
+
+	return spikes
+}
+
+// medianOf returns the median of values, reordering them
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// assessSpike rates a spike by how far past the threshold its score is
+func (sd *SpikeDetector) assessSpike(score float64) string {
+	switch {
+	case score > 4*sd.threshold:
+		return "Severe"
+	case score > 2*sd.threshold:
+		return "Major"
+	default:
+		return "Minor"
+	}
+}
+
+// String returns a formatted string representation
+func (s Spike) String() string {
+	return fmt.Sprintf("Seq %d: %.3fms vs %.3fms baseline, score %.1f (%s)",
+		s.Sequence, s.RTT.Seconds()*1000, s.Baseline.Seconds()*1000, s.Score, s.Severity)
+}
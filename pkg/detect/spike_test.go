@@ -0,0 +1,112 @@
+package detect
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ErturkCan/netprobe/pkg/probe"
+)
+
+// series returns successful results with the given RTTs in milliseconds and
+// sequence numbers from 1
+func series(rtts ...float64) []probe.Result {
+	results := make([]probe.Result, len(rtts))
+	for i, ms := range rtts {
+		results[i] = probe.Result{
+			Sequence: i + 1,
+			Success:  true,
+			RTT:      time.Duration(ms * float64(time.Millisecond)),
+		}
+	}
+	return results
+}
+
+// flat returns n RTTs of ms milliseconds
+func flat(n int, ms float64) []float64 {
+	rtts := make([]float64, n)
+	for i := range rtts {
+		rtts[i] = ms
+	}
+	return rtts
+}
+
+// with returns a copy of rtts with the RTT at index i replaced
+func with(rtts []float64, i int, ms float64) []float64 {
+	rtts = append([]float64(nil), rtts...)
+	rtts[i] = ms
+	return rtts
+}
+
+func TestSpikeDetector(t *testing.T) {
+	base := flat(21, 20)
+
+	// In a flat 20ms series the MAD is zero, so the spread is the 5% floor
+	// of 1ms and a probe's score is its excess in milliseconds
+	type spike struct {
+		sequence int
+		score    float64
+		severity string
+	}
+	tests := []struct {
+		name string
+		rtts []float64
+		want []spike
+	}{
+		{"single 500ms probe", with(base, 10, 500), []spike{{11, 480, "Severe"}}},
+		{"major", with(base, 10, 28), []spike{{11, 8, "Major"}}},
+		{"minor", with(base, 10, 24), []spike{{11, 4, "Minor"}}},
+		{"within threshold", with(base, 10, 22), nil},
+		{"constant", base, nil},
+		{"constant at the absolute floor", flat(21, 0.1), nil},
+		{"faster than the median", with(with(base, 3, 1), 10, 0.01), nil},
+		{"first probe", with(base, 0, 500), []spike{{1, 480, "Severe"}}},
+		{"last probe", with(base, 20, 500), []spike{{21, 480, "Severe"}}},
+		{
+			// Each end probe is tested against the first or last full
+			// window, not one cut short
+			name: "spikes at both ends",
+			rtts: []float64{40, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 20, 40},
+			want: []spike{{1, 20, "Severe"}, {17, 20, "Severe"}},
+		},
+		{"shorter than the window", []float64{20, 20, 500, 20, 20}, []spike{{3, 480, "Severe"}}},
+		{"two probes", []float64{20, 500}, nil},
+		{"one probe", []float64{500}, nil},
+		{"empty", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewSpikeDetector(0, 0).Detect(series(tt.rtts...))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d spikes %v, want %d", len(got), got, len(tt.want))
+			}
+			for i, w := range tt.want {
+				s := got[i]
+				if s.Sequence != w.sequence || s.Severity != w.severity || math.Abs(s.Score-w.score) > 1e-6 {
+					t.Errorf("spike %d = %v, want sequence %d, score %.1f (%s)", i, s, w.sequence, w.score, w.severity)
+				}
+			}
+		})
+	}
+}
+
+func TestSpikeDetectorSkipsFailures(t *testing.T) {
+	results := series(with(flat(15, 20), 7, 500)...)
+	// Failed probes carry no RTT and are left out of the windows
+	results[3] = probe.Result{Sequence: 4}
+	results[9] = probe.Result{Sequence: 10, ErrorClass: probe.ErrorTimeout}
+
+	spikes := NewSpikeDetector(0, 0).Detect(results)
+	if len(spikes) != 1 || spikes[0].Sequence != 8 || spikes[0].Baseline != 20*time.Millisecond {
+		t.Errorf("got %v, want one spike at sequence 8 with a 20ms baseline", spikes)
+	}
+}
+
+func TestNewSpikeDetectorDefaults(t *testing.T) {
+	sd := NewSpikeDetector(0, 0)
+	if sd.HalfWindow() != DefaultSpikeHalfWindow || sd.Threshold() != DefaultSpikeThreshold {
+		t.Errorf("got half window %d, threshold %v; want %d, %v",
+			sd.HalfWindow(), sd.Threshold(), DefaultSpikeHalfWindow, DefaultSpikeThreshold)
+	}
+}
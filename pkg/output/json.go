@@ -2,19 +2,29 @@ package output
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"math"
 	"time"
 
+	"github.com/ErturkCan/netprobe/pkg/detect"
+	"github.com/ErturkCan/netprobe/pkg/probe"
 	"github.com/ErturkCan/netprobe/pkg/stats"
 )
 
 // ProbeResultJSON represents a single probe result in JSON format
 type ProbeResultJSON struct {
-	Sequence   int    `json:"sequence"`
+	Sequence   int     `json:"sequence"`
 	RTTMs      float64 `json:"rtt_ms"`
-	Success    bool   `json:"success"`
-	Error      string `json:"error,omitempty"`
-	PayloadLen int    `json:"payload_len,omitempty"`
+	Success    bool    `json:"success"`
+	ErrorClass string  `json:"error_class,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	PayloadLen int     `json:"payload_len,omitempty"`
+	Reordered  bool    `json:"reordered,omitempty"`
+	Spike      string  `json:"spike,omitempty"`
+	SpikeScore float64 `json:"spike_score,omitempty"`
+
+	PhasesMs map[string]float64 `json:"phases_ms,omitempty"`
 }
 
 // HistogramStatsJSON represents histogram statistics in JSON format
@@ -28,6 +38,20 @@ type HistogramStatsJSON struct {
 	P90Ms      float64 `json:"p90_ms"`
 	P99Ms      float64 `json:"p99_ms"`
 	P999Ms     float64 `json:"p999_ms"`
+
+	Intervals []PercentileCIJSON `json:"intervals,omitempty"`
+}
+
+// PercentileCIJSON represents a percentile with its confidence interval in
+// JSON format
+type PercentileCIJSON struct {
+	Percentile float64 `json:"percentile"`
+	ValueMs    float64 `json:"value_ms"`
+	LowerMs    float64 `json:"lower_ms"`
+	UpperMs    float64 `json:"upper_ms"`
+	Confidence float64 `json:"confidence"`
+	Bounded    bool    `json:"bounded"`
+	MinSamples int     `json:"min_samples"`
 }
 
 // JitterStatsJSON represents jitter statistics in JSON format
@@ -37,58 +61,170 @@ type JitterStatsJSON struct {
 	Magnitude  string  `json:"magnitude"`
 }
 
+// DelayVariationJSON represents IPDV and PDV distributions in JSON format
+type DelayVariationJSON struct {
+	IPDV HistogramStatsJSON `json:"ipdv"`
+	PDV  HistogramStatsJSON `json:"pdv"`
+}
+
+// ReplyStatsJSON represents reply anomaly counts in JSON format
+type ReplyStatsJSON struct {
+	Late      int `json:"late"`
+	Duplicate int `json:"duplicate"`
+	Reordered int `json:"reordered"`
+	Unmatched int `json:"unmatched"`
+}
+
+// SequenceStatsJSON represents loss, duplication and reordering metrics in
+// JSON format
+type SequenceStatsJSON struct {
+	Sent              int     `json:"sent"`
+	Received          int     `json:"received"`
+	Lost              int     `json:"lost"`
+	LossRate          float64 `json:"loss_rate"`
+	Duplicates        int     `json:"duplicates"`
+	Reordered         int     `json:"reordered"`
+	ReorderedRatio    float64 `json:"reordered_ratio"`
+	MaxExtent         int     `json:"max_reorder_extent"`
+	MeanExtent        float64 `json:"mean_reorder_extent"`
+	MaxNReordering    int     `json:"max_n_reordering"`
+	Discontinuities   int     `json:"discontinuities"`
+	DiscontinuitySize int     `json:"discontinuity_size"`
+	LossPeriods       int     `json:"loss_periods"`
+	MaxLossPeriod     int     `json:"max_loss_period"`
+	MeanLossPeriod    float64 `json:"mean_loss_period"`
+	MeanLossDistance  float64 `json:"mean_loss_distance"`
+	MeanLossGap       float64 `json:"mean_loss_gap"`
+}
+
+// LossModelJSON represents a Gilbert-Elliott burst loss model in JSON format
+type LossModelJSON struct {
+	P               float64 `json:"p"`
+	R               float64 `json:"r"`
+	BurstDensity    float64 `json:"burst_density"`
+	GapDensity      float64 `json:"gap_density"`
+	Bursts          int     `json:"bursts"`
+	MeanBurstLength float64 `json:"mean_burst_length"`
+	MeanGapLength   float64 `json:"mean_gap_length"`
+}
+
+// VoiceScoreJSON represents an E-model voice quality estimate in JSON format
+type VoiceScoreJSON struct {
+	Codec         string  `json:"codec"`
+	OneWayDelayMs float64 `json:"one_way_delay_ms"`
+	Ppl           float64 `json:"ppl"`
+	BurstR        float64 `json:"burst_r"`
+	Id            float64 `json:"id"`
+	IeEff         float64 `json:"ie_eff"`
+	R             float64 `json:"r_factor"`
+	MOS           float64 `json:"mos"`
+	Rating        string  `json:"rating"`
+	Provisional   bool    `json:"provisional,omitempty"`
+}
+
+// WindowStatsJSON represents the statistics of one interval in JSON format
+type WindowStatsJSON struct {
+	Start           int64              `json:"start"`
+	Sent            int                `json:"sent"`
+	Lost            int                `json:"lost"`
+	LossRate        float64            `json:"loss_rate"`
+	Latency         HistogramStatsJSON `json:"latency"`
+	JitterMs        float64            `json:"jitter_ms"`
+	RollingSent     int                `json:"rolling_sent"`
+	RollingLossRate float64            `json:"rolling_loss_rate"`
+	RollingLatency  HistogramStatsJSON `json:"rolling_latency"`
+	RollingJitterMs float64            `json:"rolling_jitter_ms"`
+}
+
+// TimeSeriesJSON represents per-interval statistics in JSON format
+type TimeSeriesJSON struct {
+	IntervalMs       float64           `json:"interval_ms"`
+	RollingIntervals int               `json:"rolling_intervals"`
+	Windows          []WindowStatsJSON `json:"windows"`
+}
+
+// OneWayJSON represents one-way delay statistics in JSON format
+type OneWayJSON struct {
+	ClockOffsetMs float64            `json:"clock_offset_ms"`
+	Forward       HistogramStatsJSON `json:"forward"`
+	Reverse       HistogramStatsJSON `json:"reverse"`
+	Processing    HistogramStatsJSON `json:"processing"`
+}
+
+// SpikesJSON summarizes spike detection in JSON format. The spikes
+// themselves are flagged on their probe results.
+type SpikesJSON struct {
+	HalfWindow int     `json:"half_window"`
+	Threshold  float64 `json:"threshold"`
+	Count      int     `json:"count"`
+	Minor      int     `json:"minor"`
+	Major      int     `json:"major"`
+	Severe     int     `json:"severe"`
+}
+
 // ProbeReportJSON represents a complete probe report
 type ProbeReportJSON struct {
-	Timestamp    int64              `json:"timestamp"`
-	ProbeType    string             `json:"probe_type"`
-	Target       string             `json:"target"`
-	ProbeResults []ProbeResultJSON  `json:"probe_results"`
-	Statistics   HistogramStatsJSON `json:"statistics"`
-	Jitter       JitterStatsJSON    `json:"jitter,omitempty"`
+	Timestamp       int64               `json:"timestamp"`
+	ProbeType       string              `json:"probe_type"`
+	Target          string              `json:"target"`
+	SocketMode      string              `json:"socket_mode,omitempty"`
+	TimestampSource string              `json:"timestamp_source,omitempty"`
+	ProbeResults    []ProbeResultJSON   `json:"probe_results"`
+	Statistics      HistogramStatsJSON  `json:"statistics"`
+	Jitter          JitterStatsJSON     `json:"jitter,omitempty"`
+	DelayVariation  *DelayVariationJSON `json:"delay_variation,omitempty"`
+	Replies         *ReplyStatsJSON     `json:"replies,omitempty"`
+	Sequence        *SequenceStatsJSON  `json:"sequence,omitempty"`
+	LossModel       *LossModelJSON      `json:"loss_model,omitempty"`
+	VoiceQuality    []VoiceScoreJSON    `json:"voice_quality,omitempty"`
+	OneWay          *OneWayJSON         `json:"one_way,omitempty"`
+	LatencySketch   *stats.DDSketch     `json:"latency_sketch,omitempty"`
+	TimeSeries      *TimeSeriesJSON     `json:"time_series,omitempty"`
+	Spikes          *SpikesJSON         `json:"spikes,omitempty"`
+
+	Phases map[string]HistogramStatsJSON `json:"phases,omitempty"`
 }
 
 // WriteProbeResultsJSON writes probe results as JSON
-func WriteProbeResultsJSON(w io.Writer, probeType, target string, results interface{}, histStats *stats.HistogramStats, jitterStats *stats.JitterStats) error {
-	report := ProbeReportJSON{
-		Timestamp: time.Now().Unix(),
-		ProbeType: probeType,
-		Target:    target,
+func WriteProbeResultsJSON(w io.Writer, probeType, target string, results []probe.Result, histStats *stats.HistogramStats, jitterStats *stats.JitterStats) error {
+	return NewProbeReportJSON(probeType, target, results, histStats, jitterStats).Write(w)
+}
+
+// NewProbeReportJSON builds a probe report. Optional sections can be added
+// to the returned report before it is written.
+func NewProbeReportJSON(probeType, target string, results []probe.Result, histStats *stats.HistogramStats, jitterStats *stats.JitterStats) *ProbeReportJSON {
+	report := &ProbeReportJSON{
+		Timestamp:    time.Now().Unix(),
+		ProbeType:    probeType,
+		Target:       target,
+		ProbeResults: make([]ProbeResultJSON, len(results)),
 	}
 
-	// Convert results based on type
-	switch v := results.(type) {
-	case []interface{}:
-		report.ProbeResults = make([]ProbeResultJSON, len(v))
-		for i, r := range v {
-			pj := ProbeResultJSON{}
-			if m, ok := r.(map[string]interface{}); ok {
-				if rtt, ok := m["rtt"].(time.Duration); ok {
-					pj.RTTMs = rtt.Seconds() * 1000
-				}
-				if success, ok := m["success"].(bool); ok {
-					pj.Success = success
-				}
-				if errMsg, ok := m["error"].(string); ok {
-					pj.Error = errMsg
-				}
+	// Convert results
+	for i, r := range results {
+		pj := ProbeResultJSON{
+			Sequence:   r.Sequence,
+			RTTMs:      r.RTT.Seconds() * 1000,
+			Success:    r.Success,
+			ErrorClass: string(r.ErrorClass),
+			PayloadLen: r.Bytes,
+			Reordered:  r.Reordered,
+		}
+		if r.Error != nil {
+			pj.Error = r.Error.Error()
+		}
+		if len(r.Phases) > 0 {
+			pj.PhasesMs = make(map[string]float64, len(r.Phases))
+			for phase, d := range r.Phases {
+				pj.PhasesMs[string(phase)] = d.Seconds() * 1000
 			}
-			report.ProbeResults[i] = pj
 		}
+		report.ProbeResults[i] = pj
 	}
 
 	// Add statistics if provided
 	if histStats != nil {
-		report.Statistics = HistogramStatsJSON{
-			Count:    histStats.Count,
-			MinMs:    histStats.Min.Seconds() * 1000,
-			MaxMs:    histStats.Max.Seconds() * 1000,
-			MeanMs:   histStats.Mean.Seconds() * 1000,
-			StdDevMs: histStats.StdDev.Seconds() * 1000,
-			P50Ms:    histStats.P50.Seconds() * 1000,
-			P90Ms:    histStats.P90.Seconds() * 1000,
-			P99Ms:    histStats.P99.Seconds() * 1000,
-			P999Ms:   histStats.P999.Seconds() * 1000,
-		}
+		report.Statistics = newHistogramStatsJSON(*histStats)
 	}
 
 	// Add jitter stats if provided
@@ -100,6 +236,383 @@ func WriteProbeResultsJSON(w io.Writer, probeType, target string, results interf
 		}
 	}
 
+	return report
+}
+
+// SetDistribution replaces the report statistics with those of any
+// latency distribution
+func (r *ProbeReportJSON) SetDistribution(d stats.Distribution) {
+	r.Statistics = newHistogramStatsJSON(d.GetStats())
+	for _, ci := range stats.PercentileIntervals(d, stats.DefaultConfidence) {
+		r.Statistics.Intervals = append(r.Statistics.Intervals, PercentileCIJSON{
+			Percentile: ci.Percentile,
+			ValueMs:    ci.Value.Seconds() * 1000,
+			LowerMs:    ci.Lower.Seconds() * 1000,
+			UpperMs:    ci.Upper.Seconds() * 1000,
+			Confidence: ci.Confidence,
+			Bounded:    ci.Bounded,
+			MinSamples: ci.MinSamples,
+		})
+	}
+}
+
+// SetLatencySketch adds a mergeable sketch of the RTTs to the report, so
+// percentiles can be computed across reports without their raw samples
+func (r *ProbeReportJSON) SetLatencySketch(s *stats.DDSketch) {
+	r.LatencySketch = s
+}
+
+// SetTimeSeries adds per-interval statistics to the report. Interval start
+// times are Unix milliseconds.
+func (r *ProbeReportJSON) SetTimeSeries(interval time.Duration, rolling int, series []stats.WindowStats) {
+	if len(series) == 0 {
+		return
+	}
+
+	ts := &TimeSeriesJSON{
+		IntervalMs:       interval.Seconds() * 1000,
+		RollingIntervals: rolling,
+		Windows:          make([]WindowStatsJSON, len(series)),
+	}
+	for i, ws := range series {
+		ts.Windows[i] = WindowStatsJSON{
+			Start:           ws.Start.UnixMilli(),
+			Sent:            ws.Sent,
+			Lost:            ws.Lost,
+			LossRate:        ws.LossRate,
+			Latency:         newHistogramStatsJSON(ws.Latency),
+			JitterMs:        ws.Jitter.Seconds() * 1000,
+			RollingSent:     ws.RollingSent,
+			RollingLossRate: ws.RollingLossRate,
+			RollingLatency:  newHistogramStatsJSON(ws.RollingLatency),
+			RollingJitterMs: ws.RollingJitter.Seconds() * 1000,
+		}
+	}
+	r.TimeSeries = ts
+}
+
+// AddPhaseStats adds the latency statistics of one probe phase to the report
+func (r *ProbeReportJSON) AddPhaseStats(phase probe.Phase, hs stats.HistogramStats) {
+	if r.Phases == nil {
+		r.Phases = make(map[string]HistogramStatsJSON)
+	}
+	r.Phases[string(phase)] = newHistogramStatsJSON(hs)
+}
+
+// newHistogramStatsJSON converts histogram statistics to JSON form
+func newHistogramStatsJSON(hs stats.HistogramStats) HistogramStatsJSON {
+	return HistogramStatsJSON{
+		Count:    hs.Count,
+		MinMs:    hs.Min.Seconds() * 1000,
+		MaxMs:    hs.Max.Seconds() * 1000,
+		MeanMs:   hs.Mean.Seconds() * 1000,
+		StdDevMs: hs.StdDev.Seconds() * 1000,
+		P50Ms:    hs.P50.Seconds() * 1000,
+		P90Ms:    hs.P90.Seconds() * 1000,
+		P99Ms:    hs.P99.Seconds() * 1000,
+		P999Ms:   hs.P999.Seconds() * 1000,
+	}
+}
+
+// SetReplyStats adds reply anomaly counts to the report
+func (r *ProbeReportJSON) SetReplyStats(rs probe.ReplyStats) {
+	r.Replies = &ReplyStatsJSON{
+		Late:      rs.Late,
+		Duplicate: rs.Duplicate,
+		Reordered: rs.Reordered,
+		Unmatched: rs.Unmatched,
+	}
+}
+
+// SetDelayVariation adds IPDV and PDV distributions to the report
+func (r *ProbeReportJSON) SetDelayVariation(dv stats.DelayVariationStats) {
+	r.DelayVariation = &DelayVariationJSON{
+		IPDV: newHistogramStatsJSON(dv.IPDV),
+		PDV:  newHistogramStatsJSON(dv.PDV),
+	}
+}
+
+// SetSequenceStats adds loss, duplication and reordering metrics to the report
+func (r *ProbeReportJSON) SetSequenceStats(ss stats.SequenceStats) {
+	r.Sequence = &SequenceStatsJSON{
+		Sent:              ss.Sent,
+		Received:          ss.Received,
+		Lost:              ss.Lost,
+		LossRate:          ss.LossRate,
+		Duplicates:        ss.Duplicates,
+		Reordered:         ss.Reordered,
+		ReorderedRatio:    ss.ReorderedRatio,
+		MaxExtent:         ss.MaxExtent,
+		MeanExtent:        ss.MeanExtent,
+		MaxNReordering:    ss.MaxNReordering,
+		Discontinuities:   ss.Discontinuities,
+		DiscontinuitySize: ss.DiscontinuitySize,
+		LossPeriods:       ss.LossPeriods,
+		MaxLossPeriod:     ss.MaxLossPeriod,
+		MeanLossPeriod:    ss.MeanLossPeriod,
+		MeanLossDistance:  ss.MeanLossDistance,
+		MeanLossGap:       ss.MeanLossGap,
+	}
+}
+
+// SetLossModel adds the Gilbert-Elliott burst loss model to the report
+func (r *ProbeReportJSON) SetLossModel(ge stats.GilbertElliott) {
+	r.LossModel = &LossModelJSON{
+		P:               ge.P,
+		R:               ge.R,
+		BurstDensity:    ge.BurstDensity,
+		GapDensity:      ge.GapDensity,
+		Bursts:          ge.Bursts,
+		MeanBurstLength: ge.MeanBurstLength,
+		MeanGapLength:   ge.MeanGapLength,
+	}
+}
+
+// SetSpikes flags the probe results found to be RTT spikes and adds a
+// summary of the detection to the report
+func (r *ProbeReportJSON) SetSpikes(halfWindow int, threshold float64, spikes []detect.Spike) {
+	r.Spikes = &SpikesJSON{
+		HalfWindow: halfWindow,
+		Threshold:  threshold,
+		Count:      len(spikes),
+	}
+
+	bySequence := make(map[int]detect.Spike, len(spikes))
+	for _, s := range spikes {
+		bySequence[s.Sequence] = s
+		switch s.Severity {
+		case "Severe":
+			r.Spikes.Severe++
+		case "Major":
+			r.Spikes.Major++
+		default:
+			r.Spikes.Minor++
+		}
+	}
+	for i := range r.ProbeResults {
+		pr := &r.ProbeResults[i]
+		if s, ok := bySequence[pr.Sequence]; ok && pr.Success {
+			pr.Spike = s.Severity
+			pr.SpikeScore = s.Score
+		}
+	}
+}
+
+// AddVoiceScore adds the voice quality estimate for one codec to the report
+func (r *ProbeReportJSON) AddVoiceScore(vs stats.VoiceScore) {
+	r.VoiceQuality = append(r.VoiceQuality, VoiceScoreJSON{
+		Codec:         vs.Codec,
+		OneWayDelayMs: vs.OneWayDelay.Seconds() * 1000,
+		Ppl:           vs.Ppl,
+		BurstR:        vs.BurstR,
+		Id:            vs.Id,
+		IeEff:         vs.IeEff,
+		R:             vs.R,
+		MOS:           vs.MOS,
+		Rating:        vs.Rating,
+		Provisional:   vs.Provisional,
+	})
+}
+
+// SetOneWayDelays adds one-way delay statistics to the report
+func (r *ProbeReportJSON) SetOneWayDelays(offset time.Duration, forward, reverse, processing stats.HistogramStats) {
+	r.OneWay = &OneWayJSON{
+		ClockOffsetMs: offset.Seconds() * 1000,
+		Forward:       newHistogramStatsJSON(forward),
+		Reverse:       newHistogramStatsJSON(reverse),
+		Processing:    newHistogramStatsJSON(processing),
+	}
+}
+
+// Write writes the report as indented JSON
+func (r *ProbeReportJSON) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// ReadProbeReportJSON reads a probe report written by ProbeReportJSON.Write
+func ReadProbeReportJSON(r io.Reader) (*ProbeReportJSON, error) {
+	var report ProbeReportJSON
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode probe report: %w", err)
+	}
+	return &report, nil
+}
+
+// RTTs returns the round-trip times of the successful probes in the report
+func (r *ProbeReportJSON) RTTs() []time.Duration {
+	rtts := make([]time.Duration, 0, len(r.ProbeResults))
+	for _, pr := range r.ProbeResults {
+		if pr.Success {
+			rtts = append(rtts, time.Duration(math.Round(pr.RTTMs*float64(time.Millisecond))))
+		}
+	}
+	return rtts
+}
+
+// ComparisonJSON represents a comparison of two probe runs in JSON format
+type ComparisonJSON struct {
+	Timestamp        int64   `json:"timestamp"`
+	Old              string  `json:"old"`
+	New              string  `json:"new"`
+	CountOld         int     `json:"count_old"`
+	CountNew         int     `json:"count_new"`
+	MedianOldMs      float64 `json:"median_old_ms"`
+	MedianNewMs      float64 `json:"median_new_ms"`
+	P99OldMs         float64 `json:"p99_old_ms"`
+	P99NewMs         float64 `json:"p99_new_ms"`
+	MedianDiffMs     float64 `json:"median_diff_ms"`
+	MedianDiffLowMs  float64 `json:"median_diff_low_ms"`
+	MedianDiffHighMs float64 `json:"median_diff_high_ms"`
+	P99DiffMs        float64 `json:"p99_diff_ms"`
+	P99DiffLowMs     float64 `json:"p99_diff_low_ms"`
+	P99DiffHighMs    float64 `json:"p99_diff_high_ms"`
+	MannWhitneyU     float64 `json:"mann_whitney_u"`
+	MannWhitneyP     float64 `json:"mann_whitney_p"`
+	KSStatistic      float64 `json:"ks_statistic"`
+	KSP              float64 `json:"ks_p"`
+	EffectSize       float64 `json:"effect_size"`
+	EffectMagnitude  string  `json:"effect_magnitude"`
+	Verdict          string  `json:"verdict"`
+}
+
+// WriteComparisonJSON writes a comparison of an old and a new run as JSON
+func WriteComparisonJSON(w io.Writer, oldName, newName string, c stats.Comparison) error {
+	ms := func(d time.Duration) float64 {
+		return d.Seconds() * 1000
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(ComparisonJSON{
+		Timestamp:        time.Now().Unix(),
+		Old:              oldName,
+		New:              newName,
+		CountOld:         c.CountA,
+		CountNew:         c.CountB,
+		MedianOldMs:      ms(c.MedianA),
+		MedianNewMs:      ms(c.MedianB),
+		P99OldMs:         ms(c.P99A),
+		P99NewMs:         ms(c.P99B),
+		MedianDiffMs:     ms(c.MedianDiff),
+		MedianDiffLowMs:  ms(c.MedianDiffLow),
+		MedianDiffHighMs: ms(c.MedianDiffHigh),
+		P99DiffMs:        ms(c.P99Diff),
+		P99DiffLowMs:     ms(c.P99DiffLow),
+		P99DiffHighMs:    ms(c.P99DiffHigh),
+		MannWhitneyU:     c.MannWhitneyU,
+		MannWhitneyP:     c.MannWhitneyP,
+		KSStatistic:      c.KSStatistic,
+		KSP:              c.KSP,
+		EffectSize:       c.EffectSize,
+		EffectMagnitude:  c.EffectMagnitude,
+		Verdict:          c.Verdict,
+	})
+}
+
+// TraceHopJSON represents one hop of a path trace in JSON format
+type TraceHopJSON struct {
+	TTL         int                 `json:"ttl"`
+	Addr        string              `json:"addr,omitempty"`
+	Addrs       []string            `json:"addrs,omitempty"`
+	Sent        int                 `json:"sent"`
+	Received    int                 `json:"received"`
+	LossPercent float64             `json:"loss_percent"`
+	LastMs      float64             `json:"last_ms"`
+	Statistics  *HistogramStatsJSON `json:"statistics,omitempty"`
+}
+
+// TraceReportJSON represents a complete path trace
+type TraceReportJSON struct {
+	Timestamp int64          `json:"timestamp"`
+	Target    string         `json:"target"`
+	Method    string         `json:"method"`
+	Rounds    int            `json:"rounds"`
+	Hops      []TraceHopJSON `json:"hops"`
+}
+
+// WriteTraceJSON writes per-hop trace results as JSON
+func WriteTraceJSON(w io.Writer, target, method string, rounds int, hops []*probe.Hop) error {
+	report := TraceReportJSON{
+		Timestamp: time.Now().Unix(),
+		Target:    target,
+		Method:    method,
+		Rounds:    rounds,
+		Hops:      make([]TraceHopJSON, len(hops)),
+	}
+
+	for i, hop := range hops {
+		hj := TraceHopJSON{
+			TTL:         hop.TTL,
+			Sent:        hop.Sent,
+			Received:    hop.Received,
+			LossPercent: hop.Loss(),
+			LastMs:      hop.Last.Seconds() * 1000,
+		}
+		if hop.Addr != nil {
+			hj.Addr = hop.Addr.String()
+		}
+		for _, addr := range hop.Addrs {
+			hj.Addrs = append(hj.Addrs, addr.String())
+		}
+		if hop.Received > 0 {
+			hs := newHistogramStatsJSON(hop.Latency.GetStats())
+			hj.Statistics = &hs
+		}
+		report.Hops[i] = hj
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// MTUStepJSON represents one packet size tried during path MTU discovery
+type MTUStepJSON struct {
+	Size        int    `json:"size"`
+	Outcome     string `json:"outcome"`
+	ReportedMTU int    `json:"reported_mtu,omitempty"`
+	From        string `json:"from,omitempty"`
+}
+
+// MTUReportJSON represents the outcome of path MTU discovery
+type MTUReportJSON struct {
+	Timestamp   int64         `json:"timestamp"`
+	Target      string        `json:"target"`
+	Method      string        `json:"method"`
+	PathMTU     int           `json:"path_mtu"`
+	FragNeeded  bool          `json:"frag_needed"`
+	ReportedMTU int           `json:"reported_mtu,omitempty"`
+	BlackHole   bool          `json:"black_hole"`
+	Steps       []MTUStepJSON `json:"steps"`
+}
+
+// WriteMTUResultJSON writes path MTU discovery results as JSON
+func WriteMTUResultJSON(w io.Writer, target, method string, result *probe.MTUResult) error {
+	report := MTUReportJSON{
+		Timestamp:   time.Now().Unix(),
+		Target:      target,
+		Method:      method,
+		PathMTU:     result.PathMTU,
+		FragNeeded:  result.FragNeeded,
+		ReportedMTU: result.ReportedMTU,
+		BlackHole:   result.BlackHole,
+		Steps:       make([]MTUStepJSON, len(result.Steps)),
+	}
+
+	for i, step := range result.Steps {
+		sj := MTUStepJSON{
+			Size:        step.Size,
+			Outcome:     string(step.Outcome),
+			ReportedMTU: step.ReportedMTU,
+		}
+		if step.From != nil {
+			sj.From = step.From.String()
+		}
+		report.Steps[i] = sj
+	}
+
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 	return encoder.Encode(report)
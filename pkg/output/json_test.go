@@ -0,0 +1,57 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ErturkCan/netprobe/pkg/detect"
+	"github.com/ErturkCan/netprobe/pkg/probe"
+)
+
+func TestSetSpikes(t *testing.T) {
+	results := make([]probe.Result, 15)
+	for i := range results {
+		results[i] = probe.Result{Sequence: i + 1, Success: true, RTT: 20 * time.Millisecond}
+	}
+	results[4].RTT = 24 * time.Millisecond
+	results[9].RTT = 500 * time.Millisecond
+	results[12] = probe.Result{Sequence: 13, ErrorClass: probe.ErrorTimeout}
+
+	sd := detect.NewSpikeDetector(0, 0)
+	report := NewProbeReportJSON("udp", "example.com", results, nil, nil)
+	report.SetSpikes(sd.HalfWindow(), sd.Threshold(), sd.Detect(results))
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	var decoded struct {
+		ProbeResults []map[string]interface{} `json:"probe_results"`
+		Spikes       map[string]interface{}   `json:"spikes"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	want := map[float64]string{5: "Minor", 10: "Severe"}
+	for _, pr := range decoded.ProbeResults {
+		sequence := pr["sequence"].(float64)
+		spike, hasSpike := pr["spike"]
+		_, hasScore := pr["spike_score"]
+		if severity, ok := want[sequence]; ok {
+			if spike != severity || !hasScore {
+				t.Errorf("probe %v: spike %v, score present %v; want %s with a score", sequence, spike, hasScore, severity)
+			}
+		} else if hasSpike || hasScore {
+			t.Errorf("probe %v: unexpected spike fields %v", sequence, pr)
+		}
+	}
+
+	for field, value := range map[string]float64{"count": 2, "minor": 1, "major": 0, "severe": 1, "half_window": 7, "threshold": 3} {
+		if decoded.Spikes[field] != value {
+			t.Errorf("spikes.%s = %v, want %v", field, decoded.Spikes[field], value)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ErturkCan/netprobe/pkg/detect"
+	"github.com/ErturkCan/netprobe/pkg/probe"
 	"github.com/ErturkCan/netprobe/pkg/stats"
 )
 
@@ -20,17 +22,15 @@ func NewTableWriter(w io.Writer) *TableWriter {
 }
 
 // WriteProbeResults writes probe results in table format
-func (tw *TableWriter) WriteProbeResults(probeType, target string, rtts []time.Duration, failures int) error {
+func (tw *TableWriter) WriteProbeResults(probeType, target string, results []probe.Result) error {
+	rtts, failures := probe.SuccessfulRTTs(results)
+
 	fmt.Fprintf(tw.w, "=== %s Probe Results ===\n", strings.ToUpper(probeType))
 	fmt.Fprintf(tw.w, "Target: %s\n", target)
-	fmt.Fprintf(tw.w, "Probes sent: %d\n", len(rtts)+failures)
+	fmt.Fprintf(tw.w, "Probes sent: %d\n", len(results))
 	fmt.Fprintf(tw.w, "Successful: %d\n", len(rtts))
 	fmt.Fprintf(tw.w, "Failed: %d\n", failures)
 
-	if len(rtts) > 0 {
-		fmt.Fprintf(tw.w, "Loss rate: %.1f%%\n", float64(failures)/float64(len(rtts)+failures)*100)
-	}
-
 	fmt.Fprintln(tw.w)
 
 	// Write table header
@@ -38,8 +38,15 @@ func (tw *TableWriter) WriteProbeResults(probeType, target string, rtts []time.D
 	fmt.Fprintf(tw.w, "%-8s %-12s\n", strings.Repeat("-", 8), strings.Repeat("-", 12))
 
 	// Write individual results
-	for i, rtt := range rtts {
-		fmt.Fprintf(tw.w, "%-8d %-12.3f\n", i+1, rtt.Seconds()*1000)
+	for _, r := range results {
+		switch {
+		case r.Success && r.Reordered:
+			fmt.Fprintf(tw.w, "%-8d %-12.3f reordered\n", r.Sequence, r.RTT.Seconds()*1000)
+		case r.Success:
+			fmt.Fprintf(tw.w, "%-8d %-12.3f\n", r.Sequence, r.RTT.Seconds()*1000)
+		default:
+			fmt.Fprintf(tw.w, "%-8d %-12s\n", r.Sequence, string(r.ErrorClass))
+		}
 	}
 
 	fmt.Fprintln(tw.w)
@@ -47,8 +54,49 @@ func (tw *TableWriter) WriteProbeResults(probeType, target string, rtts []time.D
 	return nil
 }
 
+// WriteSocketMode writes which kind of socket a probe run used
+func (tw *TableWriter) WriteSocketMode(mode string) error {
+	fmt.Fprintf(tw.w, "Socket mode: %s\n\n", mode)
+	return nil
+}
+
+// WriteTimestampSource writes where probe send and receive times came from
+func (tw *TableWriter) WriteTimestampSource(source string) error {
+	fmt.Fprintf(tw.w, "Timestamp source: %s\n\n", source)
+	return nil
+}
+
+// WriteProbeResult writes a single probe result as a one-line progress entry
+func (tw *TableWriter) WriteProbeResult(r probe.Result) error {
+	if r.Success {
+		fmt.Fprintf(tw.w, "seq=%-6d bytes=%-6d rtt=%.3fms\n", r.Sequence, r.Bytes, r.RTT.Seconds()*1000)
+	} else {
+		fmt.Fprintf(tw.w, "seq=%-6d %s: %v\n", r.Sequence, r.ErrorClass, r.Error)
+	}
+	return nil
+}
+
 // WriteStatistics writes statistics in table format
 func (tw *TableWriter) WriteStatistics(stats stats.HistogramStats) error {
+	tw.writeSummary(stats)
+
+	fmt.Fprintln(tw.w, "=== Percentiles ===")
+
+	fmt.Fprintf(tw.w, "%-15s %-15s\n", "Percentile", "Latency")
+	fmt.Fprintf(tw.w, "%-15s %-15s\n", strings.Repeat("-", 15), strings.Repeat("-", 15))
+
+	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "p50", stats.P50.Seconds()*1000)
+	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "p90", stats.P90.Seconds()*1000)
+	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "p99", stats.P99.Seconds()*1000)
+	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "p99.9", stats.P999.Seconds()*1000)
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// writeSummary writes count, extremes, mean and standard deviation
+func (tw *TableWriter) writeSummary(stats stats.HistogramStats) {
 	fmt.Fprintln(tw.w, "=== Statistics ===")
 
 	// Write statistics table
@@ -62,15 +110,96 @@ func (tw *TableWriter) WriteStatistics(stats stats.HistogramStats) error {
 	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "StdDev", stats.StdDev.Seconds()*1000)
 
 	fmt.Fprintln(tw.w)
+}
+
+// WriteDistribution writes the statistics of any latency distribution in
+// table format, with confidence intervals for its percentiles
+func (tw *TableWriter) WriteDistribution(d stats.Distribution) error {
+	tw.writeSummary(d.GetStats())
+	return tw.WritePercentileIntervals(stats.PercentileIntervals(d, stats.DefaultConfidence))
+}
+
+// WritePercentileIntervals writes percentiles with their confidence
+// intervals, warning about those with too few samples to be bounded
+func (tw *TableWriter) WritePercentileIntervals(cis []stats.PercentileCI) error {
+	if len(cis) == 0 {
+		return nil
+	}
+
 	fmt.Fprintln(tw.w, "=== Percentiles ===")
 
-	fmt.Fprintf(tw.w, "%-15s %-15s\n", "Percentile", "Latency")
+	fmt.Fprintf(tw.w, "%-15s %-15s %-26s\n", "Percentile", "Latency", fmt.Sprintf("%g%% CI", cis[0].Confidence))
+	fmt.Fprintf(tw.w, "%-15s %-15s %-26s\n", strings.Repeat("-", 15), strings.Repeat("-", 15), strings.Repeat("-", 26))
+
+	var unbounded []stats.PercentileCI
+	for _, ci := range cis {
+		interval := fmt.Sprintf("[%.3fms, %.3fms]", ci.Lower.Seconds()*1000, ci.Upper.Seconds()*1000)
+		if !ci.Bounded {
+			interval += " *"
+			unbounded = append(unbounded, ci)
+		}
+		fmt.Fprintf(tw.w, "%-15s %-15s %s\n", fmt.Sprintf("p%g", ci.Percentile),
+			fmt.Sprintf("%.3fms", ci.Value.Seconds()*1000), interval)
+	}
+
+	if len(unbounded) > 0 {
+		fmt.Fprintln(tw.w)
+		fmt.Fprintln(tw.w, "* Too few samples: the interval extends past the observed range and is cut at min/max")
+		for _, ci := range unbounded {
+			fmt.Fprintf(tw.w, "Warning: p%g needs at least %d samples for a bounded %g%% interval\n",
+				ci.Percentile, ci.MinSamples, ci.Confidence)
+		}
+	}
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WritePhaseStatistics writes latency statistics for one probe phase
+func (tw *TableWriter) WritePhaseStatistics(phase probe.Phase, stats stats.HistogramStats) error {
+	fmt.Fprintf(tw.w, "=== Phase: %s ===\n", phase.Title())
+
+	fmt.Fprintf(tw.w, "%-15s %-15s\n", "Metric", "Latency")
 	fmt.Fprintf(tw.w, "%-15s %-15s\n", strings.Repeat("-", 15), strings.Repeat("-", 15))
 
+	fmt.Fprintf(tw.w, "%-15s %-15d\n", "Count", stats.Count)
+	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "Min", stats.Min.Seconds()*1000)
+	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "Mean", stats.Mean.Seconds()*1000)
 	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "p50", stats.P50.Seconds()*1000)
 	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "p90", stats.P90.Seconds()*1000)
 	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "p99", stats.P99.Seconds()*1000)
-	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "p99.9", stats.P999.Seconds()*1000)
+	fmt.Fprintf(tw.w, "%-15s %-15.3fms\n", "Max", stats.Max.Seconds()*1000)
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WriteOneWayDelays writes forward delay, reverse delay and reflector
+// processing time side by side
+func (tw *TableWriter) WriteOneWayDelays(offset time.Duration, forward, reverse, processing stats.HistogramStats) error {
+	fmt.Fprintln(tw.w, "=== One-Way Delay ===")
+	fmt.Fprintf(tw.w, "Clock offset (reflector - sender): %.3fms\n", offset.Seconds()*1000)
+	fmt.Fprintln(tw.w)
+
+	fmt.Fprintf(tw.w, "%-15s %-15s %-15s %-15s\n", "Metric", "Forward", "Reverse", "Processing")
+	fmt.Fprintf(tw.w, "%-15s %-15s %-15s %-15s\n",
+		strings.Repeat("-", 15), strings.Repeat("-", 15), strings.Repeat("-", 15), strings.Repeat("-", 15))
+
+	fmt.Fprintf(tw.w, "%-15s %-15d %-15d %-15d\n", "Count", forward.Count, reverse.Count, processing.Count)
+	row := func(name string, pick func(stats.HistogramStats) time.Duration) {
+		fmt.Fprintf(tw.w, "%-15s %-15s %-15s %-15s\n", name,
+			fmt.Sprintf("%.3fms", pick(forward).Seconds()*1000),
+			fmt.Sprintf("%.3fms", pick(reverse).Seconds()*1000),
+			fmt.Sprintf("%.3fms", pick(processing).Seconds()*1000))
+	}
+	row("Min", func(hs stats.HistogramStats) time.Duration { return hs.Min })
+	row("Mean", func(hs stats.HistogramStats) time.Duration { return hs.Mean })
+	row("p50", func(hs stats.HistogramStats) time.Duration { return hs.P50 })
+	row("p90", func(hs stats.HistogramStats) time.Duration { return hs.P90 })
+	row("p99", func(hs stats.HistogramStats) time.Duration { return hs.P99 })
+	row("Max", func(hs stats.HistogramStats) time.Duration { return hs.Max })
 
 	fmt.Fprintln(tw.w)
 
@@ -93,6 +222,312 @@ func (tw *TableWriter) WriteJitterStats(js stats.JitterStats) error {
 	return nil
 }
 
+// WriteDelayVariation writes the RFC 3393 IPDV and RFC 5481 PDV
+// distributions side by side
+func (tw *TableWriter) WriteDelayVariation(dv stats.DelayVariationStats) error {
+	fmt.Fprintln(tw.w, "=== Delay Variation ===")
+
+	fmt.Fprintf(tw.w, "%-15s %-15s %-15s\n", "Metric", "IPDV (RFC3393)", "PDV (RFC5481)")
+	fmt.Fprintf(tw.w, "%-15s %-15s %-15s\n", strings.Repeat("-", 15), strings.Repeat("-", 15), strings.Repeat("-", 15))
+
+	fmt.Fprintf(tw.w, "%-15s %-15d %-15d\n", "Count", dv.IPDV.Count, dv.PDV.Count)
+	row := func(name string, pick func(stats.HistogramStats) time.Duration) {
+		fmt.Fprintf(tw.w, "%-15s %-15s %-15s\n", name,
+			fmt.Sprintf("%.3fms", pick(dv.IPDV).Seconds()*1000),
+			fmt.Sprintf("%.3fms", pick(dv.PDV).Seconds()*1000))
+	}
+	row("Min", func(hs stats.HistogramStats) time.Duration { return hs.Min })
+	row("Mean", func(hs stats.HistogramStats) time.Duration { return hs.Mean })
+	row("p50", func(hs stats.HistogramStats) time.Duration { return hs.P50 })
+	row("p90", func(hs stats.HistogramStats) time.Duration { return hs.P90 })
+	row("p99", func(hs stats.HistogramStats) time.Duration { return hs.P99 })
+	row("p99.9", func(hs stats.HistogramStats) time.Duration { return hs.P999 })
+	row("Max", func(hs stats.HistogramStats) time.Duration { return hs.Max })
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WriteSequenceStats writes loss, duplication and reordering metrics in
+// table format
+func (tw *TableWriter) WriteSequenceStats(ss stats.SequenceStats) error {
+	fmt.Fprintln(tw.w, "=== Loss and Reordering ===")
+
+	fmt.Fprintf(tw.w, "%-22s %-15s\n", "Metric", "Value")
+	fmt.Fprintf(tw.w, "%-22s %-15s\n", strings.Repeat("-", 22), strings.Repeat("-", 15))
+
+	fmt.Fprintf(tw.w, "%-22s %-15d\n", "Sent", ss.Sent)
+	fmt.Fprintf(tw.w, "%-22s %-15d\n", "Received", ss.Received)
+	fmt.Fprintf(tw.w, "%-22s %d (%.1f%%)\n", "Lost", ss.Lost, ss.LossRate)
+	fmt.Fprintf(tw.w, "%-22s %-15d\n", "Duplicates", ss.Duplicates)
+	fmt.Fprintf(tw.w, "%-22s %d (%.1f%%)\n", "Reordered (RFC4737)", ss.Reordered, ss.ReorderedRatio)
+	fmt.Fprintf(tw.w, "%-22s %-15d\n", "Max reorder extent", ss.MaxExtent)
+	fmt.Fprintf(tw.w, "%-22s %-15.2f\n", "Mean reorder extent", ss.MeanExtent)
+	fmt.Fprintf(tw.w, "%-22s %-15d\n", "Max n-reordering", ss.MaxNReordering)
+	fmt.Fprintf(tw.w, "%-22s %d (%d skipped)\n", "Discontinuities", ss.Discontinuities, ss.DiscontinuitySize)
+	fmt.Fprintf(tw.w, "%-22s %-15d\n", "Loss periods (RFC3357)", ss.LossPeriods)
+	fmt.Fprintf(tw.w, "%-22s %-15d\n", "Max loss period", ss.MaxLossPeriod)
+	fmt.Fprintf(tw.w, "%-22s %-15.2f\n", "Mean loss period", ss.MeanLossPeriod)
+	fmt.Fprintf(tw.w, "%-22s %-15.2f\n", "Mean loss distance", ss.MeanLossDistance)
+	fmt.Fprintf(tw.w, "%-22s %-15.2f\n", "Mean loss gap", ss.MeanLossGap)
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WriteLossModel writes the Gilbert-Elliott burst loss model in table format
+func (tw *TableWriter) WriteLossModel(ge stats.GilbertElliott) error {
+	fmt.Fprintln(tw.w, "=== Burst Loss Model (Gilbert-Elliott) ===")
+
+	fmt.Fprintf(tw.w, "%-22s %-15s\n", "Metric", "Value")
+	fmt.Fprintf(tw.w, "%-22s %-15s\n", strings.Repeat("-", 22), strings.Repeat("-", 15))
+
+	fmt.Fprintf(tw.w, "%-22s %-15.4f\n", "p (gap to burst)", ge.P)
+	fmt.Fprintf(tw.w, "%-22s %-15.4f\n", "r (burst to gap)", ge.R)
+	fmt.Fprintf(tw.w, "%-22s %.1f%%\n", "Burst density", ge.BurstDensity)
+	fmt.Fprintf(tw.w, "%-22s %.1f%%\n", "Gap density", ge.GapDensity)
+	fmt.Fprintf(tw.w, "%-22s %-15d\n", "Bursts", ge.Bursts)
+	fmt.Fprintf(tw.w, "%-22s %-15.2f\n", "Mean burst length", ge.MeanBurstLength)
+	fmt.Fprintf(tw.w, "%-22s %-15.2f\n", "Mean gap length", ge.MeanGapLength)
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WriteSpikes writes the probes whose RTT stood out from those around them
+func (tw *TableWriter) WriteSpikes(halfWindow int, threshold float64, spikes []detect.Spike) error {
+	fmt.Fprintln(tw.w, "=== Latency Spikes (Hampel filter) ===")
+	fmt.Fprintf(tw.w, "Window: %d probes, threshold: %.1f x scaled MAD\n", 2*halfWindow+1, threshold)
+	if len(spikes) == 0 {
+		fmt.Fprintln(tw.w, "No spikes detected")
+		fmt.Fprintln(tw.w)
+		return nil
+	}
+	fmt.Fprintln(tw.w)
+
+	fmt.Fprintf(tw.w, "%-8s %-12s %-12s %-10s %-10s\n", "Seq", "RTT", "Baseline", "Score", "Severity")
+	fmt.Fprintf(tw.w, "%-8s %-12s %-12s %-10s %-10s\n",
+		strings.Repeat("-", 8), strings.Repeat("-", 12), strings.Repeat("-", 12), strings.Repeat("-", 10), strings.Repeat("-", 10))
+	for _, s := range spikes {
+		fmt.Fprintf(tw.w, "%-8d %-12s %-12s %-10.1f %-10s\n", s.Sequence,
+			fmt.Sprintf("%.3fms", s.RTT.Seconds()*1000),
+			fmt.Sprintf("%.3fms", s.Baseline.Seconds()*1000),
+			s.Score, s.Severity)
+	}
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WriteVoiceQuality writes E-model voice quality estimates, one column per
+// codec
+func (tw *TableWriter) WriteVoiceQuality(scores []stats.VoiceScore) error {
+	fmt.Fprintln(tw.w, "=== Voice Quality (ITU-T G.107 E-model) ===")
+	if len(scores) == 0 {
+		fmt.Fprintln(tw.w)
+		return nil
+	}
+	fmt.Fprintf(tw.w, "Packet loss: %.1f%%, burst ratio: %.2f\n", scores[0].Ppl, scores[0].BurstR)
+	fmt.Fprintln(tw.w)
+
+	row := func(name string, value func(stats.VoiceScore) string) {
+		fmt.Fprintf(tw.w, "%-20s", name)
+		for _, vs := range scores {
+			fmt.Fprintf(tw.w, " %-15s", value(vs))
+		}
+		fmt.Fprintln(tw.w)
+	}
+	provisional := false
+	row("Metric", func(vs stats.VoiceScore) string {
+		if vs.Provisional {
+			provisional = true
+			return vs.Codec + "*"
+		}
+		return vs.Codec
+	})
+	row(strings.Repeat("-", 20), func(stats.VoiceScore) string { return strings.Repeat("-", 15) })
+	row("Mouth-to-ear delay", func(vs stats.VoiceScore) string {
+		return fmt.Sprintf("%.1fms", vs.OneWayDelay.Seconds()*1000)
+	})
+	row("Delay impairment", func(vs stats.VoiceScore) string { return fmt.Sprintf("%.1f", vs.Id) })
+	row("Loss impairment", func(vs stats.VoiceScore) string { return fmt.Sprintf("%.1f", vs.IeEff) })
+	row("R-factor", func(vs stats.VoiceScore) string { return fmt.Sprintf("%.1f", vs.R) })
+	row("MOS", func(vs stats.VoiceScore) string { return fmt.Sprintf("%.2f", vs.MOS) })
+	for _, vs := range scores {
+		fmt.Fprintf(tw.w, "%-20s %s\n", vs.Codec+" rating", vs.Rating)
+	}
+	if provisional {
+		fmt.Fprintln(tw.w, "* Provisional codec profile: Ie and Bpl are estimates, not ITU-T G.113 values")
+	}
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WriteTimeSeries writes per-interval latency, loss and jitter, with the
+// p99, loss and jitter over the rolling window ending at each interval
+func (tw *TableWriter) WriteTimeSeries(interval time.Duration, rolling int, series []stats.WindowStats) error {
+	fmt.Fprintf(tw.w, "=== Time Series (%v intervals, rolling %v) ===\n", interval, interval*time.Duration(rolling))
+
+	fmt.Fprintf(tw.w, "%-10s %-6s %-8s %-10s %-10s %-10s %-10s %-10s %-12s %-12s %-14s\n",
+		"Offset", "Sent", "Loss", "p50", "p90", "p99", "Max", "Jitter", "Rolling p99", "Rolling loss", "Rolling jitter")
+	fmt.Fprintf(tw.w, "%-10s %-6s %-8s %-10s %-10s %-10s %-10s %-10s %-12s %-12s %-14s\n",
+		strings.Repeat("-", 10), strings.Repeat("-", 6), strings.Repeat("-", 8),
+		strings.Repeat("-", 10), strings.Repeat("-", 10), strings.Repeat("-", 10),
+		strings.Repeat("-", 10), strings.Repeat("-", 10), strings.Repeat("-", 12), strings.Repeat("-", 12),
+		strings.Repeat("-", 14))
+
+	ms := func(d time.Duration) string {
+		return fmt.Sprintf("%.3fms", d.Seconds()*1000)
+	}
+	for _, ws := range series {
+		offset := ws.Start.Sub(series[0].Start)
+		fmt.Fprintf(tw.w, "%-10s %-6d %-8s %-10s %-10s %-10s %-10s %-10s %-12s %-12s %-14s\n",
+			"+"+offset.String(), ws.Sent, fmt.Sprintf("%.1f%%", ws.LossRate),
+			ms(ws.Latency.P50), ms(ws.Latency.P90), ms(ws.Latency.P99), ms(ws.Latency.Max), ms(ws.Jitter),
+			ms(ws.RollingLatency.P99), fmt.Sprintf("%.1f%%", ws.RollingLossRate), ms(ws.RollingJitter))
+	}
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WriteComparison writes a comparison of an old and a new run in table
+// format
+func (tw *TableWriter) WriteComparison(oldName, newName string, c stats.Comparison) error {
+	fmt.Fprintln(tw.w, "=== Run Comparison ===")
+	fmt.Fprintf(tw.w, "Old: %s (%d samples)\n", oldName, c.CountA)
+	fmt.Fprintf(tw.w, "New: %s (%d samples)\n", newName, c.CountB)
+	fmt.Fprintln(tw.w)
+
+	ms := func(d time.Duration) string {
+		return fmt.Sprintf("%.3fms", d.Seconds()*1000)
+	}
+	diff := func(d time.Duration) string {
+		return fmt.Sprintf("%+.3fms", d.Seconds()*1000)
+	}
+
+	fmt.Fprintf(tw.w, "%-10s %-12s %-12s %-12s %-26s\n", "Metric", "Old", "New", "Change", "95% CI (bootstrap)")
+	fmt.Fprintf(tw.w, "%-10s %-12s %-12s %-12s %-26s\n",
+		strings.Repeat("-", 10), strings.Repeat("-", 12), strings.Repeat("-", 12), strings.Repeat("-", 12), strings.Repeat("-", 26))
+	fmt.Fprintf(tw.w, "%-10s %-12s %-12s %-12s [%s, %s]\n", "Median",
+		ms(c.MedianA), ms(c.MedianB), diff(c.MedianDiff), diff(c.MedianDiffLow), diff(c.MedianDiffHigh))
+	fmt.Fprintf(tw.w, "%-10s %-12s %-12s %-12s [%s, %s]\n", "p99",
+		ms(c.P99A), ms(c.P99B), diff(c.P99Diff), diff(c.P99DiffLow), diff(c.P99DiffHigh))
+	fmt.Fprintln(tw.w)
+
+	fmt.Fprintf(tw.w, "%-20s %-15s %-15s\n", "Test", "Statistic", "p-value")
+	fmt.Fprintf(tw.w, "%-20s %-15s %-15s\n", strings.Repeat("-", 20), strings.Repeat("-", 15), strings.Repeat("-", 15))
+	fmt.Fprintf(tw.w, "%-20s %-15.1f %-15.4f\n", "Mann-Whitney U", c.MannWhitneyU, c.MannWhitneyP)
+	fmt.Fprintf(tw.w, "%-20s %-15.4f %-15.4f\n", "Kolmogorov-Smirnov", c.KSStatistic, c.KSP)
+	fmt.Fprintln(tw.w)
+
+	fmt.Fprintf(tw.w, "Effect size (Cliff's delta): %+.3f (%s)\n", c.EffectSize, c.EffectMagnitude)
+	fmt.Fprintf(tw.w, "Verdict: %s\n", c.Verdict)
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WriteReplyStats writes reply anomaly counts in table format
+func (tw *TableWriter) WriteReplyStats(rs probe.ReplyStats) error {
+	fmt.Fprintln(tw.w, "=== Reply Matching ===")
+
+	fmt.Fprintf(tw.w, "%-20s %-15s\n", "Metric", "Count")
+	fmt.Fprintf(tw.w, "%-20s %-15s\n", strings.Repeat("-", 20), strings.Repeat("-", 15))
+
+	fmt.Fprintf(tw.w, "%-20s %-15d\n", "Late replies", rs.Late)
+	fmt.Fprintf(tw.w, "%-20s %-15d\n", "Duplicate replies", rs.Duplicate)
+	fmt.Fprintf(tw.w, "%-20s %-15d\n", "Reordered replies", rs.Reordered)
+	fmt.Fprintf(tw.w, "%-20s %-15d\n", "Unmatched replies", rs.Unmatched)
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WriteTraceHops writes per-hop latency and loss of a path trace, one row
+// per TTL in the style of mtr
+func (tw *TableWriter) WriteTraceHops(target string, rounds int, hops []*probe.Hop) error {
+	fmt.Fprintln(tw.w, "=== Trace Results ===")
+	fmt.Fprintf(tw.w, "Target: %s\n", target)
+	fmt.Fprintf(tw.w, "Rounds: %d\n", rounds)
+	fmt.Fprintln(tw.w)
+
+	fmt.Fprintf(tw.w, "%-4s %-40s %7s %5s %9s %9s %9s %9s %9s\n",
+		"Hop", "Host", "Loss%", "Sent", "Last", "Avg", "Best", "Worst", "StDev")
+	fmt.Fprintf(tw.w, "%-4s %-40s %7s %5s %9s %9s %9s %9s %9s\n",
+		strings.Repeat("-", 4), strings.Repeat("-", 40), strings.Repeat("-", 7), strings.Repeat("-", 5),
+		strings.Repeat("-", 9), strings.Repeat("-", 9), strings.Repeat("-", 9), strings.Repeat("-", 9), strings.Repeat("-", 9))
+
+	ms := func(d time.Duration) float64 { return d.Seconds() * 1000 }
+	for _, hop := range hops {
+		if hop.Received == 0 {
+			fmt.Fprintf(tw.w, "%-4d %-40s %6.1f%% %5d\n", hop.TTL, "???", hop.Loss(), hop.Sent)
+			continue
+		}
+		hs := hop.Latency.GetStats()
+		fmt.Fprintf(tw.w, "%-4d %-40s %6.1f%% %5d %9.3f %9.3f %9.3f %9.3f %9.3f\n",
+			hop.TTL, hop.Addr, hop.Loss(), hop.Sent,
+			ms(hop.Last), ms(hs.Mean), ms(hs.Min), ms(hs.Max), ms(hs.StdDev))
+
+		// Further responders seen at the same TTL
+		for _, addr := range hop.Addrs {
+			if !addr.Equal(hop.Addr) {
+				fmt.Fprintf(tw.w, "%-4s %-40s\n", "", addr)
+			}
+		}
+	}
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
+// WriteMTUResult writes the outcome of path MTU discovery and the sizes
+// that were tried
+func (tw *TableWriter) WriteMTUResult(target string, result *probe.MTUResult) error {
+	fmt.Fprintln(tw.w, "=== Path MTU Discovery ===")
+	fmt.Fprintf(tw.w, "Target: %s\n", target)
+	fmt.Fprintln(tw.w)
+
+	fmt.Fprintf(tw.w, "%-8s %-15s %-15s\n", "Size", "Outcome", "Reported MTU")
+	fmt.Fprintf(tw.w, "%-8s %-15s %-15s\n", strings.Repeat("-", 8), strings.Repeat("-", 15), strings.Repeat("-", 15))
+	for _, step := range result.Steps {
+		if step.ReportedMTU > 0 {
+			fmt.Fprintf(tw.w, "%-8d %-15s %-15d\n", step.Size, step.Outcome, step.ReportedMTU)
+		} else {
+			fmt.Fprintf(tw.w, "%-8d %-15s %-15s\n", step.Size, step.Outcome, "-")
+		}
+	}
+	fmt.Fprintln(tw.w)
+
+	fmt.Fprintf(tw.w, "%-20s %-15s\n", "Metric", "Value")
+	fmt.Fprintf(tw.w, "%-20s %-15s\n", strings.Repeat("-", 20), strings.Repeat("-", 15))
+	fmt.Fprintf(tw.w, "%-20s %-15d\n", "Path MTU", result.PathMTU)
+	fmt.Fprintf(tw.w, "%-20s %-15v\n", "Frag needed seen", result.FragNeeded)
+	if result.ReportedMTU > 0 {
+		fmt.Fprintf(tw.w, "%-20s %-15d\n", "Reported MTU", result.ReportedMTU)
+	}
+	fmt.Fprintf(tw.w, "%-20s %-15v\n", "Black hole", result.BlackHole)
+
+	if result.BlackHole {
+		fmt.Fprintln(tw.w)
+		fmt.Fprintf(tw.w, "Packets above %d bytes are dropped without an ICMP error; PMTUD will fail on this path.\n", result.PathMTU)
+	}
+
+	fmt.Fprintln(tw.w)
+
+	return nil
+}
+
 // WriteBufferbloatResults writes bufferbloat detection results in table format
 func (tw *TableWriter) WriteBufferbloatResults(target string, result interface{}) error {
 	fmt.Fprintln(tw.w, "=== Bufferbloat Detection Results ===")
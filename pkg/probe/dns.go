@@ -0,0 +1,279 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSProbeConfig holds configuration for DNS query probes
+type DNSProbeConfig struct {
+	Server    string          // Resolver host or IP
+	Port      int             // Resolver port
+	Name      string          // Name to query
+	Type      dnsmessage.Type // Query type (default A)
+	Network   string          // Transport: "udp" or "tcp"
+	Count     int             // Number of queries to send
+	Interval  time.Duration   // Time between queries
+	Timeout   time.Duration   // Timeout for each response
+	IPVersion int             // IP version to use: 4, 6 or 0 for either
+}
+
+// DNSProber measures resolver response time by sending DNS queries directly
+// to a resolver. Each query uses a fresh socket and a random ID. Over TCP
+// the connection setup is not included in the RTT.
+type DNSProber struct {
+	config DNSProbeConfig
+}
+
+var _ Prober = (*DNSProber)(nil)
+
+// NewDNSProber creates a new DNS prober
+func NewDNSProber(config DNSProbeConfig) *DNSProber {
+	if config.Port == 0 {
+		config.Port = 53
+	}
+	if config.Type == 0 {
+		config.Type = dnsmessage.TypeA
+	}
+	if config.Network == "" {
+		config.Network = "udp"
+	}
+	if config.Count == 0 {
+		config.Count = 10
+	}
+	if config.Interval == 0 {
+		config.Interval = 1 * time.Second
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 3 * time.Second
+	}
+
+	return &DNSProber{config: config}
+}
+
+// ParseDNSType converts a query type name such as "AAAA" into a DNS type
+func ParseDNSType(name string) (dnsmessage.Type, error) {
+	types := map[string]dnsmessage.Type{
+		"A":     dnsmessage.TypeA,
+		"AAAA":  dnsmessage.TypeAAAA,
+		"CNAME": dnsmessage.TypeCNAME,
+		"MX":    dnsmessage.TypeMX,
+		"NS":    dnsmessage.TypeNS,
+		"PTR":   dnsmessage.TypePTR,
+		"SOA":   dnsmessage.TypeSOA,
+		"SRV":   dnsmessage.TypeSRV,
+		"TXT":   dnsmessage.TypeTXT,
+	}
+	t, ok := types[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported DNS query type: %s", name)
+	}
+	return t, nil
+}
+
+// Probe performs a series of DNS query probes
+func (p *DNSProber) Probe() ([]Result, error) {
+	return p.ProbeContext(context.Background())
+}
+
+// ProbeContext performs a series of DNS query probes until done or ctx is
+// cancelled, in which case the results gathered so far are returned with ctx.Err()
+func (p *DNSProber) ProbeContext(ctx context.Context) ([]Result, error) {
+	return collect(ctx, p.config.Count, p.ProbeStream)
+}
+
+// ProbeStream performs a series of DNS query probes, passing each result to
+// handler as soon as it completes
+func (p *DNSProber) ProbeStream(ctx context.Context, handler ResultHandler) error {
+	if p.config.Network != "udp" && p.config.Network != "tcp" {
+		return fmt.Errorf("unsupported DNS transport: %s", p.config.Network)
+	}
+
+	name, err := dnsmessage.NewName(fqdn(p.config.Name))
+	if err != nil {
+		return fmt.Errorf("invalid query name: %w", err)
+	}
+
+	// Resolve the resolver address once so it is not part of the RTT
+	network := ipNetwork(p.config.Network, p.config.IPVersion)
+	server := net.JoinHostPort(p.config.Server, strconv.Itoa(p.config.Port))
+	if p.config.Network == "udp" {
+		addr, err := net.ResolveUDPAddr(network, server)
+		if err != nil {
+			return fmt.Errorf("failed to resolve address: %w", err)
+		}
+		server = addr.String()
+	} else {
+		addr, err := net.ResolveTCPAddr(network, server)
+		if err != nil {
+			return fmt.Errorf("failed to resolve address: %w", err)
+		}
+		server = addr.String()
+	}
+
+	// Send probes
+	for i := 0; i < p.config.Count; i++ {
+		if i > 0 {
+			if err := sleepContext(ctx, p.config.Interval); err != nil {
+				return err
+			}
+		}
+
+		result := p.sendProbe(ctx, network, server, name, i+1)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		handler(result)
+	}
+
+	return nil
+}
+
+// sendProbe sends a single DNS query and classifies the response
+func (p *DNSProber) sendProbe(ctx context.Context, network, server string, name dnsmessage.Name, sequence int) Result {
+	result := Result{
+		Sequence: sequence,
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  p.config.Type,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		result.ErrorClass = ErrorSend
+		result.Error = fmt.Errorf("failed to pack query: %w", err)
+		return result
+	}
+
+	dialer := net.Dialer{Timeout: p.config.Timeout}
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		result.ErrorClass = classifyDialError(err)
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		return result
+	}
+	defer conn.Close()
+
+	// Unblock the exchange when the context is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	result.SendTime = time.Now()
+	conn.SetDeadline(result.SendTime.Add(p.config.Timeout))
+
+	var response dnsmessage.Message
+	var n int
+	if p.config.Network == "tcp" {
+		n, err = exchangeTCP(conn, packed, id, &response)
+	} else {
+		n, err = exchangeUDP(conn, packed, id, &response)
+	}
+	if err != nil {
+		result.ErrorClass = classifyError(err)
+		result.Error = fmt.Errorf("query failed: %w", err)
+		return result
+	}
+
+	result.RecvTime = time.Now()
+	result.RTT = result.RecvTime.Sub(result.SendTime)
+	result.Bytes = n
+
+	// Responses that arrived but report a problem keep their RTT but do
+	// not count as successful probes
+	switch {
+	case response.Header.Truncated:
+		result.ErrorClass = ErrorTruncated
+		result.Error = fmt.Errorf("response truncated")
+	case response.Header.RCode == dnsmessage.RCodeNameError:
+		result.ErrorClass = ErrorNXDomain
+		result.Error = fmt.Errorf("NXDOMAIN for %s", name)
+	case response.Header.RCode == dnsmessage.RCodeServerFailure:
+		result.ErrorClass = ErrorServFail
+		result.Error = fmt.Errorf("SERVFAIL for %s", name)
+	case response.Header.RCode == dnsmessage.RCodeRefused:
+		result.ErrorClass = ErrorRefused
+		result.Error = fmt.Errorf("query refused")
+	case response.Header.RCode != dnsmessage.RCodeSuccess:
+		result.ErrorClass = ErrorStatus
+		result.Error = fmt.Errorf("response code %v", response.Header.RCode)
+	default:
+		result.Success = true
+	}
+
+	return result
+}
+
+// exchangeUDP sends a query datagram and waits for the response carrying
+// the same ID, ignoring anything else
+func exchangeUDP(conn net.Conn, query []byte, id uint16, response *dnsmessage.Message) (int, error) {
+	if _, err := conn.Write(query); err != nil {
+		return 0, err
+	}
+
+	buffer := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return 0, err
+		}
+		if err := response.Unpack(buffer[:n]); err != nil || response.Header.ID != id || !response.Header.Response {
+			continue
+		}
+		return n, nil
+	}
+}
+
+// exchangeTCP sends a length-prefixed query over a stream connection and
+// reads length-prefixed messages until the response carrying the same ID,
+// skipping any others like exchangeUDP
+func exchangeTCP(conn net.Conn, query []byte, id uint16, response *dnsmessage.Message) (int, error) {
+	framed := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(framed[0:2], uint16(len(query)))
+	copy(framed[2:], query)
+	if _, err := conn.Write(framed); err != nil {
+		return 0, err
+	}
+
+	for {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return 0, err
+		}
+		buffer := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, buffer); err != nil {
+			return 0, err
+		}
+		if err := response.Unpack(buffer); err != nil {
+			return 0, fmt.Errorf("malformed response: %w", err)
+		}
+		if response.Header.ID != id || !response.Header.Response {
+			continue
+		}
+		return len(buffer), nil
+	}
+}
+
+// fqdn returns name in fully qualified form with a trailing dot
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
@@ -0,0 +1,216 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsResponder answers a query with the messages to send back, in order
+type dnsResponder func(query dnsmessage.Message) []dnsmessage.Message
+
+// startDNS runs an in-process DNS server on loopback over UDP or TCP until
+// the test ends and returns its port
+func startDNS(t *testing.T, network string, respond dnsResponder) int {
+	t.Helper()
+
+	answer := func(b []byte) [][]byte {
+		var query dnsmessage.Message
+		if err := query.Unpack(b); err != nil {
+			return nil
+		}
+		var packed [][]byte
+		for _, msg := range respond(query) {
+			p, err := msg.Pack()
+			if err != nil {
+				t.Errorf("packing response: %v", err)
+				return nil
+			}
+			packed = append(packed, p)
+		}
+		return packed
+	}
+
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("ListenPacket: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		go func() {
+			buffer := make([]byte, 65535)
+			for {
+				n, peer, err := conn.ReadFrom(buffer)
+				if err != nil {
+					if errors.Is(err, net.ErrClosed) {
+						return
+					}
+					continue
+				}
+				for _, p := range answer(buffer[:n]) {
+					conn.WriteTo(p, peer)
+				}
+			}
+		}()
+		return conn.LocalAddr().(*net.UDPAddr).Port
+	}
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				buffer := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, buffer); err != nil {
+					return
+				}
+				for _, p := range answer(buffer) {
+					framed := binary.BigEndian.AppendUint16(nil, uint16(len(p)))
+					conn.Write(append(framed, p...))
+				}
+				// Hold the connection open so a missing answer times out
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// reply builds a response to query with the given header changes
+func reply(query dnsmessage.Message, change func(h *dnsmessage.Header)) dnsmessage.Message {
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.Header.ID, Response: true, RecursionAvailable: true},
+		Questions: query.Questions,
+	}
+	if change != nil {
+		change(&msg.Header)
+	}
+	if msg.Header.RCode == dnsmessage.RCodeSuccess && !msg.Header.Truncated && msg.Header.ID == query.Header.ID {
+		msg.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		}}
+	}
+	return msg
+}
+
+func rcode(code dnsmessage.RCode) func(h *dnsmessage.Header) {
+	return func(h *dnsmessage.Header) { h.RCode = code }
+}
+
+func TestDNSProber(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond dnsResponder
+		class   ErrorClass
+	}{
+		{"success", func(q dnsmessage.Message) []dnsmessage.Message {
+			return []dnsmessage.Message{reply(q, nil)}
+		}, ErrorNone},
+		{"id mismatch skipped", func(q dnsmessage.Message) []dnsmessage.Message {
+			wrong := reply(q, func(h *dnsmessage.Header) { h.ID++ })
+			return []dnsmessage.Message{wrong, reply(q, nil)}
+		}, ErrorNone},
+		{"query echoed back skipped", func(q dnsmessage.Message) []dnsmessage.Message {
+			return []dnsmessage.Message{q, reply(q, nil)}
+		}, ErrorNone},
+		{"only id mismatch", func(q dnsmessage.Message) []dnsmessage.Message {
+			return []dnsmessage.Message{reply(q, func(h *dnsmessage.Header) { h.ID++ })}
+		}, ErrorTimeout},
+		{"nxdomain", func(q dnsmessage.Message) []dnsmessage.Message {
+			return []dnsmessage.Message{reply(q, rcode(dnsmessage.RCodeNameError))}
+		}, ErrorNXDomain},
+		{"servfail", func(q dnsmessage.Message) []dnsmessage.Message {
+			return []dnsmessage.Message{reply(q, rcode(dnsmessage.RCodeServerFailure))}
+		}, ErrorServFail},
+		{"refused", func(q dnsmessage.Message) []dnsmessage.Message {
+			return []dnsmessage.Message{reply(q, rcode(dnsmessage.RCodeRefused))}
+		}, ErrorRefused},
+		{"other rcode", func(q dnsmessage.Message) []dnsmessage.Message {
+			return []dnsmessage.Message{reply(q, rcode(dnsmessage.RCodeFormatError))}
+		}, ErrorStatus},
+		{"truncated", func(q dnsmessage.Message) []dnsmessage.Message {
+			return []dnsmessage.Message{reply(q, func(h *dnsmessage.Header) { h.Truncated = true })}
+		}, ErrorTruncated},
+		{"no answer", func(q dnsmessage.Message) []dnsmessage.Message {
+			return nil
+		}, ErrorTimeout},
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		for _, tt := range tests {
+			t.Run(network+"/"+tt.name, func(t *testing.T) {
+				port := startDNS(t, network, tt.respond)
+				prober := NewDNSProber(DNSProbeConfig{
+					Server:  "127.0.0.1",
+					Port:    port,
+					Name:    "example.com",
+					Network: network,
+					Count:   1,
+					Timeout: 200 * time.Millisecond,
+				})
+				results, err := prober.Probe()
+				if err != nil {
+					t.Fatalf("Probe: %v", err)
+				}
+				if len(results) != 1 {
+					t.Fatalf("got %d results, want 1", len(results))
+				}
+
+				r := results[0]
+				if r.ErrorClass != tt.class {
+					t.Fatalf("class %q, want %q (%v)", r.ErrorClass, tt.class, r.Error)
+				}
+				if r.Success != (tt.class == ErrorNone) {
+					t.Errorf("success %v", r.Success)
+				}
+				// Responses that arrived keep their RTT even when they
+				// report an error
+				if arrived := tt.class != ErrorTimeout; arrived != (r.RTT > 0) {
+					t.Errorf("RTT %v with class %q", r.RTT, r.ErrorClass)
+				}
+			})
+		}
+	}
+}
+
+func TestDNSProberQuery(t *testing.T) {
+	questions := make(chan dnsmessage.Question, 1)
+	port := startDNS(t, "udp", func(q dnsmessage.Message) []dnsmessage.Message {
+		questions <- q.Questions[0]
+		return []dnsmessage.Message{reply(q, nil)}
+	})
+
+	prober := NewDNSProber(DNSProbeConfig{
+		Server:  "127.0.0.1",
+		Port:    port,
+		Name:    "example.com",
+		Type:    dnsmessage.TypeAAAA,
+		Count:   1,
+		Timeout: time.Second,
+	})
+	if _, err := prober.Probe(); err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	got := <-questions
+	if got.Name.String() != "example.com." || got.Type != dnsmessage.TypeAAAA || got.Class != dnsmessage.ClassINET {
+		t.Fatalf("query %v, want example.com. AAAA IN", got)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package probe
+
+import "syscall"
+
+// dontFragment sets IP_PMTUDISC_DO on a socket so the kernel sets DF on
+// every packet and never fragments locally; oversized sends fail with
+// EMSGSIZE instead
+func dontFragment(fd uintptr, v6 bool) error {
+	if v6 {
+		return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_DO)
+	}
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package probe
+
+import "errors"
+
+// dontFragment is only implemented on Linux
+func dontFragment(fd uintptr, v6 bool) error {
+	return errors.New("don't fragment is not supported on this platform")
+}
@@ -0,0 +1,222 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// HTTPProbeConfig holds configuration for HTTP/HTTPS request probes
+type HTTPProbeConfig struct {
+	URL                string        // Request URL (http:// or https://)
+	Method             string        // Request method (default GET)
+	Count              int           // Number of requests to send
+	Interval           time.Duration // Time between requests
+	Timeout            time.Duration // Timeout for the whole request
+	IPVersion          int           // IP version to use: 4, 6 or 0 for either
+	KeepAlive          bool          // Reuse connections instead of dialing per request
+	InsecureSkipVerify bool          // Skip TLS certificate verification
+}
+
+// HTTPProber times repeated HTTP requests, breaking each one down into DNS,
+// connect, TLS handshake, time-to-first-byte and total phases. Unless
+// KeepAlive is set every request uses a fresh connection, so all phases
+// are measured each time.
+type HTTPProber struct {
+	config HTTPProbeConfig
+	client *http.Client
+}
+
+var _ Prober = (*HTTPProber)(nil)
+
+// NewHTTPProber creates a new HTTP prober
+func NewHTTPProber(config HTTPProbeConfig) *HTTPProber {
+	if config.Method == "" {
+		config.Method = http.MethodGet
+	}
+	if config.Count == 0 {
+		config.Count = 10
+	}
+	if config.Interval == 0 {
+		config.Interval = 1 * time.Second
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	network := ipNetwork("tcp", config.IPVersion)
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		DisableKeepAlives: !config.KeepAlive,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify},
+	}
+
+	return &HTTPProber{
+		config: config,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+			// Time the first response only; redirects are not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Probe performs a series of HTTP request probes
+func (p *HTTPProber) Probe() ([]Result, error) {
+	return p.ProbeContext(context.Background())
+}
+
+// ProbeContext performs a series of HTTP request probes until done or ctx is
+// cancelled, in which case the results gathered so far are returned with ctx.Err()
+func (p *HTTPProber) ProbeContext(ctx context.Context) ([]Result, error) {
+	return collect(ctx, p.config.Count, p.ProbeStream)
+}
+
+// ProbeStream performs a series of HTTP request probes, passing each result
+// to handler as soon as it completes
+func (p *HTTPProber) ProbeStream(ctx context.Context, handler ResultHandler) error {
+	// Validate the request once so configuration errors fail the run
+	if _, err := http.NewRequest(p.config.Method, p.config.URL, nil); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	defer p.client.CloseIdleConnections()
+
+	// Send probes
+	for i := 0; i < p.config.Count; i++ {
+		if i > 0 {
+			if err := sleepContext(ctx, p.config.Interval); err != nil {
+				return err
+			}
+		}
+
+		result := p.sendProbe(ctx, i+1)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		handler(result)
+	}
+
+	return nil
+}
+
+// sendProbe issues a single request and records its phase timings
+func (p *HTTPProber) sendProbe(ctx context.Context, sequence int) Result {
+	result := Result{
+		Sequence: sequence,
+	}
+
+	timer := &phaseTimer{}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, timer.trace()), p.config.Method, p.config.URL, nil)
+	if err != nil {
+		result.ErrorClass = ErrorSend
+		result.Error = fmt.Errorf("failed to build request: %w", err)
+		return result
+	}
+
+	timer.start = time.Now()
+	result.SendTime = timer.start
+	resp, err := p.client.Do(req)
+	if err != nil {
+		result.ErrorClass = classifyDialError(err)
+		result.Error = fmt.Errorf("request failed: %w", err)
+		result.Phases = timer.phases(time.Time{})
+		return result
+	}
+	defer resp.Body.Close()
+
+	n, err := io.Copy(io.Discard, resp.Body)
+	result.RecvTime = time.Now()
+	result.Bytes = int(n)
+	result.Phases = timer.phases(result.RecvTime)
+	if err != nil {
+		result.ErrorClass = classifyError(err)
+		result.Error = fmt.Errorf("reading body failed: %w", err)
+		return result
+	}
+	if resp.StatusCode >= 400 {
+		result.ErrorClass = ErrorStatus
+		result.Error = fmt.Errorf("HTTP status %s", resp.Status)
+		return result
+	}
+
+	result.RTT = result.RecvTime.Sub(result.SendTime)
+	result.Success = true
+
+	return result
+}
+
+// phaseTimer collects httptrace timestamps for a single request. Trace
+// hooks may run on different goroutines, e.g. when dialing several
+// addresses in parallel.
+type phaseTimer struct {
+	start time.Time
+
+	mu                  sync.Mutex
+	dnsStart, dnsDone   time.Time
+	connStart, connDone time.Time
+	tlsStart, tlsDone   time.Time
+	firstByte           time.Time
+}
+
+// trace returns the client trace hooks that feed the timer
+func (t *phaseTimer) trace() *httptrace.ClientTrace {
+	record := func(ts *time.Time, onlyFirst bool) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if onlyFirst && !ts.IsZero() {
+			return
+		}
+		*ts = time.Now()
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { record(&t.dnsStart, true) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { record(&t.dnsDone, false) },
+		ConnectStart: func(string, string) {
+			record(&t.connStart, true)
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				record(&t.connDone, true)
+			}
+		},
+		TLSHandshakeStart:    func() { record(&t.tlsStart, true) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { record(&t.tlsDone, false) },
+		GotFirstResponseByte: func() { record(&t.firstByte, true) },
+	}
+}
+
+// phases converts the recorded timestamps into phase durations. Phases
+// that did not happen, such as TLS on plain HTTP or connect on a reused
+// connection, are omitted.
+func (t *phaseTimer) phases(end time.Time) map[Phase]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	phases := make(map[Phase]time.Duration)
+	span := func(phase Phase, from, to time.Time) {
+		if !from.IsZero() && !to.IsZero() {
+			phases[phase] = to.Sub(from)
+		}
+	}
+
+	span(PhaseDNS, t.dnsStart, t.dnsDone)
+	span(PhaseConnect, t.connStart, t.connDone)
+	span(PhaseTLS, t.tlsStart, t.tlsDone)
+	span(PhaseTTFB, t.start, t.firstByte)
+	span(PhaseTotal, t.start, end)
+
+	return phases
+}
@@ -0,0 +1,152 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPProberPhases(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+
+	tests := []struct {
+		name   string
+		server *httptest.Server
+		want   []Phase
+	}{
+		// The URL holds an IP address, so no DNS phase is recorded
+		{"http", httptest.NewServer(handler), []Phase{PhaseConnect, PhaseTTFB, PhaseTotal}},
+		{"https", httptest.NewTLSServer(handler), []Phase{PhaseConnect, PhaseTLS, PhaseTTFB, PhaseTotal}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.server.Close()
+
+			prober := NewHTTPProber(HTTPProbeConfig{
+				URL:                tt.server.URL,
+				Count:              2,
+				Interval:           10 * time.Millisecond,
+				Timeout:            time.Second,
+				InsecureSkipVerify: true,
+			})
+			results, err := prober.Probe()
+			if err != nil {
+				t.Fatalf("Probe: %v", err)
+			}
+			if len(results) != 2 {
+				t.Fatalf("got %d results, want 2", len(results))
+			}
+
+			for _, r := range results {
+				if !r.Success {
+					t.Fatalf("probe %d failed: %v", r.Sequence, r.Error)
+				}
+				if r.Bytes != len("hello") {
+					t.Errorf("probe %d: %d bytes, want %d", r.Sequence, r.Bytes, len("hello"))
+				}
+				if len(r.Phases) != len(tt.want) {
+					t.Errorf("probe %d: phases %v, want %v", r.Sequence, r.Phases, tt.want)
+				}
+				for _, phase := range tt.want {
+					if d, ok := r.Phases[phase]; !ok || d <= 0 {
+						t.Errorf("probe %d: phase %s = %v, %v", r.Sequence, phase, d, ok)
+					}
+				}
+				if r.Phases[PhaseTTFB] > r.Phases[PhaseTotal] {
+					t.Errorf("probe %d: TTFB %v after total %v", r.Sequence, r.Phases[PhaseTTFB], r.Phases[PhaseTotal])
+				}
+				if r.RTT != r.Phases[PhaseTotal] {
+					t.Errorf("probe %d: RTT %v, want total %v", r.Sequence, r.RTT, r.Phases[PhaseTotal])
+				}
+			}
+
+			if got := RecordedPhases(results); len(got) != len(tt.want) {
+				t.Errorf("RecordedPhases = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPProberKeepAlive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	prober := NewHTTPProber(HTTPProbeConfig{
+		URL:       server.URL,
+		Count:     2,
+		Interval:  10 * time.Millisecond,
+		Timeout:   time.Second,
+		KeepAlive: true,
+	})
+	results, err := prober.Probe()
+	if err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+
+	// Only the first request dials
+	if _, ok := results[0].Phases[PhaseConnect]; !ok {
+		t.Errorf("first probe has no connect phase")
+	}
+	if _, ok := results[1].Phases[PhaseConnect]; ok {
+		t.Errorf("second probe on a reused connection has a connect phase")
+	}
+}
+
+func TestHTTPProberRedirectNotFollowed(t *testing.T) {
+	var followed atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/target", http.StatusFound)
+	})
+	mux.HandleFunc("/target", func(w http.ResponseWriter, r *http.Request) {
+		followed.Add(1)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	prober := NewHTTPProber(HTTPProbeConfig{
+		URL:     server.URL + "/start",
+		Count:   1,
+		Timeout: time.Second,
+	})
+	results, err := prober.Probe()
+	if err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	if n := followed.Load(); n != 0 {
+		t.Fatalf("redirect target requested %d times, want 0", n)
+	}
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("got %+v, want one successful result for the redirect itself", results)
+	}
+}
+
+func TestHTTPProberErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	prober := NewHTTPProber(HTTPProbeConfig{
+		URL:     server.URL,
+		Count:   1,
+		Timeout: time.Second,
+	})
+	results, err := prober.Probe()
+	if err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	r := results[0]
+	if r.Success || r.ErrorClass != ErrorStatus {
+		t.Fatalf("got success %v class %q, want %q", r.Success, r.ErrorClass, ErrorStatus)
+	}
+	// The response still arrived, so its phases are kept
+	if _, ok := r.Phases[PhaseTotal]; !ok {
+		t.Errorf("no total phase on an error status")
+	}
+}
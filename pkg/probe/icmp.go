@@ -1,37 +1,121 @@
 package probe
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"sync"
+	"syscall"
 	"time"
 
 	"golang.org/x/net/icmp"
 	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// IANA protocol numbers for ICMP over IPv4 and IPv6
+const (
+	protocolICMP   = 1
+	protocolICMPv6 = 58
+)
+
+// icmpFamily holds the address-family specific parts of ICMP echo probing
+type icmpFamily struct {
+	protocol     int       // IANA protocol number used to parse messages
+	network      string    // Raw socket network for icmp.ListenPacket
+	dgramNetwork string    // Datagram (ping socket) network for icmp.ListenPacket
+	listenAddr   string    // Wildcard address to listen on
+	echoRequest  icmp.Type // Echo request message type
+	echoReply    icmp.Type // Echo reply message type
+	unreachable  icmp.Type // Destination unreachable message type
+	timeExceeded icmp.Type // Time exceeded message type
+	packetTooBig icmp.Type // Packet too big message type (ICMPv6 only)
+}
+
+var (
+	icmpFamilyV4 = &icmpFamily{
+		protocol:     protocolICMP,
+		network:      "ip4:icmp",
+		dgramNetwork: "udp4",
+		listenAddr:   "0.0.0.0",
+		echoRequest:  ipv4.ICMPTypeEcho,
+		echoReply:    ipv4.ICMPTypeEchoReply,
+		unreachable:  ipv4.ICMPTypeDestinationUnreachable,
+		timeExceeded: ipv4.ICMPTypeTimeExceeded,
+	}
+	icmpFamilyV6 = &icmpFamily{
+		protocol:     protocolICMPv6,
+		network:      "ip6:ipv6-icmp",
+		dgramNetwork: "udp6",
+		listenAddr:   "::",
+		echoRequest:  ipv6.ICMPTypeEchoRequest,
+		echoReply:    ipv6.ICMPTypeEchoReply,
+		unreachable:  ipv6.ICMPTypeDestinationUnreachable,
+		timeExceeded: ipv6.ICMPTypeTimeExceeded,
+		packetTooBig: ipv6.ICMPTypePacketTooBig,
+	}
+)
+
+// familyFor selects the ICMP family matching a resolved address
+func familyFor(ip net.IP) *icmpFamily {
+	if ip.To4() != nil {
+		return icmpFamilyV4
+	}
+	return icmpFamilyV6
+}
+
+// ICMPMode selects the kind of socket used to send ICMP echo requests
+type ICMPMode string
+
+// ICMP socket modes
+const (
+	// ICMPModeAuto tries a raw socket and falls back to an unprivileged
+	// ping socket when the raw socket is not permitted
+	ICMPModeAuto ICMPMode = "auto"
+
+	// ICMPModeRaw uses a raw ICMP socket (root or CAP_NET_RAW)
+	ICMPModeRaw ICMPMode = "raw"
+
+	// ICMPModeUnprivileged uses a Linux datagram ICMP ("ping") socket,
+	// allowed for groups listed in net.ipv4.ping_group_range. ICMP errors
+	// are not delivered on these sockets, so failed probes time out.
+	ICMPModeUnprivileged ICMPMode = "unprivileged"
 )
 
 // ICMPProbeConfig holds configuration for ICMP probes
 type ICMPProbeConfig struct {
-	Target   string        // Target host or IP
-	Count    int           // Number of probes to send
-	Interval time.Duration // Time between probes
-	Timeout  time.Duration // Timeout for responses
-	PacketID int           // ICMP packet ID
-}
+	Target    string        // Target host or IP
+	Count     int           // Number of probes to send
+	Interval  time.Duration // Time between probes
+	Timeout   time.Duration // Timeout for responses
+	PacketID  int           // ICMP packet ID (raw sockets only)
+	IPVersion int           // IP version to use: 4, 6 or 0 for either
+	Mode      ICMPMode      // Socket mode (default: auto)
+	TTL       int           // IPv4 TTL or IPv6 hop limit of requests (0 for the system default)
 
-// ICMPProbeResult holds results from a single ICMP probe
-type ICMPProbeResult struct {
-	Sequence int
-	RTT      time.Duration
-	Success  bool
-	Error    error
+	PayloadSize      int  // Echo data size in bytes (default 8)
+	DontFragment     bool // Set DF and never fragment locally (Linux, raw sockets only)
+	KernelTimestamps bool // Take RTTs from kernel socket timestamps (Linux, raw sockets only)
 }
 
 // ICMPProber performs ICMP echo (ping) probes
 type ICMPProber struct {
 	config ICMPProbeConfig
+
+	mu         sync.Mutex      // Guards mode and timestamps
+	mode       ICMPMode        // Socket mode used by the last run
+	timestamps TimestampSource // Timestamp source used by the last run
 }
 
+var (
+	_ Prober             = (*ICMPProber)(nil)
+	_ SocketModeReporter = (*ICMPProber)(nil)
+	_ TimestampReporter  = (*ICMPProber)(nil)
+)
+
 // NewICMPProber creates a new ICMP prober
 func NewICMPProber(config ICMPProbeConfig) *ICMPProber {
 	if config.Count == 0 {
@@ -46,84 +130,492 @@ func NewICMPProber(config ICMPProbeConfig) *ICMPProber {
 	if config.PacketID == 0 {
 		config.PacketID = os.Getpid() & 0xffff
 	}
+	if config.Mode == "" {
+		config.Mode = ICMPModeAuto
+	}
+	if config.PayloadSize < len(icmpPayload) {
+		config.PayloadSize = len(icmpPayload)
+	}
 
 	return &ICMPProber{config: config}
 }
 
 // Probe performs a series of ICMP echo probes
-func (p *ICMPProber) Probe() ([]ICMPProbeResult, error) {
-	results := make([]ICMPProbeResult, 0, p.config.Count)
+func (p *ICMPProber) Probe() ([]Result, error) {
+	return p.ProbeContext(context.Background())
+}
+
+// ProbeContext performs a series of ICMP echo probes until done or ctx is
+// cancelled, in which case the results gathered so far are returned with ctx.Err()
+func (p *ICMPProber) ProbeContext(ctx context.Context) ([]Result, error) {
+	return collect(ctx, p.config.Count, p.ProbeStream)
+}
 
-	// Resolve target
-	addr, err := net.ResolveIPAddr("ip4", p.config.Target)
+// ProbeStream performs a series of ICMP echo probes, passing each result to
+// handler as soon as it completes
+func (p *ICMPProber) ProbeStream(ctx context.Context, handler ResultHandler) error {
+	// Resolve target; the address family follows from the result
+	addr, err := net.ResolveIPAddr(ipNetwork("ip", p.config.IPVersion), p.config.Target)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve address: %w", err)
+		return fmt.Errorf("failed to resolve address: %w", err)
 	}
+	family := familyFor(addr.IP)
 
 	// Create ICMP connection
-	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	session, err := p.open(family, addr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create ICMP listener: %w", err)
+		return err
 	}
-	defer conn.Close()
+	defer session.conn.Close()
+
+	p.mu.Lock()
+	p.mode = session.mode
+	p.timestamps = session.timestamps
+	p.mu.Unlock()
+
+	// Unblock any pending read when the context is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		session.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
 
 	// Send probes
 	for i := 0; i < p.config.Count; i++ {
 		if i > 0 {
-			time.Sleep(p.config.Interval)
+			if err := sleepContext(ctx, p.config.Interval); err != nil {
+				return err
+			}
+		}
+
+		result := p.sendProbe(ctx, session, i+1)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		handler(result)
+	}
+
+	return nil
+}
+
+// SocketMode returns the ICMP socket mode used by the most recent run
+func (p *ICMPProber) SocketMode() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return string(p.mode)
+}
+
+// TimestampSource returns the timestamp source used by the most recent run
+func (p *ICMPProber) TimestampSource() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return string(p.timestamps)
+}
+
+// icmpPayload starts the data of every echo request
+const icmpPayload = "netprobe"
+
+// icmpSession holds the socket and addressing state of a single run
+type icmpSession struct {
+	conn   net.PacketConn // *net.IPConn for raw sockets, *icmp.PacketConn for ping sockets
+	family *icmpFamily
+	mode   ICMPMode
+	dst    net.Addr // *net.IPAddr for raw sockets, *net.UDPAddr for ping sockets
+	dstIP  net.IP
+	echoID int // Echo ID expected in replies
+
+	// Kernel timestamping state; rawConn is only set on raw sockets with
+	// timestamps enabled, and sent counts requests for transmit timestamp keys
+	timestamps TimestampSource
+	rawConn    syscall.RawConn
+	sent       uint32
+}
+
+// open creates the ICMP socket for the configured mode and applies the
+// configured TTL
+func (p *ICMPProber) open(family *icmpFamily, addr *net.IPAddr) (*icmpSession, error) {
+	session, err := p.listen(family, addr)
+	if err != nil {
+		return nil, err
+	}
+	if p.config.TTL > 0 {
+		if err := session.setTTL(p.config.TTL); err != nil {
+			session.conn.Close()
+			return nil, fmt.Errorf("failed to set TTL: %w", err)
+		}
+	}
+
+	// Ping sockets do not expose their descriptor, so they always use
+	// userspace timestamps
+	session.timestamps = TimestampUserspace
+	if ipConn, ok := session.conn.(*net.IPConn); ok && p.config.KernelTimestamps {
+		if rc, err := ipConn.SyscallConn(); err == nil {
+			if source, err := enableTimestamps(rc); err == nil {
+				session.timestamps, session.rawConn = source, rc
+			}
+		}
+	}
+	return session, nil
+}
+
+// read reads the next ICMP message, returning its kernel receive time when
+// timestamps are enabled and the time it was read otherwise
+func (s *icmpSession) read(b, oob []byte) (int, net.Addr, time.Time, error) {
+	if s.rawConn == nil {
+		n, peer, err := s.conn.ReadFrom(b)
+		return n, peer, time.Now(), err
+	}
+
+	n, oobn, _, peer, err := s.conn.(*net.IPConn).ReadMsgIP(b, oob)
+	recvTime := time.Now()
+	if err != nil {
+		return 0, nil, recvTime, err
+	}
+	if ts, ok := rxTimestamp(oob[:oobn]); ok {
+		recvTime = ts
+	}
+	// Unlike ReadFrom, ReadMsgIP leaves the IPv4 header in place
+	if s.family.protocol == protocolICMP && n >= ipv4.HeaderLen && b[0]>>4 == 4 {
+		hdrLen := int(b[0]&0x0f) * 4
+		if hdrLen >= ipv4.HeaderLen && hdrLen <= n {
+			n = copy(b, b[hdrLen:n])
+		}
+	}
+	return n, peer, recvTime, nil
+}
+
+// sendTime returns the kernel transmit time of the request with the given
+// key, if the kernel reported one
+func (s *icmpSession) sendTime(key uint32) (time.Time, bool) {
+	if s.rawConn == nil || s.timestamps != TimestampKernel {
+		return time.Time{}, false
+	}
+	ts, ok := readTxTimestamps(s.rawConn)[key]
+	return ts, ok
+}
+
+// listen creates the ICMP socket for the configured mode. In auto mode a
+// raw socket is tried first and a ping socket is used if that is not
+// permitted.
+func (p *ICMPProber) listen(family *icmpFamily, addr *net.IPAddr) (*icmpSession, error) {
+	session := &icmpSession{
+		family: family,
+		dstIP:  addr.IP,
+		echoID: p.config.PacketID,
+	}
+
+	if p.config.Mode != ICMPModeUnprivileged {
+		conn, err := p.listenRaw(family)
+		switch {
+		case err == nil:
+			session.conn = conn
+			session.mode = ICMPModeRaw
+			session.dst = addr
+			return session, nil
+		case p.config.Mode == ICMPModeRaw || !errors.Is(err, os.ErrPermission):
+			return nil, fmt.Errorf("failed to create ICMP listener: %w", err)
+		}
+	}
+
+	// Ping sockets do not expose their descriptor, so DF cannot be set
+	if p.config.DontFragment {
+		return nil, fmt.Errorf("don't fragment requires a raw ICMP socket")
+	}
+
+	conn, err := icmp.ListenPacket(family.dgramNetwork, family.listenAddr)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("failed to create unprivileged ICMP socket (check net.ipv4.ping_group_range): %w", err)
 		}
+		return nil, fmt.Errorf("failed to create unprivileged ICMP socket: %w", err)
+	}
 
-		result := p.sendProbe(conn, addr, i+1)
-		results = append(results, result)
+	// The kernel replaces the echo ID with the socket's local port, both
+	// in the requests it sends and in the replies it delivers
+	session.conn = conn
+	session.mode = ICMPModeUnprivileged
+	session.dst = &net.UDPAddr{IP: addr.IP, Zone: addr.Zone}
+	if local, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		session.echoID = local.Port
 	}
+	return session, nil
+}
 
-	return results, nil
+// listenRaw opens a raw ICMP socket, setting DF before it is used if
+// configured
+func (p *ICMPProber) listenRaw(family *icmpFamily) (net.PacketConn, error) {
+	lc := net.ListenConfig{}
+	if p.config.DontFragment {
+		lc.Control = func(_, _ string, c syscall.RawConn) error {
+			return setDontFragment(c, family.protocol == protocolICMPv6)
+		}
+	}
+	return lc.ListenPacket(context.Background(), family.network, family.listenAddr)
+}
+
+// setTTL sets the TTL (IPv4) or hop limit (IPv6) of outgoing requests
+func (s *icmpSession) setTTL(ttl int) error {
+	if c, ok := s.conn.(*icmp.PacketConn); ok {
+		if s.family.protocol == protocolICMP {
+			return c.IPv4PacketConn().SetTTL(ttl)
+		}
+		return c.IPv6PacketConn().SetHopLimit(ttl)
+	}
+	if s.family.protocol == protocolICMP {
+		return ipv4.NewPacketConn(s.conn).SetTTL(ttl)
+	}
+	return ipv6.NewPacketConn(s.conn).SetHopLimit(ttl)
 }
 
 // sendProbe sends a single ICMP echo request and measures RTT
-func (p *ICMPProber) sendProbe(conn *icmp.PacketConn, addr *net.IPAddr, sequence int) ICMPProbeResult {
-	result := ICMPProbeResult{
+func (p *ICMPProber) sendProbe(ctx context.Context, session *icmpSession, sequence int) Result {
+	result := Result{
 		Sequence: sequence,
 	}
+	conn, family := session.conn, session.family
 
 	// Create ICMP echo request
 	msg := icmp.Message{
-		Type: ipv4.ICMPTypeEcho,
+		Type: family.echoRequest,
 		Code: 0,
 		Body: &icmp.Echo{
 			ID:   p.config.PacketID,
 			Seq:  sequence,
-			Data: []byte("netprobe"),
+			Data: p.payload(),
 		},
 	}
 
 	// Marshal message
 	msgBytes, err := msg.Marshal(nil)
 	if err != nil {
+		result.ErrorClass = ErrorSend
 		result.Error = fmt.Errorf("failed to marshal ICMP message: %w", err)
 		return result
 	}
 
 	// Send request
-	sendTime := time.Now()
-	_, err = conn.WriteTo(msgBytes, addr)
+	txKey := session.sent
+	result.SendTime = time.Now()
+	_, err = conn.WriteTo(msgBytes, session.dst)
 	if err != nil {
+		result.ErrorClass = ErrorSend
+		if errors.Is(err, syscall.EMSGSIZE) {
+			result.ErrorClass = ErrorTooBig
+		}
 		result.Error = fmt.Errorf("send failed: %w", err)
 		return result
 	}
+	session.sent++
 
 	// Receive response with timeout
+	// Re-check cancellation after moving the deadline so a concurrent
+	// cancel cannot be overwritten
 	conn.SetReadDeadline(time.Now().Add(p.config.Timeout))
-	reply := make([]byte, 1500)
-	_, _, err = conn.ReadFrom(reply)
-	if err != nil {
-		result.Error = fmt.Errorf("receive failed: %w", err)
+	if ctx.Err() != nil {
+		result.Error = ctx.Err()
 		return result
 	}
+	// Read until a matching reply arrives or the deadline passes,
+	// ignoring packets that belong to other probes or other processes
+	reply := make([]byte, 1500)
+	oob := make([]byte, 128)
+	for {
+		n, peer, recvTime, err := session.read(reply, oob)
+		if err != nil {
+			result.ErrorClass = classifyError(err)
+			result.Error = fmt.Errorf("receive failed: %w", err)
+			return result
+		}
+
+		// Record the reply time of a matched message
+		complete := func() {
+			if ts, ok := session.sendTime(txKey); ok {
+				result.SendTime = ts
+			}
+			result.RecvTime = recvTime
+			result.RTT = recvTime.Sub(result.SendTime)
+		}
+
+		msg, err := icmp.ParseMessage(family.protocol, reply[:n])
+		if err != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case family.echoReply:
+			echo, ok := msg.Body.(*icmp.Echo)
+			if !ok || !session.isOurEcho(echo.ID, echo.Seq, sequence) || !sameIP(peer, session.dstIP) {
+				continue
+			}
+			complete()
+			result.Bytes = n
+			result.Success = true
+			return result
+
+		case family.unreachable:
+			body, ok := msg.Body.(*icmp.DstUnreach)
+			if !ok || !session.quotesOurEcho(body.Data, sequence) {
+				continue
+			}
+			complete()
+			if mtu, ok := fragmentationNeeded(family, msg.Code, reply[:n]); ok {
+				result.ErrorClass = ErrorTooBig
+				result.Error = &FragmentationNeededError{MTU: mtu, From: peer}
+				return result
+			}
+			result.ErrorClass = ErrorUnreachable
+			result.Error = &DestinationUnreachableError{Code: msg.Code, From: peer}
+			return result
+
+		case family.packetTooBig:
+			body, ok := msg.Body.(*icmp.PacketTooBig)
+			if !ok || !session.quotesOurEcho(body.Data, sequence) {
+				continue
+			}
+			complete()
+			result.ErrorClass = ErrorTooBig
+			result.Error = &FragmentationNeededError{MTU: body.MTU, From: peer}
+			return result
+
+		case family.timeExceeded:
+			body, ok := msg.Body.(*icmp.TimeExceeded)
+			if !ok || !session.quotesOurEcho(body.Data, sequence) {
+				continue
+			}
+			complete()
+			result.ErrorClass = ErrorTimeExceeded
+			result.Error = &TimeExceededError{Code: msg.Code, From: peer}
+			return result
+		}
+	}
+}
+
+// payload returns the echo data, padded to the configured size
+func (p *ICMPProber) payload() []byte {
+	data := make([]byte, p.config.PayloadSize)
+	copy(data, icmpPayload)
+	return data
+}
+
+// isOurEcho reports whether an echo ID and sequence belong to the given probe
+func (s *icmpSession) isOurEcho(id, seq, sequence int) bool {
+	return id == s.echoID && seq == sequence&0xffff
+}
 
-	receiveTime := time.Now()
-	result.RTT = receiveTime.Sub(sendTime)
-	result.Success = true
+// quotesOurEcho reports whether the original datagram quoted in an ICMP
+// error message is the echo request for the given probe
+func (s *icmpSession) quotesOurEcho(data []byte, sequence int) bool {
+	family := s.family
+	protocol, origDst, quoted, ok := quotedDatagram(family, data)
+	if !ok || protocol != family.protocol || !origDst.Equal(s.dstIP) {
+		return false
+	}
 
-	return result
+	if icmpType(family, quoted[0]) != family.echoRequest {
+		return false
+	}
+	id := int(binary.BigEndian.Uint16(quoted[4:6]))
+	seq := int(binary.BigEndian.Uint16(quoted[6:8]))
+	return s.isOurEcho(id, seq, sequence)
+}
+
+// quotedDatagram splits the original datagram quoted in an ICMP error
+// message into its protocol, destination and payload. The quote holds the
+// original IP header followed by at least 8 bytes of its payload.
+func quotedDatagram(family *icmpFamily, data []byte) (protocol int, dst net.IP, payload []byte, ok bool) {
+	var hdrLen int
+
+	switch family.protocol {
+	case protocolICMP:
+		if len(data) < ipv4.HeaderLen {
+			return 0, nil, nil, false
+		}
+		hdrLen = int(data[0]&0x0f) * 4
+		if hdrLen < ipv4.HeaderLen || len(data) < hdrLen {
+			return 0, nil, nil, false
+		}
+		protocol = int(data[9])
+		dst = net.IP(data[16:20])
+	default:
+		// Extension headers are not followed; probes are sent without them
+		hdrLen = ipv6.HeaderLen
+		if len(data) < hdrLen {
+			return 0, nil, nil, false
+		}
+		protocol = int(data[6])
+		dst = net.IP(data[24:40])
+	}
+
+	if len(data) < hdrLen+8 {
+		return 0, nil, nil, false
+	}
+	return protocol, dst, data[hdrLen:], true
+}
+
+// fragmentationNeeded reports whether an ICMPv4 destination unreachable
+// message is "fragmentation needed and DF set" and returns the next-hop MTU
+// from bytes 6-7 of the message (RFC 1191), 0 if the router left it out
+func fragmentationNeeded(family *icmpFamily, code int, msg []byte) (int, bool) {
+	if family.protocol != protocolICMP || code != 4 {
+		return 0, false
+	}
+	if len(msg) < 8 {
+		return 0, true
+	}
+	return int(binary.BigEndian.Uint16(msg[6:8])), true
+}
+
+// icmpType converts a raw ICMP type byte into the family's message type
+func icmpType(family *icmpFamily, b byte) icmp.Type {
+	if family.protocol == protocolICMP {
+		return ipv4.ICMPType(b)
+	}
+	return ipv6.ICMPType(b)
+}
+
+// sameIP reports whether a packet source address matches ip
+func sameIP(addr net.Addr, ip net.IP) bool {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP.Equal(ip)
+	case *net.UDPAddr:
+		return a.IP.Equal(ip)
+	}
+	return false
+}
+
+// DestinationUnreachableError is returned when an ICMP destination
+// unreachable message is received in response to a probe
+type DestinationUnreachableError struct {
+	Code int      // ICMP code (e.g. 1 host unreachable, 3 port unreachable)
+	From net.Addr // Router or host that sent the message
+}
+
+func (e *DestinationUnreachableError) Error() string {
+	return fmt.Sprintf("destination unreachable (code %d) from %v", e.Code, e.From)
+}
+
+// TimeExceededError is returned when an ICMP time exceeded message is
+// received in response to a probe
+type TimeExceededError struct {
+	Code int      // ICMP code (0 TTL exceeded in transit, 1 reassembly time exceeded)
+	From net.Addr // Router that sent the message
+}
+
+func (e *TimeExceededError) Error() string {
+	return fmt.Sprintf("time exceeded (code %d) from %v", e.Code, e.From)
+}
+
+// FragmentationNeededError is returned when a router reports that a probe
+// sent with DF set exceeds the next-hop MTU (ICMPv4 fragmentation needed,
+// ICMPv6 packet too big)
+type FragmentationNeededError struct {
+	MTU  int      // Next-hop MTU reported by the router, 0 if unknown
+	From net.Addr // Router that sent the message, nil if unknown
+}
+
+func (e *FragmentationNeededError) Error() string {
+	if e.From == nil {
+		return fmt.Sprintf("fragmentation needed (MTU %d)", e.MTU)
+	}
+	return fmt.Sprintf("fragmentation needed (MTU %d) from %v", e.MTU, e.From)
 }
@@ -0,0 +1,296 @@
+package probe
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+func TestICMPProberIPv6Loopback(t *testing.T) {
+	prober := NewICMPProber(ICMPProbeConfig{
+		Target:    "::1",
+		Count:     3,
+		Interval:  10 * time.Millisecond,
+		Timeout:   time.Second,
+		IPVersion: 6,
+	})
+	results, err := prober.Probe()
+	if err != nil {
+		// Neither a raw socket nor a ping socket is permitted
+		t.Skipf("cannot open an ICMPv6 socket: %v", err)
+	}
+	checkResults(t, results, 3)
+
+	if mode := prober.SocketMode(); mode != string(ICMPModeRaw) && mode != string(ICMPModeUnprivileged) {
+		t.Errorf("SocketMode() = %q, want raw or unprivileged", mode)
+	}
+}
+
+// protocolUDP is the IANA protocol number of UDP
+const protocolUDP = 17
+
+// quotedEcho returns the start of an echo request datagram as an ICMP error
+// quotes it: the IP header, with options padding it to headerLen on IPv4,
+// followed by the echo request
+func quotedEcho(t *testing.T, family *icmpFamily, headerLen int, dst net.IP, typ icmp.Type, id, seq int) []byte {
+	t.Helper()
+
+	echo, err := (&icmp.Message{
+		Type: typ,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte(icmpPayload)},
+	}).Marshal(nil)
+	if err != nil {
+		t.Fatalf("Marshal echo: %v", err)
+	}
+
+	var header []byte
+	if family == icmpFamilyV4 {
+		header = make([]byte, headerLen)
+		header[0] = 4<<4 | byte(headerLen/4)
+		header[9] = protocolICMP
+		copy(header[16:20], dst.To4())
+	} else {
+		header = make([]byte, ipv6.HeaderLen)
+		header[0] = 6 << 4
+		header[6] = protocolICMPv6
+		copy(header[24:40], dst.To16())
+	}
+	return append(header, echo...)
+}
+
+// icmpError wraps a quoted datagram in an ICMP error of the given type and
+// returns the quoted data as parsed back out of the message
+func icmpError(t *testing.T, family *icmpFamily, typ icmp.Type, quoted []byte) []byte {
+	t.Helper()
+
+	var body icmp.MessageBody
+	switch typ {
+	case family.unreachable:
+		body = &icmp.DstUnreach{Data: quoted}
+	case family.timeExceeded:
+		body = &icmp.TimeExceeded{Data: quoted}
+	default:
+		body = &icmp.PacketTooBig{MTU: 1280, Data: quoted}
+	}
+	b, err := (&icmp.Message{Type: typ, Body: body}).Marshal(nil)
+	if err != nil {
+		t.Fatalf("Marshal error message: %v", err)
+	}
+	msg, err := icmp.ParseMessage(family.protocol, b)
+	if err != nil {
+		t.Fatalf("ParseMessage: %v", err)
+	}
+	switch body := msg.Body.(type) {
+	case *icmp.DstUnreach:
+		return body.Data
+	case *icmp.TimeExceeded:
+		return body.Data
+	case *icmp.PacketTooBig:
+		return body.Data
+	}
+	t.Fatalf("unexpected message body %T", msg.Body)
+	return nil
+}
+
+func TestIsOurEcho(t *testing.T) {
+	tests := []struct {
+		name     string
+		echoID   int
+		id, seq  int
+		sequence int
+		want     bool
+	}{
+		{"match", 1234, 1234, 7, 7, true},
+		{"other sequence", 1234, 1234, 8, 7, false},
+		{"other ID", 1234, 4321, 7, 7, false},
+		// Echo sequence numbers are 16 bits
+		{"wrapped sequence", 1234, 1234, 1, 65537, true},
+		// A ping socket rewrites the ID to its local port, so the
+		// configured packet ID no longer identifies replies
+		{"ping socket", 40000, 40000, 7, 7, true},
+		{"ping socket with packet ID", 40000, 1234, 7, 7, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &icmpSession{family: icmpFamilyV4, echoID: tt.echoID}
+			if got := s.isOurEcho(tt.id, tt.seq, tt.sequence); got != tt.want {
+				t.Errorf("isOurEcho(%d, %d, %d) = %v, want %v", tt.id, tt.seq, tt.sequence, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotesOurEcho(t *testing.T) {
+	const id, seq = 1234, 7
+
+	families := []struct {
+		name   string
+		family *icmpFamily
+		dst    net.IP
+		other  net.IP
+	}{
+		{"ICMPv4", icmpFamilyV4, net.IPv4(192, 0, 2, 1), net.IPv4(192, 0, 2, 2)},
+		{"ICMPv6", icmpFamilyV6, net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")},
+	}
+
+	for _, f := range families {
+		family := f.family
+		quote := func(t *testing.T, headerLen int, dst net.IP, typ icmp.Type, id, seq int) []byte {
+			return quotedEcho(t, family, headerLen, dst, typ, id, seq)
+		}
+		tests := []struct {
+			name   string
+			quoted func(t *testing.T) []byte
+			echoID int
+			want   bool
+		}{
+			{"our request", func(t *testing.T) []byte {
+				return quote(t, ipv4.HeaderLen, f.dst, family.echoRequest, id, seq)
+			}, id, true},
+			{"other destination", func(t *testing.T) []byte {
+				return quote(t, ipv4.HeaderLen, f.other, family.echoRequest, id, seq)
+			}, id, false},
+			{"other ID", func(t *testing.T) []byte {
+				return quote(t, ipv4.HeaderLen, f.dst, family.echoRequest, id+1, seq)
+			}, id, false},
+			{"other sequence", func(t *testing.T) []byte {
+				return quote(t, ipv4.HeaderLen, f.dst, family.echoRequest, id, seq+1)
+			}, id, false},
+			{"echo reply", func(t *testing.T) []byte {
+				return quote(t, ipv4.HeaderLen, f.dst, family.echoReply, id, seq)
+			}, id, false},
+			{"ping socket", func(t *testing.T) []byte {
+				return quote(t, ipv4.HeaderLen, f.dst, family.echoRequest, 40000, seq)
+			}, 40000, true},
+			{"other protocol", func(t *testing.T) []byte {
+				b := quote(t, ipv4.HeaderLen, f.dst, family.echoRequest, id, seq)
+				if family == icmpFamilyV4 {
+					b[9] = protocolUDP
+				} else {
+					b[6] = protocolUDP
+				}
+				return b
+			}, id, false},
+			{"first 8 bytes only", func(t *testing.T) []byte {
+				b := quote(t, ipv4.HeaderLen, f.dst, family.echoRequest, id, seq)
+				return b[:len(b)-len(icmpPayload)]
+			}, id, true},
+			{"truncated echo header", func(t *testing.T) []byte {
+				b := quote(t, ipv4.HeaderLen, f.dst, family.echoRequest, id, seq)
+				return b[:len(b)-len(icmpPayload)-1]
+			}, id, false},
+		}
+		if family == icmpFamilyV4 {
+			tests = append(tests, []struct {
+				name   string
+				quoted func(t *testing.T) []byte
+				echoID int
+				want   bool
+			}{
+				{"IPv4 options", func(t *testing.T) []byte {
+					return quote(t, ipv4.HeaderLen+8, f.dst, family.echoRequest, id, seq)
+				}, id, true},
+				{"IPv4 header length too small", func(t *testing.T) []byte {
+					b := quote(t, ipv4.HeaderLen, f.dst, family.echoRequest, id, seq)
+					b[0] = 4<<4 | 4
+					return b
+				}, id, false},
+			}...)
+		}
+
+		for _, tt := range tests {
+			t.Run(f.name+"/"+tt.name, func(t *testing.T) {
+				s := &icmpSession{family: family, dstIP: f.dst, echoID: tt.echoID}
+				quoted := tt.quoted(t)
+
+				types := []icmp.Type{family.unreachable, family.timeExceeded}
+				if family == icmpFamilyV6 {
+					types = append(types, family.packetTooBig)
+				}
+				for _, typ := range types {
+					data := icmpError(t, family, typ, quoted)
+					if got := s.quotesOurEcho(data, seq); got != tt.want {
+						t.Errorf("%v: quotesOurEcho = %v, want %v", typ, got, tt.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestQuotedDatagram(t *testing.T) {
+	v4 := net.IPv4(192, 0, 2, 1)
+	v6 := net.ParseIP("2001:db8::1")
+
+	tests := []struct {
+		name     string
+		family   *icmpFamily
+		data     []byte
+		protocol int
+		dst      net.IP
+		offset   int // Start of the quoted payload; 0 if none should be found
+	}{
+		{"IPv4", icmpFamilyV4, quotedEcho(t, icmpFamilyV4, ipv4.HeaderLen, v4, ipv4.ICMPTypeEcho, 1, 1), protocolICMP, v4, ipv4.HeaderLen},
+		{"IPv4 options", icmpFamilyV4, quotedEcho(t, icmpFamilyV4, 60, v4, ipv4.ICMPTypeEcho, 1, 1), protocolICMP, v4, 60},
+		{"IPv6", icmpFamilyV6, quotedEcho(t, icmpFamilyV6, 0, v6, ipv6.ICMPTypeEchoRequest, 1, 1), protocolICMPv6, v6, ipv6.HeaderLen},
+		{"IPv4 header only", icmpFamilyV4, quotedEcho(t, icmpFamilyV4, ipv4.HeaderLen, v4, ipv4.ICMPTypeEcho, 1, 1)[:ipv4.HeaderLen+7], 0, nil, 0},
+		{"IPv4 options cut short", icmpFamilyV4, quotedEcho(t, icmpFamilyV4, 60, v4, ipv4.ICMPTypeEcho, 1, 1)[:40], 0, nil, 0},
+		{"IPv6 header cut short", icmpFamilyV6, quotedEcho(t, icmpFamilyV6, 0, v6, ipv6.ICMPTypeEchoRequest, 1, 1)[:ipv6.HeaderLen-1], 0, nil, 0},
+		{"empty", icmpFamilyV4, nil, 0, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protocol, dst, payload, ok := quotedDatagram(tt.family, tt.data)
+			if ok != (tt.offset > 0) {
+				t.Fatalf("quotedDatagram ok = %v, want %v", ok, tt.offset > 0)
+			}
+			if !ok {
+				return
+			}
+			if protocol != tt.protocol || !dst.Equal(tt.dst) || !bytes.Equal(payload, tt.data[tt.offset:]) {
+				t.Errorf("got protocol %d, dst %v, %d payload bytes; want %d, %v, %d",
+					protocol, dst, len(payload), tt.protocol, tt.dst, len(tt.data)-tt.offset)
+			}
+		})
+	}
+}
+
+func TestICMPPingSocketEchoID(t *testing.T) {
+	prober := NewICMPProber(ICMPProbeConfig{Target: "127.0.0.1", Mode: ICMPModeUnprivileged, PacketID: 1234})
+	s, err := prober.listen(icmpFamilyV4, &net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot open a ping socket: %v", err)
+	}
+	defer s.conn.Close()
+
+	local, ok := s.conn.LocalAddr().(*net.UDPAddr)
+	if !ok || local.Port == 0 {
+		t.Fatalf("ping socket local address %v has no port", s.conn.LocalAddr())
+	}
+	if s.echoID != local.Port {
+		t.Errorf("echo ID %d, want the local port %d", s.echoID, local.Port)
+	}
+	if !s.isOurEcho(local.Port, 1, 1) || s.isOurEcho(1234, 1, 1) {
+		t.Error("ping socket session matched on the packet ID instead of its local port")
+	}
+}
+
+func TestICMPProberCancel(t *testing.T) {
+	prober := NewICMPProber(ICMPProbeConfig{
+		Target:    "127.0.0.1",
+		Count:     50,
+		Interval:  20 * time.Millisecond,
+		Timeout:   time.Second,
+		IPVersion: 4,
+	})
+	if !checkCancellation(t, prober, 50, 3) {
+		t.Skip("cannot open an ICMP socket")
+	}
+}
@@ -0,0 +1,297 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// MTU probe methods
+const (
+	MTUMethodICMP = "icmp"
+	MTUMethodUDP  = "udp"
+)
+
+// MTUConfig holds configuration for path MTU discovery
+type MTUConfig struct {
+	Target    string        // Target host or IP
+	Method    string        // Probe method: "icmp" or "udp" (default icmp)
+	Port      int           // Destination port for UDP probes
+	MinMTU    int           // Smallest packet size to try (default 68 for IPv4, 1280 for IPv6)
+	MaxMTU    int           // Largest packet size to try (default 1500)
+	Attempts  int           // Probes sent per size before it counts as lost
+	Interval  time.Duration // Time between attempts at one size
+	Timeout   time.Duration // Timeout for each probe
+	IPVersion int           // IP version to use: 4, 6 or 0 for either
+	ICMPMode  ICMPMode      // Socket mode for ICMP probes (default: auto)
+}
+
+// MTUOutcome describes what happened to the probes of one packet size
+type MTUOutcome string
+
+// MTU probe outcomes
+const (
+	MTUFits       MTUOutcome = "fits"        // The target answered
+	MTUFragNeeded MTUOutcome = "frag-needed" // A router reported the packet too big
+	MTUTooBig     MTUOutcome = "too-big"     // The local host refused to send it
+	MTULost       MTUOutcome = "lost"        // No answer and no error
+)
+
+// MTUStep records the probes sent at one packet size
+type MTUStep struct {
+	Size        int        // Packet size including IP and transport headers
+	Outcome     MTUOutcome // What happened to the probes
+	ReportedMTU int        // Next-hop MTU from a fragmentation needed message, 0 if none
+	From        net.Addr   // Router that reported the packet too big, nil if unknown
+}
+
+// MTUResult holds the outcome of path MTU discovery
+type MTUResult struct {
+	PathMTU     int       // Largest packet size that reached the target
+	FragNeeded  bool      // Fragmentation needed / packet too big was received
+	ReportedMTU int       // Lowest next-hop MTU reported by a router, 0 if none
+	BlackHole   bool      // Larger packets were dropped without any ICMP error
+	Steps       []MTUStep // Sizes tried, in order
+}
+
+// MTUDiscoverer finds the path MTU by binary-searching the packet size of
+// UDP or ICMP probes sent with DF set. Fragmentation needed messages narrow
+// the search to the reported MTU; sizes that are silently dropped although
+// no router ever asked for smaller packets indicate a PMTUD black hole.
+type MTUDiscoverer struct {
+	config MTUConfig
+}
+
+// NewMTUDiscoverer creates a new path MTU discoverer
+func NewMTUDiscoverer(config MTUConfig) *MTUDiscoverer {
+	if config.Method == "" {
+		config.Method = MTUMethodICMP
+	}
+	if config.Port == 0 {
+		config.Port = 33434
+	}
+	if config.MaxMTU == 0 {
+		config.MaxMTU = 1500
+	}
+	if config.Attempts == 0 {
+		config.Attempts = 3
+	}
+	if config.Interval == 0 {
+		config.Interval = 200 * time.Millisecond
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 1 * time.Second
+	}
+
+	return &MTUDiscoverer{config: config}
+}
+
+// Discover searches for the path MTU. It fails if even the smallest size
+// gets no answer, since nothing can be concluded about larger ones.
+func (d *MTUDiscoverer) Discover(ctx context.Context) (*MTUResult, error) {
+	if d.config.Method != MTUMethodICMP && d.config.Method != MTUMethodUDP {
+		return nil, fmt.Errorf("unsupported MTU probe method: %s", d.config.Method)
+	}
+
+	// Resolve once so every size probes the same address
+	addr, err := net.ResolveIPAddr(ipNetwork("ip", d.config.IPVersion), d.config.Target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve address: %w", err)
+	}
+
+	// IP header plus the 8-byte UDP or ICMP header
+	overhead := 20 + 8
+	minMTU := 68
+	if addr.IP.To4() == nil {
+		overhead = 40 + 8
+		minMTU = 1280
+	}
+	lo := d.config.MinMTU
+	if lo == 0 {
+		lo = minMTU
+	}
+	if lo < overhead+d.minPayload() {
+		lo = overhead + d.minPayload()
+	}
+	hi := d.config.MaxMTU
+	if hi < lo {
+		return nil, fmt.Errorf("maximum MTU %d is below minimum %d", hi, lo)
+	}
+
+	result, err := searchMTU(lo, hi, func(size int) (MTUStep, error) {
+		return d.probeSize(ctx, addr, size, size-overhead)
+	})
+	if err != nil {
+		return result, err
+	}
+	if result.PathMTU == 0 {
+		return result, fmt.Errorf("no reply to %d-byte probes from %s", lo, addr)
+	}
+
+	return result, nil
+}
+
+// searchMTU binary-searches packet sizes from lo to hi with probe, which
+// reports what happened to one size. PathMTU is left at 0 if lo itself does
+// not fit, since nothing can be concluded about larger sizes.
+func searchMTU(lo, hi int, probe func(size int) (MTUStep, error)) (*MTUResult, error) {
+	result := &MTUResult{}
+	try := func(size int) (bool, error) {
+		step, err := probe(size)
+		if err != nil {
+			return false, err
+		}
+		result.Steps = append(result.Steps, step)
+		if step.Outcome == MTUFragNeeded {
+			result.FragNeeded = true
+			if step.ReportedMTU > 0 && (result.ReportedMTU == 0 || step.ReportedMTU < result.ReportedMTU) {
+				result.ReportedMTU = step.ReportedMTU
+			}
+		}
+		return step.Outcome == MTUFits, nil
+	}
+
+	// The smallest size must get through for the search to mean anything
+	ok, err := try(lo)
+	if err != nil || !ok {
+		return result, err
+	}
+
+	// Most paths carry the full size, so try it before searching
+	if lo < hi {
+		ok, err = try(hi)
+		if err != nil {
+			return result, err
+		}
+		if ok {
+			lo = hi
+		}
+	}
+
+	// Invariant: lo fits, hi does not. Nothing larger than a reported
+	// next-hop MTU can pass that router, so try the reported size next.
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if r := result.ReportedMTU; r >= lo && r < hi {
+			hi = r + 1
+			if r > lo && !triedSize(result.Steps, r) {
+				mid = r
+			}
+		}
+		if hi-lo <= 1 {
+			break
+		}
+		ok, err := try(mid)
+		if err != nil {
+			return result, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	result.PathMTU = lo
+
+	// Silent loss above the path MTU with no router ever asking for
+	// smaller packets breaks PMTUD for every other protocol too
+	if !result.FragNeeded {
+		for _, step := range result.Steps {
+			if step.Size > result.PathMTU && step.Outcome == MTULost {
+				result.BlackHole = true
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// minPayload returns the smallest payload the configured prober accepts
+func (d *MTUDiscoverer) minPayload() int {
+	if d.config.Method == MTUMethodUDP {
+		return PacketV1Len
+	}
+	return len(icmpPayload)
+}
+
+// probeSize sends up to Attempts probes of one packet size, stopping at
+// the first conclusive answer
+func (d *MTUDiscoverer) probeSize(ctx context.Context, addr *net.IPAddr, size, payload int) (MTUStep, error) {
+	step := MTUStep{Size: size, Outcome: MTULost}
+
+	var prober Prober
+	target := addr.String()
+	if d.config.Method == MTUMethodUDP {
+		prober = NewUDPProber(UDPProbeConfig{
+			Target:       target,
+			Port:         d.config.Port,
+			Count:        1,
+			PayloadSize:  payload,
+			Timeout:      d.config.Timeout,
+			IPVersion:    d.config.IPVersion,
+			DontFragment: true,
+		})
+	} else {
+		prober = NewICMPProber(ICMPProbeConfig{
+			Target:       target,
+			Count:        1,
+			Timeout:      d.config.Timeout,
+			IPVersion:    d.config.IPVersion,
+			Mode:         d.config.ICMPMode,
+			PayloadSize:  payload,
+			DontFragment: true,
+		})
+	}
+
+	for attempt := 0; attempt < d.config.Attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, d.config.Interval); err != nil {
+				return step, err
+			}
+		}
+
+		results, err := prober.ProbeContext(ctx)
+		if err != nil {
+			return step, err
+		}
+		if len(results) == 0 {
+			continue
+		}
+
+		r := results[0]
+		var fragErr *FragmentationNeededError
+		var unreachable *DestinationUnreachableError
+		switch {
+		case r.Success, r.ErrorClass == ErrorRefused:
+			// A port unreachable from the target means the datagram arrived
+			step.Outcome = MTUFits
+			return step, nil
+		case errors.As(r.Error, &unreachable) && sameIP(unreachable.From, addr.IP):
+			step.Outcome = MTUFits
+			return step, nil
+		case errors.As(r.Error, &fragErr):
+			step.Outcome = MTUFragNeeded
+			step.ReportedMTU = fragErr.MTU
+			step.From = fragErr.From
+			return step, nil
+		case r.ErrorClass == ErrorTooBig:
+			step.Outcome = MTUTooBig
+			return step, nil
+		}
+	}
+
+	return step, nil
+}
+
+// triedSize reports whether a packet size has already been probed
+func triedSize(steps []MTUStep, size int) bool {
+	for _, step := range steps {
+		if step.Size == size {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakePath answers probes of one size the way a network path would
+type fakePath func(size int) MTUOutcome
+
+// fitsUpTo passes packets up to mtu and handles larger ones with above
+func fitsUpTo(mtu int, above MTUOutcome) fakePath {
+	return func(size int) MTUOutcome {
+		if size <= mtu {
+			return MTUFits
+		}
+		return above
+	}
+}
+
+func (p fakePath) step(size int) MTUStep {
+	return MTUStep{Size: size, Outcome: p(size)}
+}
+
+// routers reports fragmentation needed from the first router, in path
+// order, whose link MTU the packet exceeds; a reported MTU of 0 stands for a
+// router that does not fill it in
+type routers [][2]int // {link MTU, reported MTU}
+
+func (rs routers) probe(size int) MTUStep {
+	for _, r := range rs {
+		if size > r[0] {
+			return MTUStep{Size: size, Outcome: MTUFragNeeded, ReportedMTU: r[1]}
+		}
+	}
+	return MTUStep{Size: size, Outcome: MTUFits}
+}
+
+func TestSearchMTU(t *testing.T) {
+	tests := []struct {
+		name        string
+		lo, hi      int
+		probe       func(size int) MTUStep
+		pathMTU     int
+		fragNeeded  bool
+		reportedMTU int
+		blackHole   bool
+		sizes       []int // Sizes probed in order, nil to skip the check
+	}{
+		{
+			name:    "path fits fully",
+			lo:      68,
+			hi:      1500,
+			probe:   fitsUpTo(1500, MTULost).step,
+			pathMTU: 1500,
+			sizes:   []int{68, 1500},
+		},
+		{
+			name:        "reported mtu narrows search",
+			lo:          68,
+			hi:          1500,
+			probe:       routers{{1400, 1400}}.probe,
+			pathMTU:     1400,
+			fragNeeded:  true,
+			reportedMTU: 1400,
+			sizes:       []int{68, 1500, 1400},
+		},
+		{
+			name:        "second router reports smaller mtu",
+			lo:          68,
+			hi:          1500,
+			probe:       routers{{1492, 1492}, {1400, 1400}}.probe,
+			pathMTU:     1400,
+			fragNeeded:  true,
+			reportedMTU: 1400,
+			sizes:       []int{68, 1500, 1492, 1400},
+		},
+		{
+			name:        "reported mtu too large",
+			lo:          1280,
+			hi:          1500,
+			probe:       routers{{1400, 1450}}.probe,
+			pathMTU:     1400,
+			fragNeeded:  true,
+			reportedMTU: 1450,
+		},
+		{
+			name:       "frag needed without mtu",
+			lo:         68,
+			hi:         1500,
+			probe:      routers{{1280, 0}}.probe,
+			pathMTU:    1280,
+			fragNeeded: true,
+		},
+		{
+			name:      "silent drops above mtu",
+			lo:        68,
+			hi:        1500,
+			probe:     fitsUpTo(1400, MTULost).step,
+			pathMTU:   1400,
+			blackHole: true,
+		},
+		{
+			name:    "local interface too small",
+			lo:      68,
+			hi:      9000,
+			probe:   fitsUpTo(1500, MTUTooBig).step,
+			pathMTU: 1500,
+		},
+		{
+			name:    "single size fits",
+			lo:      1280,
+			hi:      1280,
+			probe:   fitsUpTo(1500, MTULost).step,
+			pathMTU: 1280,
+			sizes:   []int{1280},
+		},
+		{
+			name:    "single size lost",
+			lo:      1280,
+			hi:      1280,
+			probe:   fitsUpTo(576, MTULost).step,
+			pathMTU: 0,
+			sizes:   []int{1280},
+		},
+		{
+			name:    "smallest size lost",
+			lo:      68,
+			hi:      1500,
+			probe:   fitsUpTo(0, MTULost).step,
+			pathMTU: 0,
+			sizes:   []int{68},
+		},
+		{
+			name:      "adjacent sizes",
+			lo:        1499,
+			hi:        1500,
+			probe:     fitsUpTo(1499, MTULost).step,
+			pathMTU:   1499,
+			blackHole: true,
+			sizes:     []int{1499, 1500},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sizes []int
+			result, err := searchMTU(tt.lo, tt.hi, func(size int) (MTUStep, error) {
+				if size < tt.lo || size > tt.hi {
+					t.Fatalf("probed %d bytes outside [%d, %d]", size, tt.lo, tt.hi)
+				}
+				sizes = append(sizes, size)
+				return tt.probe(size), nil
+			})
+			if err != nil {
+				t.Fatalf("searchMTU: %v", err)
+			}
+
+			if result.PathMTU != tt.pathMTU {
+				t.Errorf("PathMTU = %d, want %d", result.PathMTU, tt.pathMTU)
+			}
+			if result.FragNeeded != tt.fragNeeded || result.ReportedMTU != tt.reportedMTU {
+				t.Errorf("FragNeeded %v ReportedMTU %d, want %v and %d",
+					result.FragNeeded, result.ReportedMTU, tt.fragNeeded, tt.reportedMTU)
+			}
+			if result.BlackHole != tt.blackHole {
+				t.Errorf("BlackHole = %v, want %v", result.BlackHole, tt.blackHole)
+			}
+			if tt.sizes != nil && !reflect.DeepEqual(sizes, tt.sizes) {
+				t.Errorf("probed sizes %v, want %v", sizes, tt.sizes)
+			}
+			if len(result.Steps) != len(sizes) {
+				t.Fatalf("%d steps for %d probes", len(result.Steps), len(sizes))
+			}
+			for i, step := range result.Steps {
+				if step.Size != sizes[i] {
+					t.Errorf("step %d is %d bytes, probed %d", i, step.Size, sizes[i])
+				}
+				if triedSize(result.Steps[:i], step.Size) {
+					t.Errorf("%d bytes probed twice", step.Size)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchMTUProbeError(t *testing.T) {
+	probes := 0
+	result, err := searchMTU(68, 1500, func(size int) (MTUStep, error) {
+		probes++
+		if probes == 3 {
+			return MTUStep{}, context.Canceled
+		}
+		return fitsUpTo(1400, MTULost).step(size), nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if len(result.Steps) != 2 {
+		t.Fatalf("kept %d steps, want the 2 completed", len(result.Steps))
+	}
+}
@@ -0,0 +1,70 @@
+package probe
+
+import "time"
+
+// OneWayDelays splits round trips into their forward, reverse and reflector
+// processing parts using the reflector timestamps of version 2 packets
+type OneWayDelays struct {
+	ClockOffset time.Duration   // Estimated reflector clock minus sender clock
+	Forward     []time.Duration // Sender to reflector, corrected for the clock offset
+	Reverse     []time.Duration // Reflector to sender, corrected for the clock offset
+	Processing  []time.Duration // Time the reflector held each probe
+}
+
+// OneWay computes one-way delays from the successful results that carry
+// reflector timestamps, reporting false if there are none.
+//
+// The sender and reflector clocks need not be synchronized. As in NTP, the
+// clock offset is estimated from the probe with the smallest network delay
+// (T4-T1)-(T3-T2), assuming its forward and reverse paths took equally
+// long: offset = ((T2-T1)+(T3-T4))/2. Every one-way delay is corrected by
+// that offset, so forward and reverse delays are exact only relative to
+// each other when the path is asymmetric, and drift between the clocks over
+// a long run shows up as a trend. Delays that the correction would make
+// negative are reported as zero.
+func OneWay(results []Result) (OneWayDelays, bool) {
+	var reflected []Result
+	for _, r := range results {
+		if r.Success && !r.ReflectorRecv.IsZero() && !r.ReflectorSend.IsZero() {
+			reflected = append(reflected, r)
+		}
+	}
+	if len(reflected) == 0 {
+		return OneWayDelays{}, false
+	}
+
+	best := reflected[0]
+	for _, r := range reflected[1:] {
+		if networkDelay(r) < networkDelay(best) {
+			best = r
+		}
+	}
+
+	ow := OneWayDelays{
+		ClockOffset: (best.ReflectorRecv.Sub(best.SendTime) + best.ReflectorSend.Sub(best.RecvTime)) / 2,
+		Forward:     make([]time.Duration, len(reflected)),
+		Reverse:     make([]time.Duration, len(reflected)),
+		Processing:  make([]time.Duration, len(reflected)),
+	}
+	for i, r := range reflected {
+		ow.Forward[i] = nonNegative(r.ReflectorRecv.Sub(r.SendTime) - ow.ClockOffset)
+		ow.Reverse[i] = nonNegative(r.RecvTime.Sub(r.ReflectorSend) + ow.ClockOffset)
+		ow.Processing[i] = nonNegative(r.ReflectorSend.Sub(r.ReflectorRecv))
+	}
+
+	return ow, true
+}
+
+// networkDelay returns the round-trip time spent on the network, excluding
+// the time the reflector held the probe
+func networkDelay(r Result) time.Duration {
+	return r.RecvTime.Sub(r.SendTime) - r.ReflectorSend.Sub(r.ReflectorRecv)
+}
+
+// nonNegative clamps a duration at zero
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
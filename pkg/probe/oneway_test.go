@@ -0,0 +1,102 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+// reflected returns a successful result whose reflector clock runs offset
+// ahead of the sender's, with the given forward, processing and reverse
+// delays
+func reflected(sent time.Time, offset, forward, processing, reverse time.Duration) Result {
+	recv := sent.Add(forward + processing + reverse)
+	return Result{
+		Success:       true,
+		SendTime:      sent,
+		RecvTime:      recv,
+		RTT:           recv.Sub(sent),
+		ReflectorRecv: sent.Add(forward + offset),
+		ReflectorSend: sent.Add(forward + processing + offset),
+	}
+}
+
+func TestOneWay(t *testing.T) {
+	ms := time.Millisecond
+	start := time.Unix(1700000000, 0)
+	offset := 250 * ms
+
+	results := []Result{
+		// Symmetric and fastest, so it sets the offset
+		reflected(start, offset, 2*ms, ms, 2*ms),
+		// Forward queueing
+		reflected(start.Add(time.Second), offset, 7*ms, ms, 2*ms),
+		// Reverse queueing, held longer by the reflector
+		reflected(start.Add(2*time.Second), offset, 2*ms, 3*ms, 5*ms),
+		// Failed and unreflected probes are ignored
+		{Sequence: 4, SendTime: start.Add(3 * time.Second)},
+		{Success: true, SendTime: start.Add(4 * time.Second), RecvTime: start.Add(4*time.Second + 4*ms)},
+	}
+
+	ow, ok := OneWay(results)
+	if !ok {
+		t.Fatal("OneWay reported no reflected results")
+	}
+	if ow.ClockOffset != offset {
+		t.Errorf("ClockOffset = %v, want %v", ow.ClockOffset, offset)
+	}
+	want := OneWayDelays{
+		Forward:    []time.Duration{2 * ms, 7 * ms, 2 * ms},
+		Reverse:    []time.Duration{2 * ms, 2 * ms, 5 * ms},
+		Processing: []time.Duration{ms, ms, 3 * ms},
+	}
+	for _, d := range []struct {
+		name      string
+		got, want []time.Duration
+	}{
+		{"Forward", ow.Forward, want.Forward},
+		{"Reverse", ow.Reverse, want.Reverse},
+		{"Processing", ow.Processing, want.Processing},
+	} {
+		if len(d.got) != len(d.want) {
+			t.Errorf("%s = %v, want %v", d.name, d.got, d.want)
+			continue
+		}
+		for i := range d.want {
+			if d.got[i] != d.want[i] {
+				t.Errorf("%s = %v, want %v", d.name, d.got, d.want)
+				break
+			}
+		}
+	}
+}
+
+func TestOneWayAsymmetric(t *testing.T) {
+	ms := time.Millisecond
+	start := time.Unix(1700000000, 0)
+
+	// A 1ms forward and 5ms reverse path looks like 3ms each way, with the
+	// 2ms difference taken for clock offset
+	ow, ok := OneWay([]Result{reflected(start, 0, ms, 0, 5*ms)})
+	if !ok {
+		t.Fatal("OneWay reported no reflected results")
+	}
+	if ow.ClockOffset != -2*ms || ow.Forward[0] != 3*ms || ow.Reverse[0] != 3*ms {
+		t.Errorf("got offset %v, forward %v, reverse %v; want -2ms, 3ms, 3ms", ow.ClockOffset, ow.Forward[0], ow.Reverse[0])
+	}
+
+	// With the offset taken from a 5ms forward and 1ms reverse path, a
+	// later probe with a 1ms forward path would come out negative
+	ow, _ = OneWay([]Result{
+		reflected(start, 0, 5*ms, 0, ms),
+		reflected(start.Add(time.Second), 0, ms, 0, 10*ms),
+	})
+	if ow.ClockOffset != 2*ms || ow.Forward[1] != 0 || ow.Reverse[1] != 12*ms {
+		t.Errorf("got offset %v, forward %v, reverse %v; want 2ms, 0, 12ms", ow.ClockOffset, ow.Forward[1], ow.Reverse[1])
+	}
+}
+
+func TestOneWayNone(t *testing.T) {
+	if _, ok := OneWay([]Result{{Success: true, RTT: time.Millisecond}}); ok {
+		t.Error("OneWay reported delays without reflector timestamps")
+	}
+}
@@ -0,0 +1,184 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// UDP probe packet versions
+const (
+	// PacketV1 is the original format: [seq 4][send time 8][padding].
+	// Reflectors echo it unchanged.
+	PacketV1 = 1
+
+	// PacketV2 adds a header and room for the reflector's receive (T2) and
+	// transmit (T3) timestamps:
+	//
+	//	Bytes 0-3:   Magic "NPRB"
+	//	Byte 4:      Version (2)
+	//	Byte 5:      Flags (bit 0 set by the reflector once T2/T3 are filled in)
+	//	Bytes 6-7:   Reserved
+	//	Bytes 8-11:  Sequence number
+	//	Bytes 12-19: T1 sender transmit time
+	//	Bytes 20-27: T2 reflector receive time
+	//	Bytes 28-35: T3 reflector transmit time
+	//	Bytes 36+:   Padding
+	//
+	// Timestamps are big-endian nanoseconds since the Unix epoch.
+	PacketV2 = 2
+)
+
+// Packet sizes
+const (
+	PacketV1Len = 12 // Minimum size of a version 1 packet
+	PacketV2Len = 36 // Minimum size of a version 2 packet
+)
+
+const (
+	packetMagic         = 0x4e505242 // "NPRB"
+	packetFlagReflected = 0x01
+)
+
+var errShortPacket = errors.New("probe packet too short")
+
+// Packet is a decoded UDP probe packet
+type Packet struct {
+	Version   int       // PacketV1 or PacketV2
+	Sequence  uint32    // Probe sequence number
+	Reflected bool      // Reflector timestamps are present (version 2)
+	T1        time.Time // Sender transmit time
+	T2        time.Time // Reflector receive time, zero unless reflected
+	T3        time.Time // Reflector transmit time, zero unless reflected
+}
+
+// Marshal encodes the packet into b, which must be at least the minimum
+// size for its version; the rest of b is left as padding
+func (p *Packet) Marshal(b []byte) error {
+	if p.Version == PacketV2 {
+		if len(b) < PacketV2Len {
+			return errShortPacket
+		}
+		binary.BigEndian.PutUint32(b[0:4], packetMagic)
+		b[4] = PacketV2
+		b[5] = 0
+		if p.Reflected {
+			b[5] = packetFlagReflected
+		}
+		b[6], b[7] = 0, 0
+		binary.BigEndian.PutUint32(b[8:12], p.Sequence)
+		putTime(b[12:20], p.T1)
+		putTime(b[20:28], p.T2)
+		putTime(b[28:36], p.T3)
+		return nil
+	}
+
+	if len(b) < PacketV1Len {
+		return errShortPacket
+	}
+	binary.BigEndian.PutUint32(b[0:4], p.Sequence)
+	putTime(b[4:12], p.T1)
+	return nil
+}
+
+// ParsePacket decodes a probe packet of either version
+func ParsePacket(b []byte) (Packet, error) {
+	if len(b) >= PacketV2Len && binary.BigEndian.Uint32(b[0:4]) == packetMagic && b[4] == PacketV2 {
+		p := Packet{
+			Version:   PacketV2,
+			Sequence:  binary.BigEndian.Uint32(b[8:12]),
+			Reflected: b[5]&packetFlagReflected != 0,
+			T1:        getTime(b[12:20]),
+		}
+		if p.Reflected {
+			p.T2 = getTime(b[20:28])
+			p.T3 = getTime(b[28:36])
+		}
+		return p, nil
+	}
+
+	if len(b) < 4 {
+		return Packet{}, errShortPacket
+	}
+	p := Packet{Version: PacketV1, Sequence: binary.BigEndian.Uint32(b[0:4])}
+	if len(b) >= PacketV1Len {
+		p.T1 = getTime(b[4:12])
+	}
+	return p, nil
+}
+
+// ReflectPacket writes the reflector receive and transmit times into a
+// version 2 packet in place. Other packets are left unchanged and false is
+// returned.
+func ReflectPacket(b []byte, recv, send time.Time) bool {
+	if len(b) < PacketV2Len || binary.BigEndian.Uint32(b[0:4]) != packetMagic || b[4] != PacketV2 {
+		return false
+	}
+	b[5] |= packetFlagReflected
+	putTime(b[20:28], recv)
+	putTime(b[28:36], send)
+	return true
+}
+
+// putTime encodes t as nanoseconds since the Unix epoch, zero for the zero time
+func putTime(b []byte, t time.Time) {
+	var ns uint64
+	if !t.IsZero() {
+		ns = uint64(t.UnixNano())
+	}
+	binary.BigEndian.PutUint64(b, ns)
+}
+
+// getTime decodes nanoseconds since the Unix epoch, zero as the zero time
+func getTime(b []byte) time.Time {
+	ns := binary.BigEndian.Uint64(b)
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ns))
+}
+
+// packetFormat speaks the netprobe packet format of one version
+type packetFormat struct {
+	version int
+}
+
+func (f packetFormat) minSize() int {
+	if f.version == PacketV2 {
+		return PacketV2Len
+	}
+	return PacketV1Len
+}
+
+func (f packetFormat) marshal(b []byte, sequence uint32, sendTime time.Time) error {
+	packet := Packet{Version: f.version, Sequence: sequence, T1: sendTime}
+	return packet.Marshal(b)
+}
+
+func (f packetFormat) parse(b []byte) (udpReply, error) {
+	packet, err := ParsePacket(b)
+	if err != nil {
+		return udpReply{}, err
+	}
+	reply := udpReply{sequence: packet.Sequence}
+	if packet.Reflected {
+		reply.reflectorRecv, reply.reflectorSend = packet.T2, packet.T3
+	}
+	return reply, nil
+}
+
+// quotedSequence extracts the sequence number from a quoted probe packet.
+// Routers often quote only 8 bytes of payload, which holds a version 1
+// sequence number but not a version 2 one.
+func (f packetFormat) quotedSequence(b []byte) (uint32, bool) {
+	if len(b) >= 8 && binary.BigEndian.Uint32(b[0:4]) == packetMagic && b[4] == PacketV2 {
+		if len(b) < 12 {
+			return 0, false
+		}
+		return binary.BigEndian.Uint32(b[8:12]), true
+	}
+	if len(b) < 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(b[0:4]), true
+}
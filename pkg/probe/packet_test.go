@@ -0,0 +1,136 @@
+package probe
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	t1 := time.Unix(1700000000, 123456789)
+	t2 := t1.Add(3 * time.Millisecond)
+	t3 := t2.Add(50 * time.Microsecond)
+
+	tests := []struct {
+		name   string
+		packet Packet
+		size   int
+	}{
+		{"version 1", Packet{Version: PacketV1, Sequence: 7, T1: t1}, PacketV1Len},
+		{"version 1 padded", Packet{Version: PacketV1, Sequence: 0xfffffffe, T1: t1}, 64},
+		{"version 2", Packet{Version: PacketV2, Sequence: 7, T1: t1}, PacketV2Len},
+		{"version 2 reflected", Packet{Version: PacketV2, Sequence: 7, Reflected: true, T1: t1, T2: t2, T3: t3}, 64},
+		{"version 2 zero send time", Packet{Version: PacketV2, Sequence: 1}, PacketV2Len},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := make([]byte, tt.size)
+			if err := tt.packet.Marshal(b); err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			got, err := ParsePacket(b)
+			if err != nil {
+				t.Fatalf("ParsePacket: %v", err)
+			}
+			if got.Version != tt.packet.Version || got.Sequence != tt.packet.Sequence || got.Reflected != tt.packet.Reflected {
+				t.Errorf("got %+v, want %+v", got, tt.packet)
+			}
+			for _, ts := range []struct {
+				name      string
+				got, want time.Time
+			}{
+				{"T1", got.T1, tt.packet.T1},
+				{"T2", got.T2, tt.packet.T2},
+				{"T3", got.T3, tt.packet.T3},
+			} {
+				if !ts.got.Equal(ts.want) {
+					t.Errorf("%s = %v, want %v", ts.name, ts.got, ts.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPacketMarshalShort(t *testing.T) {
+	for _, packet := range []Packet{{Version: PacketV1}, {Version: PacketV2}} {
+		size := PacketV1Len
+		if packet.Version == PacketV2 {
+			size = PacketV2Len
+		}
+		if err := packet.Marshal(make([]byte, size-1)); !errors.Is(err, errShortPacket) {
+			t.Errorf("version %d: Marshal into %d bytes = %v, want %v", packet.Version, size-1, err, errShortPacket)
+		}
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	v2 := make([]byte, PacketV2Len)
+	(&Packet{Version: PacketV2, Sequence: 5}).Marshal(v2)
+
+	tests := []struct {
+		name     string
+		b        []byte
+		version  int
+		sequence uint32
+		wantErr  bool
+	}{
+		{"too short", []byte{0, 0, 1}, 0, 0, true},
+		{"version 1 sequence only", []byte{0, 0, 1, 0}, PacketV1, 256, false},
+		// The magic alone is not enough; a truncated version 2 packet reads
+		// as version 1
+		{"truncated version 2", v2[:PacketV2Len-1], PacketV1, packetMagic, false},
+		{"version 2", v2, PacketV2, 5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePacket(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePacket error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Version != tt.version || got.Sequence != tt.sequence {
+				t.Errorf("got version %d sequence %d, want %d and %d", got.Version, got.Sequence, tt.version, tt.sequence)
+			}
+		})
+	}
+}
+
+func TestReflectPacket(t *testing.T) {
+	t1 := time.Unix(1700000000, 0)
+	recv := t1.Add(time.Millisecond)
+	send := recv.Add(20 * time.Microsecond)
+
+	b := make([]byte, 48)
+	(&Packet{Version: PacketV2, Sequence: 9, T1: t1}).Marshal(b)
+	for i := PacketV2Len; i < len(b); i++ {
+		b[i] = 0xaa
+	}
+	if !ReflectPacket(b, recv, send) {
+		t.Fatal("ReflectPacket returned false for a version 2 packet")
+	}
+	got, err := ParsePacket(b)
+	if err != nil {
+		t.Fatalf("ParsePacket: %v", err)
+	}
+	if !got.Reflected || got.Sequence != 9 || !got.T1.Equal(t1) || !got.T2.Equal(recv) || !got.T3.Equal(send) {
+		t.Errorf("got %+v, want sequence 9 reflected with T1 %v, T2 %v, T3 %v", got, t1, recv, send)
+	}
+	if !bytes.Equal(b[PacketV2Len:], bytes.Repeat([]byte{0xaa}, len(b)-PacketV2Len)) {
+		t.Error("padding was modified")
+	}
+
+	v1 := make([]byte, 32)
+	(&Packet{Version: PacketV1, Sequence: 9, T1: t1}).Marshal(v1)
+	before := append([]byte(nil), v1...)
+	if ReflectPacket(v1, recv, send) {
+		t.Error("ReflectPacket returned true for a version 1 packet")
+	}
+	if !bytes.Equal(v1, before) {
+		t.Error("version 1 packet was modified")
+	}
+}
@@ -0,0 +1,243 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// ErrorClass categorizes why a probe failed
+type ErrorClass string
+
+// Error classes shared by all probers
+const (
+	ErrorNone    ErrorClass = ""        // Probe succeeded
+	ErrorSend    ErrorClass = "send"    // Request could not be sent
+	ErrorReceive ErrorClass = "receive" // Reply could not be read
+	ErrorTimeout ErrorClass = "timeout" // No reply before the deadline
+	ErrorRefused ErrorClass = "refused" // Target actively refused the probe
+	ErrorReset   ErrorClass = "reset"   // Connection was reset by the peer
+	ErrorResolve ErrorClass = "resolve" // Target name could not be resolved
+	ErrorStatus  ErrorClass = "status"  // Server answered with an error status
+
+	ErrorUnreachable  ErrorClass = "unreachable"   // ICMP destination unreachable received
+	ErrorTimeExceeded ErrorClass = "time-exceeded" // ICMP time exceeded received
+	ErrorTooBig       ErrorClass = "too-big"       // Probe exceeded the path MTU with don't fragment set
+
+	ErrorNXDomain  ErrorClass = "nxdomain"  // DNS name does not exist
+	ErrorServFail  ErrorClass = "servfail"  // DNS server failure
+	ErrorTruncated ErrorClass = "truncated" // DNS response truncated (TC bit set)
+)
+
+// Result holds the outcome of a single probe, independent of probe type
+type Result struct {
+	Sequence   int           // Probe sequence number (starting at 1)
+	SendTime   time.Time     // When the request was sent
+	RecvTime   time.Time     // When the reply was received (zero if none)
+	RTT        time.Duration // Round-trip time (zero if failed)
+	Bytes      int           // Reply size in bytes
+	Success    bool          // Whether a valid reply was received
+	Reordered  bool          // Reply arrived after the reply to a later probe
+	ErrorClass ErrorClass    // Failure category (ErrorNone on success)
+	Error      error         // Underlying error, if any
+
+	// ReflectorRecv and ReflectorSend are the reflector's receive (T2) and
+	// transmit (T3) times, on the reflector's clock. They are zero unless
+	// the reply carried them.
+	ReflectorRecv time.Time
+	ReflectorSend time.Time
+
+	// Phases holds per-phase timings for probes made of several steps,
+	// such as HTTP requests. It is nil for single-step probes.
+	Phases map[Phase]time.Duration
+}
+
+// Phase names a timed step within a probe
+type Phase string
+
+// Phases recorded by multi-step probes
+const (
+	PhaseDNS     Phase = "dns"     // Name resolution
+	PhaseConnect Phase = "connect" // TCP handshake
+	PhaseTLS     Phase = "tls"     // TLS handshake
+	PhaseTTFB    Phase = "ttfb"    // Request start to first response byte
+	PhaseTotal   Phase = "total"   // Request start to end of response body
+)
+
+// phaseOrder lists phases in the order they occur within a probe
+var phaseOrder = []Phase{PhaseDNS, PhaseConnect, PhaseTLS, PhaseTTFB, PhaseTotal}
+
+// Title returns a human-readable phase name
+func (ph Phase) Title() string {
+	switch ph {
+	case PhaseDNS:
+		return "DNS"
+	case PhaseConnect:
+		return "Connect"
+	case PhaseTLS:
+		return "TLS Handshake"
+	case PhaseTTFB:
+		return "Time to First Byte"
+	case PhaseTotal:
+		return "Total"
+	}
+	return string(ph)
+}
+
+// RecordedPhases returns the phases recorded by any successful result, in
+// the order they occur
+func RecordedPhases(results []Result) []Phase {
+	var phases []Phase
+	for _, phase := range phaseOrder {
+		if len(PhaseDurations(results, phase)) > 0 {
+			phases = append(phases, phase)
+		}
+	}
+	return phases
+}
+
+// PhaseDurations extracts the timings of one phase from successful results
+func PhaseDurations(results []Result, phase Phase) []time.Duration {
+	var durations []time.Duration
+	for _, r := range results {
+		if d, ok := r.Phases[phase]; ok && r.Success {
+			durations = append(durations, d)
+		}
+	}
+	return durations
+}
+
+// ReplyStats counts replies that could not be matched one-to-one with an
+// outstanding probe
+type ReplyStats struct {
+	Late      int // Replies that arrived after their probe timed out
+	Duplicate int // Extra replies for an already answered probe
+	Reordered int // Replies that arrived after the reply to a later probe
+	Unmatched int // Replies with an unknown or malformed sequence number
+}
+
+// ReplyReporter is implemented by probers that track reply anomalies
+type ReplyReporter interface {
+	ReplyStats() ReplyStats
+}
+
+// SocketModeReporter is implemented by probers that can run over more than
+// one kind of socket and report which one was used
+type SocketModeReporter interface {
+	SocketMode() string
+}
+
+// TimestampSource names where probe send and receive times come from
+type TimestampSource string
+
+// Timestamp sources, from least to most precise
+const (
+	// TimestampUserspace uses time.Now() around socket calls, which
+	// includes scheduler and GC delays
+	TimestampUserspace TimestampSource = "userspace"
+
+	// TimestampKernelRX uses kernel receive timestamps (SO_TIMESTAMPNS)
+	// with userspace send times
+	TimestampKernelRX TimestampSource = "kernel-rx"
+
+	// TimestampKernel uses kernel receive timestamps and software transmit
+	// timestamps (SO_TIMESTAMPING) where the kernel reported one
+	TimestampKernel TimestampSource = "kernel"
+)
+
+// TimestampReporter is implemented by probers that can take RTTs from
+// kernel timestamps and report which source was used
+type TimestampReporter interface {
+	TimestampSource() string
+}
+
+// ResultHandler receives each probe result as soon as it completes
+type ResultHandler func(Result)
+
+// Prober is implemented by every probe type so that results can flow
+// through the same stats, detect and output pipeline
+type Prober interface {
+	// Probe sends the configured number of probes and returns one
+	// result per probe, in completion order
+	Probe() ([]Result, error)
+
+	// ProbeContext is like Probe but stops when ctx is cancelled,
+	// returning the results gathered so far along with ctx.Err()
+	ProbeContext(ctx context.Context) ([]Result, error)
+
+	// ProbeStream passes each result to handler as it completes and
+	// returns ctx.Err() if ctx is cancelled before all probes finish
+	ProbeStream(ctx context.Context, handler ResultHandler) error
+}
+
+// collect runs a streaming probe and gathers its results into a slice
+func collect(ctx context.Context, count int, stream func(context.Context, ResultHandler) error) ([]Result, error) {
+	results := make([]Result, 0, count)
+	err := stream(ctx, func(r Result) {
+		results = append(results, r)
+	})
+	return results, err
+}
+
+// ipNetwork appends the IP version to a network name, e.g. "udp" becomes
+// "udp6" for version 6. Version 0 leaves the choice to the resolver.
+func ipNetwork(network string, version int) string {
+	switch version {
+	case 4:
+		return network + "4"
+	case 6:
+		return network + "6"
+	}
+	return network
+}
+
+// sleepContext waits for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// SuccessfulRTTs extracts the RTTs of successful probes and counts failures
+func SuccessfulRTTs(results []Result) ([]time.Duration, int) {
+	rtts := make([]time.Duration, 0, len(results))
+	failures := 0
+
+	for _, r := range results {
+		if r.Success {
+			rtts = append(rtts, r.RTT)
+		} else {
+			failures++
+		}
+	}
+
+	return rtts, failures
+}
+
+// classifyError maps a receive error to an error class
+func classifyError(err error) ErrorClass {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return ErrorTimeout
+	}
+	return ErrorReceive
+}
+
+// setDontFragment enables DF on a socket before it is used
+func setDontFragment(c syscall.RawConn, v6 bool) error {
+	var sockErr error
+	if err := c.Control(func(fd uintptr) {
+		sockErr = dontFragment(fd, v6)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,282 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/ErturkCan/netprobe/internal"
+)
+
+// STAMP constants (RFC 8762)
+const (
+	STAMPPort      = 862 // Well-known port of STAMP and TWAMP session-reflectors
+	STAMPPacketLen = 44  // Size of unauthenticated test packets
+)
+
+// Error estimate fields (RFC 4656 section 4.1.2)
+const (
+	ErrorEstimateSync = 1 << 15 // S bit: the clock is synchronized to UTC
+	ErrorEstimatePTP  = 1 << 14 // Z bit: timestamps use the PTP rather than the NTP format
+)
+
+// stampErrorEstimate claims an unsynchronized NTP-format clock accurate to
+// about a microsecond: multiplier 134 times 2^5 units of 2^-32 seconds
+const stampErrorEstimate = 5<<8 | 134
+
+var errShortSTAMP = errors.New("STAMP packet too short")
+
+// STAMPSenderPacket is an unauthenticated session-sender test packet
+// (RFC 8762 section 4.2.1):
+//
+//	Bytes 0-3:   Sequence number
+//	Bytes 4-11:  Timestamp
+//	Bytes 12-13: Error estimate
+//	Bytes 14-43: Must be zero
+type STAMPSenderPacket struct {
+	Sequence      uint32    // Sender sequence number
+	Timestamp     time.Time // Sender transmit time (T1)
+	ErrorEstimate uint16    // Sender clock error estimate and timestamp format
+}
+
+// Marshal encodes the packet into b, which must hold at least
+// STAMPPacketLen bytes; the must-be-zero bytes are cleared
+func (p *STAMPSenderPacket) Marshal(b []byte) error {
+	if len(b) < STAMPPacketLen {
+		return errShortSTAMP
+	}
+	p.encode(b)
+	clear(b[senderHeaderLen:STAMPPacketLen])
+	return nil
+}
+
+// ParseSTAMPSenderPacket decodes a session-sender test packet
+func ParseSTAMPSenderPacket(b []byte) (STAMPSenderPacket, error) {
+	if len(b) < STAMPPacketLen {
+		return STAMPSenderPacket{}, errShortSTAMP
+	}
+	return decodeSender(b), nil
+}
+
+// senderHeaderLen is the size of the fields STAMP and TWAMP-Test sender
+// packets have in common
+const senderHeaderLen = 14
+
+// encode writes the common sender fields to the first senderHeaderLen bytes of b
+func (p *STAMPSenderPacket) encode(b []byte) {
+	binary.BigEndian.PutUint32(b[0:4], p.Sequence)
+	putSTAMPTime(b[4:12], p.Timestamp, p.ErrorEstimate)
+	binary.BigEndian.PutUint16(b[12:14], p.ErrorEstimate)
+}
+
+// decodeSender reads the common sender fields from the first
+// senderHeaderLen bytes of b
+func decodeSender(b []byte) STAMPSenderPacket {
+	errorEstimate := binary.BigEndian.Uint16(b[12:14])
+	return STAMPSenderPacket{
+		Sequence:      binary.BigEndian.Uint32(b[0:4]),
+		Timestamp:     getSTAMPTime(b[4:12], errorEstimate),
+		ErrorEstimate: errorEstimate,
+	}
+}
+
+// STAMPReflectorPacket is an unauthenticated session-reflector test packet
+// (RFC 8762 section 4.3.1):
+//
+//	Bytes 0-3:   Sequence number
+//	Bytes 4-11:  Timestamp
+//	Bytes 12-13: Error estimate
+//	Bytes 14-15: Must be zero
+//	Bytes 16-23: Receive timestamp
+//	Bytes 24-27: Session-sender sequence number
+//	Bytes 28-35: Session-sender timestamp
+//	Bytes 36-37: Session-sender error estimate
+//	Bytes 38-39: Must be zero
+//	Byte 40:     Session-sender TTL
+//	Bytes 41-43: Must be zero
+type STAMPReflectorPacket struct {
+	Sequence            uint32    // Reflector sequence number, the sender's in stateless mode
+	Timestamp           time.Time // Reflector transmit time (T3)
+	ErrorEstimate       uint16    // Reflector clock error estimate and timestamp format
+	ReceiveTimestamp    time.Time // Reflector receive time (T2)
+	SenderSequence      uint32    // Sequence number of the reflected packet
+	SenderTimestamp     time.Time // Timestamp of the reflected packet (T1)
+	SenderErrorEstimate uint16    // Error estimate of the reflected packet
+	SenderTTL           uint8     // TTL or hop limit the reflected packet arrived with
+}
+
+// NewSTAMPReflectorPacket builds a stateless reflector's answer to a sender
+// packet received at recv with the given TTL. The transmit timestamp is
+// left for the caller to set as late as possible.
+func NewSTAMPReflectorPacket(request STAMPSenderPacket, recv time.Time, ttl int) STAMPReflectorPacket {
+	return STAMPReflectorPacket{
+		Sequence:            request.Sequence,
+		ErrorEstimate:       stampErrorEstimate,
+		ReceiveTimestamp:    recv,
+		SenderSequence:      request.Sequence,
+		SenderTimestamp:     request.Timestamp,
+		SenderErrorEstimate: request.ErrorEstimate,
+		SenderTTL:           uint8(ttl),
+	}
+}
+
+// Marshal encodes the packet into b, which must hold at least
+// STAMPPacketLen bytes; the must-be-zero bytes are cleared
+func (p *STAMPReflectorPacket) Marshal(b []byte) error {
+	if len(b) < STAMPPacketLen {
+		return errShortSTAMP
+	}
+	p.encode(b)
+	clear(b[reflectorHeaderLen:STAMPPacketLen])
+	return nil
+}
+
+// ParseSTAMPReflectorPacket decodes a session-reflector test packet
+func ParseSTAMPReflectorPacket(b []byte) (STAMPReflectorPacket, error) {
+	if len(b) < STAMPPacketLen {
+		return STAMPReflectorPacket{}, errShortSTAMP
+	}
+	return decodeReflector(b), nil
+}
+
+// reflectorHeaderLen is the size of the fields STAMP and TWAMP-Test
+// reflector packets have in common
+const reflectorHeaderLen = 41
+
+// encode writes the common reflector fields, including the must-be-zero
+// bytes between them, to the first reflectorHeaderLen bytes of b
+func (p *STAMPReflectorPacket) encode(b []byte) {
+	clear(b[:reflectorHeaderLen])
+	binary.BigEndian.PutUint32(b[0:4], p.Sequence)
+	putSTAMPTime(b[4:12], p.Timestamp, p.ErrorEstimate)
+	binary.BigEndian.PutUint16(b[12:14], p.ErrorEstimate)
+	putSTAMPTime(b[16:24], p.ReceiveTimestamp, p.ErrorEstimate)
+	binary.BigEndian.PutUint32(b[24:28], p.SenderSequence)
+	putSTAMPTime(b[28:36], p.SenderTimestamp, p.SenderErrorEstimate)
+	binary.BigEndian.PutUint16(b[36:38], p.SenderErrorEstimate)
+	b[40] = p.SenderTTL
+}
+
+// decodeReflector reads the common reflector fields from the first
+// reflectorHeaderLen bytes of b
+func decodeReflector(b []byte) STAMPReflectorPacket {
+	errorEstimate := binary.BigEndian.Uint16(b[12:14])
+	senderErrorEstimate := binary.BigEndian.Uint16(b[36:38])
+	return STAMPReflectorPacket{
+		Sequence:            binary.BigEndian.Uint32(b[0:4]),
+		Timestamp:           getSTAMPTime(b[4:12], errorEstimate),
+		ErrorEstimate:       errorEstimate,
+		ReceiveTimestamp:    getSTAMPTime(b[16:24], errorEstimate),
+		SenderSequence:      binary.BigEndian.Uint32(b[24:28]),
+		SenderTimestamp:     getSTAMPTime(b[28:36], senderErrorEstimate),
+		SenderErrorEstimate: senderErrorEstimate,
+		SenderTTL:           b[40],
+	}
+}
+
+// putSTAMPTime encodes t in the NTP or PTP format selected by the Z bit of
+// an error estimate
+func putSTAMPTime(b []byte, t time.Time, errorEstimate uint16) {
+	if errorEstimate&ErrorEstimatePTP == 0 {
+		binary.BigEndian.PutUint64(b, internal.NTPTimestamp(t))
+		return
+	}
+	var secs, nanos uint32
+	if !t.IsZero() {
+		secs, nanos = uint32(t.Unix()), uint32(t.Nanosecond())
+	}
+	binary.BigEndian.PutUint32(b[0:4], secs)
+	binary.BigEndian.PutUint32(b[4:8], nanos)
+}
+
+// getSTAMPTime decodes a timestamp in the format selected by the Z bit of an
+// error estimate
+func getSTAMPTime(b []byte, errorEstimate uint16) time.Time {
+	if errorEstimate&ErrorEstimatePTP == 0 {
+		return internal.FromNTPTimestamp(binary.BigEndian.Uint64(b))
+	}
+	secs, nanos := binary.BigEndian.Uint32(b[0:4]), binary.BigEndian.Uint32(b[4:8])
+	if secs == 0 && nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(secs), int64(nanos))
+}
+
+// STAMPProbeConfig holds configuration for STAMP probes
+type STAMPProbeConfig struct {
+	Target    string        // Session-reflector host or IP
+	Port      int           // Session-reflector port (default 862)
+	Count     int           // Number of probes to send
+	Interval  time.Duration // Time between probes
+	Timeout   time.Duration // Per-probe timeout for responses
+	IPVersion int           // IP version to use: 4, 6 or 0 for either
+	TTL       int           // IPv4 TTL or IPv6 hop limit of probes (0 for the system default)
+
+	KernelTimestamps bool // Take RTTs from kernel socket timestamps (Linux only)
+}
+
+// STAMPProber is an unauthenticated STAMP session-sender (RFC 8762). It
+// sends 44-byte test packets with NTP timestamps to any STAMP or TWAMP-Light
+// session-reflector, pipelined like UDPProber. The reflector's receive and
+// transmit timestamps are kept in each result, so OneWay can split the
+// round trip into forward, reverse and processing time.
+type STAMPProber struct {
+	*UDPProber
+}
+
+var (
+	_ Prober            = (*STAMPProber)(nil)
+	_ ReplyReporter     = (*STAMPProber)(nil)
+	_ TimestampReporter = (*STAMPProber)(nil)
+)
+
+// NewSTAMPProber creates a new STAMP session-sender
+func NewSTAMPProber(config STAMPProbeConfig) *STAMPProber {
+	if config.Port == 0 {
+		config.Port = STAMPPort
+	}
+
+	return &STAMPProber{UDPProber: newUDPProber(UDPProbeConfig{
+		Target:           config.Target,
+		Port:             config.Port,
+		Count:            config.Count,
+		Interval:         config.Interval,
+		Timeout:          config.Timeout,
+		IPVersion:        config.IPVersion,
+		TTL:              config.TTL,
+		KernelTimestamps: config.KernelTimestamps,
+	}, stampFormat{})}
+}
+
+// stampFormat speaks unauthenticated STAMP
+type stampFormat struct{}
+
+func (stampFormat) minSize() int {
+	return STAMPPacketLen
+}
+
+func (stampFormat) marshal(b []byte, sequence uint32, sendTime time.Time) error {
+	packet := STAMPSenderPacket{Sequence: sequence, Timestamp: sendTime, ErrorEstimate: stampErrorEstimate}
+	return packet.Marshal(b)
+}
+
+// parse matches replies by the reflected sender sequence number, since a
+// stateful reflector numbers its own packets independently
+func (stampFormat) parse(b []byte) (udpReply, error) {
+	packet, err := ParseSTAMPReflectorPacket(b)
+	if err != nil {
+		return udpReply{}, err
+	}
+	return udpReply{
+		sequence:      packet.SenderSequence,
+		reflectorRecv: packet.ReceiveTimestamp,
+		reflectorSend: packet.Timestamp,
+	}, nil
+}
+
+func (stampFormat) quotedSequence(b []byte) (uint32, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(b[0:4]), true
+}
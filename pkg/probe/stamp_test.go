@@ -0,0 +1,197 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// dirty returns n bytes of 0xff, so tests can tell which bytes Marshal
+// clears
+func dirty(n int) []byte {
+	return bytes.Repeat([]byte{0xff}, n)
+}
+
+func TestSTAMPSenderPacket(t *testing.T) {
+	era1 := time.Date(2036, time.February, 7, 6, 28, 16, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		packet STAMPSenderPacket
+		stamp  uint64 // Expected bytes 4-11
+	}{
+		{
+			name:   "NTP",
+			packet: STAMPSenderPacket{Sequence: 0x01020304, Timestamp: time.Unix(0, 500000000), ErrorEstimate: stampErrorEstimate},
+			stamp:  2208988800<<32 | 1<<31,
+		},
+		{
+			name:   "NTP era 1",
+			packet: STAMPSenderPacket{Sequence: 7, Timestamp: era1.Add(2 * time.Second), ErrorEstimate: stampErrorEstimate},
+			stamp:  2 << 32,
+		},
+		{
+			name:   "PTP",
+			packet: STAMPSenderPacket{Sequence: 7, Timestamp: time.Unix(1700000000, 123456789), ErrorEstimate: ErrorEstimateSync | ErrorEstimatePTP | 1},
+			stamp:  1700000000<<32 | 123456789,
+		},
+		{
+			name:   "no timestamp",
+			packet: STAMPSenderPacket{Sequence: 7, ErrorEstimate: stampErrorEstimate},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := dirty(STAMPPacketLen + 4)
+			if err := tt.packet.Marshal(b); err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if got := binary.BigEndian.Uint32(b[0:4]); got != tt.packet.Sequence {
+				t.Errorf("sequence bytes = %#x, want %#x", got, tt.packet.Sequence)
+			}
+			if got := binary.BigEndian.Uint64(b[4:12]); got != tt.stamp {
+				t.Errorf("timestamp bytes = %#x, want %#x", got, tt.stamp)
+			}
+			if got := binary.BigEndian.Uint16(b[12:14]); got != tt.packet.ErrorEstimate {
+				t.Errorf("error estimate bytes = %#x, want %#x", got, tt.packet.ErrorEstimate)
+			}
+			if !bytes.Equal(b[14:STAMPPacketLen], make([]byte, STAMPPacketLen-14)) {
+				t.Errorf("must-be-zero bytes = %x", b[14:STAMPPacketLen])
+			}
+			if !bytes.Equal(b[STAMPPacketLen:], dirty(4)) {
+				t.Error("bytes past the packet were modified")
+			}
+
+			got, err := ParseSTAMPSenderPacket(b)
+			if err != nil {
+				t.Fatalf("ParseSTAMPSenderPacket: %v", err)
+			}
+			if got.Sequence != tt.packet.Sequence || got.ErrorEstimate != tt.packet.ErrorEstimate || !got.Timestamp.Equal(tt.packet.Timestamp) {
+				t.Errorf("got %+v, want %+v", got, tt.packet)
+			}
+		})
+	}
+}
+
+func TestSTAMPErrorEstimate(t *testing.T) {
+	// S clear, Z clear, scale 5, multiplier 134: 134 * 2^5 * 2^-32 seconds
+	if stampErrorEstimate&(ErrorEstimateSync|ErrorEstimatePTP) != 0 {
+		t.Errorf("error estimate %#x claims a synchronized or PTP clock", stampErrorEstimate)
+	}
+	scale, multiplier := stampErrorEstimate>>8&0x3f, stampErrorEstimate&0xff
+	if scale != 5 || multiplier != 134 {
+		t.Errorf("scale %d, multiplier %d; want 5 and 134", scale, multiplier)
+	}
+	seconds := float64(multiplier) * float64(uint64(1)<<scale) / (1 << 32)
+	if seconds < 0.9e-6 || seconds > 1.1e-6 {
+		t.Errorf("error estimate of %gs, want about 1µs", seconds)
+	}
+
+	b := make([]byte, STAMPPacketLen)
+	if err := (stampFormat{}).marshal(b, 1, time.Now()); err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if got := binary.BigEndian.Uint16(b[12:14]); got != stampErrorEstimate {
+		t.Errorf("session-sender error estimate = %#x, want %#x", got, stampErrorEstimate)
+	}
+}
+
+func TestSTAMPReflectorPacket(t *testing.T) {
+	era1 := time.Date(2036, time.February, 7, 6, 28, 16, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		sender STAMPSenderPacket
+		recv   time.Time
+	}{
+		{
+			name:   "NTP",
+			sender: STAMPSenderPacket{Sequence: 42, Timestamp: time.Unix(1700000000, 1000), ErrorEstimate: stampErrorEstimate},
+			recv:   time.Unix(1700000000, 2001000),
+		},
+		{
+			// Sent in the last second of NTP era 0, reflected in era 1
+			name:   "across the NTP era boundary",
+			sender: STAMPSenderPacket{Sequence: 42, Timestamp: era1.Add(-time.Millisecond), ErrorEstimate: stampErrorEstimate},
+			recv:   era1.Add(time.Millisecond),
+		},
+		{
+			// The reflected fields keep the sender's PTP format while the
+			// reflector's own use NTP
+			name:   "PTP sender",
+			sender: STAMPSenderPacket{Sequence: 42, Timestamp: time.Unix(1700000000, 1000), ErrorEstimate: ErrorEstimateSync | ErrorEstimatePTP},
+			recv:   time.Unix(1700000000, 2001000),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := NewSTAMPReflectorPacket(tt.sender, tt.recv, 63)
+			packet.Timestamp = tt.recv.Add(50 * time.Microsecond)
+
+			b := dirty(STAMPPacketLen)
+			if err := packet.Marshal(b); err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			for _, mbz := range [][2]int{{14, 16}, {38, 40}, {41, 44}} {
+				if !bytes.Equal(b[mbz[0]:mbz[1]], make([]byte, mbz[1]-mbz[0])) {
+					t.Errorf("must-be-zero bytes %d-%d = %x", mbz[0], mbz[1]-1, b[mbz[0]:mbz[1]])
+				}
+			}
+			if b[40] != 63 {
+				t.Errorf("TTL byte = %d, want 63", b[40])
+			}
+			if got := binary.BigEndian.Uint16(b[36:38]); got != tt.sender.ErrorEstimate {
+				t.Errorf("sender error estimate bytes = %#x, want %#x", got, tt.sender.ErrorEstimate)
+			}
+
+			got, err := ParseSTAMPReflectorPacket(b)
+			if err != nil {
+				t.Fatalf("ParseSTAMPReflectorPacket: %v", err)
+			}
+			if got.Sequence != 42 || got.SenderSequence != 42 || got.SenderTTL != 63 ||
+				got.ErrorEstimate != stampErrorEstimate || got.SenderErrorEstimate != tt.sender.ErrorEstimate {
+				t.Errorf("got %+v, want %+v", got, packet)
+			}
+			for _, ts := range []struct {
+				name      string
+				got, want time.Time
+			}{
+				{"Timestamp", got.Timestamp, packet.Timestamp},
+				{"ReceiveTimestamp", got.ReceiveTimestamp, tt.recv},
+				{"SenderTimestamp", got.SenderTimestamp, tt.sender.Timestamp},
+			} {
+				if !ts.got.Equal(ts.want) {
+					t.Errorf("%s = %v, want %v", ts.name, ts.got, ts.want)
+				}
+			}
+
+			reply, err := (stampFormat{}).parse(b)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if reply.sequence != 42 || !reply.reflectorRecv.Equal(tt.recv) || !reply.reflectorSend.Equal(packet.Timestamp) {
+				t.Errorf("parse = %+v, want sequence 42 with T2 %v and T3 %v", reply, tt.recv, packet.Timestamp)
+			}
+		})
+	}
+}
+
+func TestSTAMPShortPackets(t *testing.T) {
+	short := make([]byte, STAMPPacketLen-1)
+	if err := (&STAMPSenderPacket{}).Marshal(short); !errors.Is(err, errShortSTAMP) {
+		t.Errorf("sender Marshal = %v, want %v", err, errShortSTAMP)
+	}
+	if err := (&STAMPReflectorPacket{}).Marshal(short); !errors.Is(err, errShortSTAMP) {
+		t.Errorf("reflector Marshal = %v, want %v", err, errShortSTAMP)
+	}
+	if _, err := ParseSTAMPSenderPacket(short); !errors.Is(err, errShortSTAMP) {
+		t.Errorf("ParseSTAMPSenderPacket = %v, want %v", err, errShortSTAMP)
+	}
+	if _, err := ParseSTAMPReflectorPacket(short); !errors.Is(err, errShortSTAMP) {
+		t.Errorf("ParseSTAMPReflectorPacket = %v, want %v", err, errShortSTAMP)
+	}
+}
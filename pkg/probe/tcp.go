@@ -0,0 +1,126 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// TCPProbeConfig holds configuration for TCP connect probes
+type TCPProbeConfig struct {
+	Target    string        // Target host or IP
+	Port      int           // Target port
+	Count     int           // Number of probes to send
+	Interval  time.Duration // Time between probes
+	Timeout   time.Duration // Timeout for the handshake
+	IPVersion int           // IP version to use: 4, 6 or 0 for either
+}
+
+// TCPProber measures TCP three-way handshake latency. Each probe opens a
+// new connection and closes it as soon as the handshake completes.
+type TCPProber struct {
+	config TCPProbeConfig
+}
+
+var _ Prober = (*TCPProber)(nil)
+
+// NewTCPProber creates a new TCP connect prober
+func NewTCPProber(config TCPProbeConfig) *TCPProber {
+	if config.Count == 0 {
+		config.Count = 10
+	}
+	if config.Port == 0 {
+		config.Port = 80
+	}
+	if config.Interval == 0 {
+		config.Interval = 1 * time.Second
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 3 * time.Second
+	}
+
+	return &TCPProber{config: config}
+}
+
+// Probe performs a series of TCP connect probes
+func (p *TCPProber) Probe() ([]Result, error) {
+	return p.ProbeContext(context.Background())
+}
+
+// ProbeContext performs a series of TCP connect probes until done or ctx is
+// cancelled, in which case the results gathered so far are returned with ctx.Err()
+func (p *TCPProber) ProbeContext(ctx context.Context) ([]Result, error) {
+	return collect(ctx, p.config.Count, p.ProbeStream)
+}
+
+// ProbeStream performs a series of TCP connect probes, passing each result
+// to handler as soon as it completes
+func (p *TCPProber) ProbeStream(ctx context.Context, handler ResultHandler) error {
+	// Resolve once up front so name lookups are not part of the RTT
+	network := ipNetwork("tcp", p.config.IPVersion)
+	addr, err := net.ResolveTCPAddr(network, net.JoinHostPort(p.config.Target, strconv.Itoa(p.config.Port)))
+	if err != nil {
+		return fmt.Errorf("failed to resolve address: %w", err)
+	}
+
+	// Send probes
+	for i := 0; i < p.config.Count; i++ {
+		if i > 0 {
+			if err := sleepContext(ctx, p.config.Interval); err != nil {
+				return err
+			}
+		}
+
+		result := p.sendProbe(ctx, network, addr, i+1)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		handler(result)
+	}
+
+	return nil
+}
+
+// sendProbe opens a single TCP connection and measures the handshake time
+func (p *TCPProber) sendProbe(ctx context.Context, network string, addr *net.TCPAddr, sequence int) Result {
+	result := Result{
+		Sequence: sequence,
+	}
+
+	dialer := net.Dialer{Timeout: p.config.Timeout}
+
+	result.SendTime = time.Now()
+	conn, err := dialer.DialContext(ctx, network, addr.String())
+	if err != nil {
+		result.ErrorClass = classifyDialError(err)
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		return result
+	}
+	result.RecvTime = time.Now()
+	conn.Close()
+
+	result.RTT = result.RecvTime.Sub(result.SendTime)
+	result.Success = true
+
+	return result
+}
+
+// classifyDialError maps a connect error to an error class
+func classifyDialError(err error) ErrorClass {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return ErrorResolve
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return ErrorReset
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return ErrorUnreachable
+	}
+	return classifyError(err)
+}
@@ -0,0 +1,119 @@
+package probe
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// closedPort returns a loopback TCP port with nothing listening on it
+func closedPort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+func TestTCPProber(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	open := ln.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name    string
+		port    int
+		timeout time.Duration
+		class   ErrorClass
+	}{
+		{"connected", open, time.Second, ErrorNone},
+		{"refused", closedPort(t), time.Second, ErrorRefused},
+		// The deadline has passed before the handshake can start
+		{"timeout", open, time.Nanosecond, ErrorTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prober := NewTCPProber(TCPProbeConfig{
+				Target:   "127.0.0.1",
+				Port:     tt.port,
+				Count:    2,
+				Interval: 10 * time.Millisecond,
+				Timeout:  tt.timeout,
+			})
+			results, err := prober.Probe()
+			if err != nil {
+				t.Fatalf("Probe: %v", err)
+			}
+			if len(results) != 2 {
+				t.Fatalf("got %d results, want 2", len(results))
+			}
+			for i, r := range results {
+				if r.Sequence != i+1 {
+					t.Errorf("result %d: sequence %d", i, r.Sequence)
+				}
+				if r.ErrorClass != tt.class {
+					t.Errorf("probe %d: class %q, want %q (%v)", r.Sequence, r.ErrorClass, tt.class, r.Error)
+				}
+				if r.Success != (tt.class == ErrorNone) {
+					t.Errorf("probe %d: success %v", r.Sequence, r.Success)
+				}
+				if r.Success && r.RTT <= 0 {
+					t.Errorf("probe %d: RTT %v, want > 0", r.Sequence, r.RTT)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyDialErrorReset(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	// Abort every connection: closing with a zero linger sends a RST
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+	}()
+
+	// Depending on timing the reset surfaces on connect or on the first read
+	conn, err := net.Dial("tcp4", ln.Addr().String())
+	if err == nil {
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+	}
+	if got := classifyDialError(err); got != ErrorReset {
+		t.Fatalf("classifyDialError(%v) = %q, want %q", err, got, ErrorReset)
+	}
+}
+
+func TestClassifyDialErrorResolve(t *testing.T) {
+	err := &net.DNSError{Err: "no such host", Name: "invalid.", IsNotFound: true}
+	if got := classifyDialError(err); got != ErrorResolve {
+		t.Fatalf("classifyDialError(%v) = %q, want %q", err, got, ErrorResolve)
+	}
+}
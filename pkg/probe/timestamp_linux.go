@@ -0,0 +1,133 @@
+//go:build linux
+
+package probe
+
+import (
+	"encoding/binary"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// SO_TIMESTAMPING flags from linux/net_tstamp.h
+const (
+	sofTimestampingTxSoftware = 1 << 1
+	sofTimestampingSoftware   = 1 << 4
+	sofTimestampingOptID      = 1 << 7
+	sofTimestampingOptTSOnly  = 1 << 11
+
+	soEEOriginTimestamping = 4 // sock_extended_err origin of transmit timestamps
+)
+
+// enableTimestamps turns on SO_TIMESTAMPNS receive timestamps and, where
+// the kernel allows it, SO_TIMESTAMPING software transmit timestamps
+// tagged with a per-socket packet counter
+func enableTimestamps(c syscall.RawConn) (TimestampSource, error) {
+	source := TimestampUserspace
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_TIMESTAMPNS, 1); sockErr != nil {
+			return
+		}
+		source = TimestampKernelRX
+
+		flags := sofTimestampingTxSoftware | sofTimestampingSoftware | sofTimestampingOptID | sofTimestampingOptTSOnly
+		if syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_TIMESTAMPING, flags) == nil {
+			source = TimestampKernel
+		}
+	})
+	if err != nil {
+		return TimestampUserspace, err
+	}
+	return source, sockErr
+}
+
+// rxTimestamp extracts the kernel receive time from the control messages
+// of a received packet. With transmit timestamps enabled the kernel may
+// also report the receive time through SCM_TIMESTAMPING, which is used
+// when SCM_TIMESTAMPNS is missing.
+func rxTimestamp(oob []byte) (time.Time, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var fallback time.Time
+	haveFallback := false
+	for _, msg := range msgs {
+		if msg.Header.Level != syscall.SOL_SOCKET {
+			continue
+		}
+		switch msg.Header.Type {
+		case syscall.SCM_TIMESTAMPNS:
+			return parseTimespec(msg.Data)
+		case syscall.SCM_TIMESTAMPING:
+			// Three timespecs; the first is the software timestamp
+			fallback, haveFallback = parseTimespec(msg.Data)
+		}
+	}
+	return fallback, haveFallback
+}
+
+// readTxTimestamps drains transmit timestamps from the socket error queue
+// without blocking, returning them by packet counter
+func readTxTimestamps(c syscall.RawConn) map[uint32]time.Time {
+	stamps := make(map[uint32]time.Time)
+	buf := make([]byte, 64)
+	oob := make([]byte, 512)
+
+	c.Control(func(fd uintptr) {
+		for {
+			_, oobn, _, _, err := syscall.Recvmsg(int(fd), buf, oob, syscall.MSG_ERRQUEUE|syscall.MSG_DONTWAIT)
+			if err != nil {
+				return
+			}
+			if key, ts, ok := parseTxTimestamp(oob[:oobn]); ok {
+				stamps[key] = ts
+			}
+		}
+	})
+
+	return stamps
+}
+
+// parseTxTimestamp extracts the packet counter and software transmit time
+// from the control messages of an error queue message
+func parseTxTimestamp(oob []byte) (uint32, time.Time, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	var ts time.Time
+	var key uint32
+	haveTS, haveKey := false, false
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == syscall.SOL_SOCKET && msg.Header.Type == syscall.SCM_TIMESTAMPING:
+			// Three timespecs; the first is the software timestamp
+			ts, haveTS = parseTimespec(msg.Data)
+		case (msg.Header.Level == syscall.SOL_IP && msg.Header.Type == syscall.IP_RECVERR) ||
+			(msg.Header.Level == syscall.SOL_IPV6 && msg.Header.Type == syscall.IPV6_RECVERR):
+			// struct sock_extended_err: errno, origin, type, code, pad, info, data
+			if len(msg.Data) >= 16 && msg.Data[4] == soEEOriginTimestamping {
+				key = binary.NativeEndian.Uint32(msg.Data[12:16])
+				haveKey = true
+			}
+		}
+	}
+	return key, ts, haveTS && haveKey
+}
+
+// parseTimespec decodes a native struct timespec
+func parseTimespec(b []byte) (time.Time, bool) {
+	var ts syscall.Timespec
+	size := int(unsafe.Sizeof(ts))
+	if len(b) < size {
+		return time.Time{}, false
+	}
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&ts)), size), b)
+	if ts.Sec == 0 && ts.Nsec == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(ts.Sec), int64(ts.Nsec)), true
+}
@@ -0,0 +1,237 @@
+//go:build linux
+
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// cmsg encodes one control message as the kernel would
+func cmsg(level, typ int32, data []byte) []byte {
+	b := make([]byte, syscall.CmsgSpace(len(data)))
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level, h.Type = level, typ
+	h.SetLen(syscall.CmsgLen(len(data)))
+	copy(b[syscall.CmsgLen(0):], data)
+	return b
+}
+
+// timespecs encodes times as consecutive native struct timespecs, the zero
+// time as all zeros
+func timespecs(times ...time.Time) []byte {
+	var b []byte
+	for _, t := range times {
+		var ts syscall.Timespec
+		if !t.IsZero() {
+			ts = syscall.NsecToTimespec(t.UnixNano())
+		}
+		b = append(b, unsafe.Slice((*byte)(unsafe.Pointer(&ts)), unsafe.Sizeof(ts))...)
+	}
+	return b
+}
+
+// extendedErr encodes a struct sock_extended_err with the given origin and
+// ee_data
+func extendedErr(origin byte, data uint32) []byte {
+	b := make([]byte, 16)
+	binary.NativeEndian.PutUint32(b[0:4], uint32(syscall.ENOMSG))
+	b[4] = origin
+	binary.NativeEndian.PutUint32(b[12:16], data)
+	return b
+}
+
+// concat joins control messages into one buffer
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func TestRxTimestamp(t *testing.T) {
+	rx := time.Unix(1700000000, 123456789)
+	other := rx.Add(-time.Millisecond)
+	ttl := cmsg(syscall.SOL_IP, syscall.IP_TTL, []byte{64, 0, 0, 0})
+
+	tests := []struct {
+		name string
+		oob  []byte
+		want time.Time // Zero when no timestamp should be found
+	}{
+		{"SO_TIMESTAMPNS", cmsg(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPNS, timespecs(rx)), rx},
+		{"after another message", concat(ttl, cmsg(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPNS, timespecs(rx))), rx},
+		{"SO_TIMESTAMPING software", cmsg(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPING, timespecs(rx, time.Time{}, time.Time{})), rx},
+		{
+			name: "SO_TIMESTAMPNS preferred",
+			oob: concat(
+				cmsg(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPING, timespecs(other, time.Time{}, time.Time{})),
+				cmsg(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPNS, timespecs(rx)),
+			),
+			want: rx,
+		},
+		{"SO_TIMESTAMPING hardware only", cmsg(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPING, timespecs(time.Time{}, time.Time{}, rx)), time.Time{}},
+		{"no control messages", nil, time.Time{}},
+		{"no timestamp", ttl, time.Time{}},
+		{"zero timestamp", cmsg(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPNS, timespecs(time.Time{})), time.Time{}},
+		{"truncated timespec", cmsg(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPNS, timespecs(rx)[:8]), time.Time{}},
+		{"malformed", []byte{1, 2, 3}, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := rxTimestamp(tt.oob)
+			if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+				t.Errorf("rxTimestamp = %v, %v; want %v, %v", got, ok, tt.want, !tt.want.IsZero())
+			}
+		})
+	}
+}
+
+func TestParseTxTimestamp(t *testing.T) {
+	tx := time.Unix(1700000000, 987654321)
+	stamp := cmsg(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPING, timespecs(tx, time.Time{}, time.Time{}))
+
+	tests := []struct {
+		name    string
+		oob     []byte
+		wantKey uint32
+		wantOK  bool
+	}{
+		{"IPv4", concat(stamp, cmsg(syscall.SOL_IP, syscall.IP_RECVERR, extendedErr(soEEOriginTimestamping, 7))), 7, true},
+		{"IPv6", concat(cmsg(syscall.SOL_IPV6, syscall.IPV6_RECVERR, extendedErr(soEEOriginTimestamping, 1<<20)), stamp), 1 << 20, true},
+		{"ICMP error", concat(stamp, cmsg(syscall.SOL_IP, syscall.IP_RECVERR, extendedErr(2, 7))), 0, false},
+		{"no counter", stamp, 0, false},
+		{"no timestamp", cmsg(syscall.SOL_IP, syscall.IP_RECVERR, extendedErr(soEEOriginTimestamping, 7)), 0, false},
+		{"truncated error", concat(stamp, cmsg(syscall.SOL_IP, syscall.IP_RECVERR, extendedErr(soEEOriginTimestamping, 7)[:12])), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ts, ok := parseTxTimestamp(tt.oob)
+			if ok != tt.wantOK {
+				t.Fatalf("parseTxTimestamp ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (key != tt.wantKey || !ts.Equal(tx)) {
+				t.Errorf("parseTxTimestamp = %d, %v; want %d, %v", key, ts, tt.wantKey, tx)
+			}
+		})
+	}
+}
+
+// newTestSession returns a session with kernel transmit timestamps enabled
+// and the given probes in flight, sent at sendTime
+func newTestSession(t *testing.T, count int, sendTime time.Time, inflight ...uint32) (*udpSession, chan Result) {
+	t.Helper()
+
+	results := make(chan Result, count)
+	s := &udpSession{
+		prober:   NewUDPProber(UDPProbeConfig{Count: count, Interval: time.Millisecond, Timeout: time.Second}),
+		results:  results,
+		inflight: make(map[uint32]*udpInflight),
+		answered: make(map[uint32]bool),
+		expired:  make(map[uint32]bool),
+		txKeys:   make(map[uint32]uint32),
+	}
+	for _, seq := range inflight {
+		s.inflight[seq] = &udpInflight{
+			result: Result{Sequence: int(seq), SendTime: sendTime},
+			timer:  time.AfterFunc(time.Hour, func() {}),
+		}
+	}
+	t.Cleanup(s.stopTimers)
+	return s, results
+}
+
+func TestTxKeyPairing(t *testing.T) {
+	userspace := time.Unix(1700000000, 0)
+	recv := userspace.Add(10 * time.Millisecond)
+	kernel1, kernel2 := userspace.Add(time.Millisecond), userspace.Add(2*time.Millisecond)
+
+	// Probe 3 failed to send and took no key, so counters 0 and 1 belong to
+	// probes 1 and 2, and probe 4 expired before its timestamp was read
+	s, results := newTestSession(t, 4, userspace, 1, 2)
+	s.txKeys = map[uint32]uint32{0: 1, 1: 2, 2: 4}
+	s.sent = 3
+	s.expired[4] = true
+
+	s.match(udpReply{sequence: 1}, 64, recv, map[uint32]time.Time{
+		0: kernel1,
+		1: kernel2,
+		2: kernel2.Add(time.Millisecond),
+		9: kernel2, // Not ours
+	})
+
+	r := <-results
+	if r.Sequence != 1 || !r.SendTime.Equal(kernel1) || r.RTT != recv.Sub(kernel1) {
+		t.Errorf("probe %d: send time %v, RTT %v; want probe 1 sent %v, RTT %v", r.Sequence, r.SendTime, r.RTT, kernel1, recv.Sub(kernel1))
+	}
+	if got := s.inflight[2].result.SendTime; !got.Equal(kernel2) {
+		t.Errorf("probe 2 send time %v, want %v", got, kernel2)
+	}
+	if len(s.txKeys) != 0 {
+		t.Errorf("txKeys = %v after pairing, want empty", s.txKeys)
+	}
+
+	// Without a timestamp the userspace send time stays
+	s.match(udpReply{sequence: 2}, 64, recv, nil)
+	if r := <-results; !r.SendTime.Equal(kernel2) {
+		t.Errorf("probe 2: send time %v, want %v", r.SendTime, kernel2)
+	}
+}
+
+func TestTxKeyRollback(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen on udp4: %v", err)
+	}
+	// Every write fails, so no key may stay taken
+	conn.Close()
+
+	s, results := newTestSession(t, 3, time.Time{})
+	s.conn = conn
+	s.send(context.Background())
+
+	for i := 0; i < 3; i++ {
+		r := <-results
+		if r.ErrorClass != ErrorSend || !errors.Is(r.Error, net.ErrClosed) {
+			t.Errorf("probe %d: %v (%s), want a %s error", r.Sequence, r.Error, r.ErrorClass, ErrorSend)
+		}
+	}
+	if s.sent != 0 || len(s.txKeys) != 0 {
+		t.Errorf("sent = %d, txKeys = %v after failed sends; want 0 and empty", s.sent, s.txKeys)
+	}
+}
+
+func TestUDPProberKernelTimestamps(t *testing.T) {
+	port := startReflector(t, answerAll(nil), nil)
+	prober := NewUDPProber(UDPProbeConfig{
+		Target:           "127.0.0.1",
+		Port:             port,
+		Count:            5,
+		Interval:         10 * time.Millisecond,
+		Timeout:          time.Second,
+		IPVersion:        4,
+		KernelTimestamps: true,
+	})
+	results, err := prober.Probe()
+	if err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	if prober.TimestampSource() == string(TimestampUserspace) {
+		t.Skip("kernel timestamps are not available")
+	}
+	checkResults(t, results, 5)
+	for _, r := range results {
+		if r.RecvTime.Before(r.SendTime) {
+			t.Errorf("probe %d received at %v, before it was sent at %v", r.Sequence, r.RecvTime, r.SendTime)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package probe
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// enableTimestamps is only implemented on Linux
+func enableTimestamps(c syscall.RawConn) (TimestampSource, error) {
+	return TimestampUserspace, errors.New("kernel timestamps are not supported on this platform")
+}
+
+// rxTimestamp is only implemented on Linux
+func rxTimestamp(oob []byte) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// readTxTimestamps is only implemented on Linux
+func readTxTimestamps(c syscall.RawConn) map[uint32]time.Time {
+	return nil
+}
@@ -0,0 +1,262 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ErturkCan/netprobe/pkg/stats"
+)
+
+// Trace probe methods
+const (
+	TraceMethodICMP = "icmp"
+	TraceMethodUDP  = "udp"
+)
+
+// TraceConfig holds configuration for MTR-style path traces
+type TraceConfig struct {
+	Target    string        // Target host or IP
+	Method    string        // Probe method: "icmp" or "udp" (default icmp)
+	Port      int           // Destination port for UDP probes
+	MaxHops   int           // Highest TTL to probe
+	Rounds    int           // Number of probes sent to each hop
+	Interval  time.Duration // Time between rounds
+	Timeout   time.Duration // Timeout for each probe
+	IPVersion int           // IP version to use: 4, 6 or 0 for either
+	ICMPMode  ICMPMode      // Socket mode for ICMP probes (default: auto)
+}
+
+// Hop accumulates the probes sent with a single TTL
+type Hop struct {
+	TTL      int                     // TTL (hop limit) of the probes
+	Addr     net.IP                  // Most recent responder, nil if none
+	Addrs    []net.IP                // All responders seen, e.g. on load-balanced paths
+	Sent     int                     // Probes sent
+	Received int                     // Probes answered by this hop
+	Last     time.Duration           // RTT of the most recent answer
+	Latency  *stats.LatencyHistogram // RTTs of all answers
+}
+
+// Loss returns the share of unanswered probes as a percentage
+func (h *Hop) Loss() float64 {
+	if h.Sent == 0 {
+		return 0
+	}
+	return float64(h.Sent-h.Received) / float64(h.Sent) * 100
+}
+
+// record adds the outcome of one probe to the hop
+func (h *Hop) record(from net.IP, rtt time.Duration) {
+	h.Received++
+	h.Last = rtt
+	h.Latency.AddSample(rtt)
+	h.Addr = from
+	for _, addr := range h.Addrs {
+		if addr.Equal(from) {
+			return
+		}
+	}
+	h.Addrs = append(h.Addrs, from)
+}
+
+// Tracer discovers the path to a target by sending probes with increasing
+// TTL and collecting the ICMP time exceeded replies of each router, like
+// mtr. Every round probes all hops in parallel using the UDP or ICMP
+// prober; once the target answers, hops beyond it are no longer probed.
+//
+// Time exceeded messages are only visible on raw sockets, so tracing
+// needs root or CAP_NET_RAW; without them only the target responds.
+type Tracer struct {
+	config TraceConfig
+}
+
+// NewTracer creates a new path tracer
+func NewTracer(config TraceConfig) *Tracer {
+	if config.Method == "" {
+		config.Method = TraceMethodICMP
+	}
+	if config.Port == 0 {
+		config.Port = 33434
+	}
+	if config.MaxHops <= 0 || config.MaxHops > 255 {
+		config.MaxHops = 30
+	}
+	if config.Rounds == 0 {
+		config.Rounds = 10
+	}
+	if config.Interval == 0 {
+		config.Interval = 1 * time.Second
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 2 * time.Second
+	}
+
+	return &Tracer{config: config}
+}
+
+// Trace probes the path for the configured number of rounds, calling
+// onRound with the hops so far after each round. If ctx is cancelled the
+// hops gathered so far are returned with ctx.Err().
+func (t *Tracer) Trace(ctx context.Context, onRound func(round int, hops []*Hop)) ([]*Hop, error) {
+	if t.config.Method != TraceMethodICMP && t.config.Method != TraceMethodUDP {
+		return nil, fmt.Errorf("unsupported trace method: %s", t.config.Method)
+	}
+
+	// Resolve once so every hop probes the same address
+	addr, err := net.ResolveIPAddr(ipNetwork("ip", t.config.IPVersion), t.config.Target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve address: %w", err)
+	}
+
+	hops := make([]*Hop, t.config.MaxHops)
+	for i := range hops {
+		hops[i] = &Hop{TTL: i + 1, Latency: stats.NewLatencyHistogram(t.config.Rounds)}
+	}
+
+	for round := 0; round < t.config.Rounds; round++ {
+		if round > 0 {
+			if err := sleepContext(ctx, t.config.Interval); err != nil {
+				return hops, err
+			}
+		}
+
+		results, err := t.probeRound(ctx, addr, round, len(hops))
+		if err != nil {
+			return hops, err
+		}
+
+		hops = recordRound(hops, results, addr.IP)
+
+		if onRound != nil {
+			onRound(round+1, hops)
+		}
+	}
+
+	return hops, nil
+}
+
+// probeRound sends one probe to each of the first n hops in parallel
+func (t *Tracer) probeRound(ctx context.Context, addr *net.IPAddr, round, n int) ([]Result, error) {
+	results := make([]Result, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			probed, err := t.prober(addr, round, i+1).ProbeContext(ctx)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if len(probed) > 0 {
+				results[i] = probed[0]
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// Setup errors such as missing privileges affect every hop alike
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// prober builds the single-probe prober for one hop of one round
+func (t *Tracer) prober(addr *net.IPAddr, round, ttl int) Prober {
+	target := addr.IP.String()
+	if addr.Zone != "" {
+		target += "%" + addr.Zone
+	}
+
+	if t.config.Method == TraceMethodUDP {
+		return NewUDPProber(UDPProbeConfig{
+			Target:    target,
+			Port:      t.config.Port,
+			Count:     1,
+			Timeout:   t.config.Timeout,
+			IPVersion: t.config.IPVersion,
+			TTL:       ttl,
+		})
+	}
+
+	// Give every hop and round its own echo ID so raw sockets, which see
+	// each other's replies, never match a reply meant for another probe
+	id := (os.Getpid() + round<<8 + ttl) & 0xffff
+	if id == 0 {
+		id = 1
+	}
+	return NewICMPProber(ICMPProbeConfig{
+		Target:    target,
+		Count:     1,
+		Timeout:   t.config.Timeout,
+		PacketID:  id,
+		IPVersion: t.config.IPVersion,
+		Mode:      t.config.ICMPMode,
+		TTL:       ttl,
+	})
+}
+
+// recordRound adds one round of results, one per hop, to the hops and
+// returns them cut after the first hop that ended the path, so later rounds
+// stop probing past it
+func recordRound(hops []*Hop, results []Result, target net.IP) []*Hop {
+	last := len(hops)
+	for i, r := range results {
+		hop := hops[i]
+		hop.Sent++
+		from, final, answered := traceResponder(r, target)
+		if answered {
+			hop.record(from, r.RTT)
+		}
+		if final && i+1 < last {
+			last = i + 1
+		}
+	}
+	return hops[:last]
+}
+
+// traceResponder works out who answered a trace probe. final reports
+// whether the answer ends the path: the target itself replied, or a
+// router reported it unreachable.
+func traceResponder(r Result, target net.IP) (from net.IP, final, answered bool) {
+	if r.Success {
+		return target, true, true
+	}
+
+	var exceeded *TimeExceededError
+	var unreachable *DestinationUnreachableError
+	switch {
+	case errors.As(r.Error, &exceeded):
+		return addrIP(exceeded.From), false, true
+	case errors.As(r.Error, &unreachable):
+		return addrIP(unreachable.From), true, true
+	case r.ErrorClass == ErrorRefused:
+		// Port unreachable from the target on a connected UDP socket
+		return target, true, true
+	}
+	return nil, false, false
+}
+
+// addrIP extracts the IP address of an ICMP peer
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
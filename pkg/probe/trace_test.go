@@ -0,0 +1,153 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ErturkCan/netprobe/pkg/stats"
+)
+
+var (
+	traceTarget = net.ParseIP("192.0.2.10")
+	traceRouter = net.ParseIP("198.51.100.1")
+)
+
+// Results as the UDP and ICMP probers report them
+var (
+	traceReply    = Result{Success: true, RTT: 3 * time.Millisecond}
+	traceExceeded = Result{
+		RTT:        time.Millisecond,
+		ErrorClass: ErrorTimeExceeded,
+		Error:      fmt.Errorf("probe failed: %w", &TimeExceededError{From: &net.IPAddr{IP: traceRouter}}),
+	}
+	traceUnreachable = Result{
+		RTT:        2 * time.Millisecond,
+		ErrorClass: ErrorUnreachable,
+		Error:      &DestinationUnreachableError{Code: 1, From: &net.IPAddr{IP: traceRouter}},
+	}
+	traceRefused = Result{RTT: 3 * time.Millisecond, ErrorClass: ErrorRefused, Error: fmt.Errorf("connection refused")}
+	traceTimeout = Result{ErrorClass: ErrorTimeout, Error: fmt.Errorf("no reply")}
+)
+
+func TestTraceResponder(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   Result
+		from     net.IP
+		final    bool
+		answered bool
+	}{
+		{"target replied", traceReply, traceTarget, true, true},
+		{"time exceeded", traceExceeded, traceRouter, false, true},
+		{"unreachable", traceUnreachable, traceRouter, true, true},
+		{"port unreachable from target", traceRefused, traceTarget, true, true},
+		{"no answer", traceTimeout, nil, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, final, answered := traceResponder(tt.result, traceTarget)
+			if !from.Equal(tt.from) || final != tt.final || answered != tt.answered {
+				t.Fatalf("traceResponder = %v, %v, %v; want %v, %v, %v",
+					from, final, answered, tt.from, tt.final, tt.answered)
+			}
+		})
+	}
+}
+
+func TestRecordRound(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  []Result
+		wantHops int
+		received []int
+	}{
+		{"no final hop", []Result{traceExceeded, traceTimeout, traceExceeded}, 3, []int{1, 0, 1}},
+		{"target at hop 2", []Result{traceExceeded, traceReply, traceReply, traceTimeout}, 2, []int{1, 1}},
+		{"unreachable at hop 1", []Result{traceUnreachable, traceTimeout, traceReply}, 1, []int{1}},
+		{"refused at last hop", []Result{traceTimeout, traceRefused}, 2, []int{0, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hops := make([]*Hop, len(tt.results))
+			for i := range hops {
+				hops[i] = &Hop{TTL: i + 1, Latency: stats.NewLatencyHistogram(1)}
+			}
+
+			got := recordRound(hops, tt.results, traceTarget)
+			if len(got) != tt.wantHops {
+				t.Fatalf("kept %d hops, want %d", len(got), tt.wantHops)
+			}
+			for i, hop := range got {
+				if hop.Sent != 1 || hop.Received != tt.received[i] {
+					t.Errorf("hop %d: sent %d received %d, want 1 and %d", hop.TTL, hop.Sent, hop.Received, tt.received[i])
+				}
+				if hop.Received > 0 && hop.Last != tt.results[i].RTT {
+					t.Errorf("hop %d: last RTT %v, want %v", hop.TTL, hop.Last, tt.results[i].RTT)
+				}
+			}
+			// Hops past the cut were still probed this round
+			for _, hop := range hops[len(got):] {
+				if hop.Sent != 1 {
+					t.Errorf("hop %d beyond the target: sent %d, want 1", hop.TTL, hop.Sent)
+				}
+			}
+		})
+	}
+}
+
+func TestHopAddrs(t *testing.T) {
+	other := net.ParseIP("198.51.100.2")
+	hop := &Hop{TTL: 1, Latency: stats.NewLatencyHistogram(3)}
+	hop.record(traceRouter, time.Millisecond)
+	hop.record(other, time.Millisecond)
+	hop.record(traceRouter, time.Millisecond)
+
+	if !hop.Addr.Equal(traceRouter) || len(hop.Addrs) != 2 {
+		t.Fatalf("Addr %v, Addrs %v; want %v and two responders", hop.Addr, hop.Addrs, traceRouter)
+	}
+	hop.Sent = 4
+	if loss := hop.Loss(); loss != 25 {
+		t.Fatalf("Loss() = %v, want 25", loss)
+	}
+}
+
+func TestTracerUDPLoopback(t *testing.T) {
+	// The target answers the first probe with port unreachable, which ends
+	// the path at hop 1
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	tracer := NewTracer(TraceConfig{
+		Target:    "127.0.0.1",
+		Method:    TraceMethodUDP,
+		Port:      port,
+		MaxHops:   4,
+		Rounds:    2,
+		Interval:  10 * time.Millisecond,
+		Timeout:   500 * time.Millisecond,
+		IPVersion: 4,
+	})
+	rounds := 0
+	hops, err := tracer.Trace(context.Background(), func(int, []*Hop) { rounds++ })
+	if err != nil {
+		t.Fatalf("Trace: %v", err)
+	}
+	if rounds != 2 {
+		t.Errorf("onRound called %d times, want 2", rounds)
+	}
+	if len(hops) != 1 {
+		t.Fatalf("got %d hops, want 1", len(hops))
+	}
+	if hop := hops[0]; hop.Sent != 2 || hop.Received != 2 || !hop.Addr.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("hop 1: sent %d received %d from %v", hop.Sent, hop.Received, hop.Addr)
+	}
+}
@@ -0,0 +1,176 @@
+package probe
+
+import (
+	"errors"
+	"time"
+)
+
+// TWAMP-Test packet sizes in unauthenticated mode (RFC 5357 section 4).
+// TWAMP-Test packets share the STAMP layout, which was designed to be
+// backward compatible, but are only as long as their fields plus padding.
+// The reflector carries over the sender's padding less the 27 bytes its own
+// fields add, so a sender packet padded to TWAMPReflectorLen bytes is
+// reflected at the same size.
+const (
+	TWAMPSenderLen    = senderHeaderLen    // Smallest session-sender packet
+	TWAMPReflectorLen = reflectorHeaderLen // Smallest session-reflector packet
+)
+
+// twampSenderTTL is the TTL session-senders put on test packets, so the
+// TTL the reflector reports shows the number of hops taken
+const twampSenderTTL = 255
+
+var errShortTWAMP = errors.New("TWAMP-Test packet too short")
+
+// MarshalTWAMP encodes the packet as a TWAMP-Test session-sender packet into
+// b, which must hold at least TWAMPSenderLen bytes; the rest of b is left as
+// padding
+func (p *STAMPSenderPacket) MarshalTWAMP(b []byte) error {
+	if len(b) < TWAMPSenderLen {
+		return errShortTWAMP
+	}
+	p.encode(b)
+	return nil
+}
+
+// ParseTWAMPSenderPacket decodes a TWAMP-Test session-sender packet
+func ParseTWAMPSenderPacket(b []byte) (STAMPSenderPacket, error) {
+	if len(b) < TWAMPSenderLen {
+		return STAMPSenderPacket{}, errShortTWAMP
+	}
+	return decodeSender(b), nil
+}
+
+// MarshalTWAMP encodes the packet as a TWAMP-Test session-reflector packet
+// into b, which must hold at least TWAMPReflectorLen bytes; the rest of b is
+// left as padding
+func (p *STAMPReflectorPacket) MarshalTWAMP(b []byte) error {
+	if len(b) < TWAMPReflectorLen {
+		return errShortTWAMP
+	}
+	p.encode(b)
+	return nil
+}
+
+// ParseTWAMPReflectorPacket decodes a TWAMP-Test session-reflector packet
+func ParseTWAMPReflectorPacket(b []byte) (STAMPReflectorPacket, error) {
+	if len(b) < TWAMPReflectorLen {
+		return STAMPReflectorPacket{}, errShortTWAMP
+	}
+	return decodeReflector(b), nil
+}
+
+// ReflectTWAMP writes the reflection of a TWAMP-Test sender packet into
+// reply, carrying over the sender's padding less the bytes the reflector's
+// fields add, and returns the reply length. reply must hold at least
+// len(request) and TWAMPReflectorLen bytes.
+func ReflectTWAMP(reply, request []byte, packet *STAMPReflectorPacket) (int, error) {
+	n := len(request)
+	if n < TWAMPSenderLen {
+		return 0, errShortTWAMP
+	}
+	if n < TWAMPReflectorLen {
+		n = TWAMPReflectorLen
+	}
+	if len(reply) < n {
+		return 0, errShortTWAMP
+	}
+
+	clear(reply[TWAMPReflectorLen:n])
+	copy(reply[TWAMPReflectorLen:n], request[TWAMPSenderLen:])
+	if err := packet.MarshalTWAMP(reply[:n]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// TWAMPLightProbeConfig holds configuration for TWAMP-Light probes
+type TWAMPLightProbeConfig struct {
+	Target      string        // Session-reflector host or IP
+	Port        int           // Session-reflector port (default 862)
+	Count       int           // Number of probes to send
+	Interval    time.Duration // Time between probes
+	PayloadSize int           // Test packet size in bytes (default 41, minimum 14)
+	Timeout     time.Duration // Per-probe timeout for responses
+	IPVersion   int           // IP version to use: 4, 6 or 0 for either
+	TTL         int           // IPv4 TTL or IPv6 hop limit of probes (default 255)
+
+	KernelTimestamps bool // Take RTTs from kernel socket timestamps (Linux only)
+}
+
+// TWAMPLightProber is an unauthenticated TWAMP-Light session-sender
+// (RFC 5357 appendix I): TWAMP-Test packets sent straight to a reflector,
+// without a TWAMP-Control session to set it up. It is pipelined like
+// UDPProber, and the reflector's receive and transmit timestamps are kept
+// in each result for OneWay.
+//
+// Probes go out with TTL 255 unless told otherwise. Only an explicit TTL
+// makes the prober listen for ICMP errors from routers, as UDPProber does;
+// the default one should reach any reflector, so it runs without a raw
+// socket.
+type TWAMPLightProber struct {
+	*UDPProber
+}
+
+var (
+	_ Prober            = (*TWAMPLightProber)(nil)
+	_ ReplyReporter     = (*TWAMPLightProber)(nil)
+	_ TimestampReporter = (*TWAMPLightProber)(nil)
+)
+
+// NewTWAMPLightProber creates a new TWAMP-Light session-sender
+func NewTWAMPLightProber(config TWAMPLightProbeConfig) *TWAMPLightProber {
+	if config.Port == 0 {
+		config.Port = STAMPPort
+	}
+	if config.PayloadSize == 0 {
+		config.PayloadSize = TWAMPReflectorLen
+	}
+	icmpErrors := config.TTL > 0
+	if config.TTL == 0 {
+		config.TTL = twampSenderTTL
+	}
+
+	p := newUDPProber(UDPProbeConfig{
+		Target:           config.Target,
+		Port:             config.Port,
+		Count:            config.Count,
+		Interval:         config.Interval,
+		PayloadSize:      config.PayloadSize,
+		Timeout:          config.Timeout,
+		IPVersion:        config.IPVersion,
+		TTL:              config.TTL,
+		KernelTimestamps: config.KernelTimestamps,
+	}, twampFormat{})
+	p.icmpErrors = icmpErrors
+	return &TWAMPLightProber{UDPProber: p}
+}
+
+// twampFormat speaks unauthenticated TWAMP-Test
+type twampFormat struct{}
+
+func (twampFormat) minSize() int {
+	return TWAMPSenderLen
+}
+
+func (twampFormat) marshal(b []byte, sequence uint32, sendTime time.Time) error {
+	packet := STAMPSenderPacket{Sequence: sequence, Timestamp: sendTime, ErrorEstimate: stampErrorEstimate}
+	return packet.MarshalTWAMP(b)
+}
+
+func (twampFormat) parse(b []byte) (udpReply, error) {
+	packet, err := ParseTWAMPReflectorPacket(b)
+	if err != nil {
+		return udpReply{}, err
+	}
+	return udpReply{
+		sequence:      packet.SenderSequence,
+		reflectorRecv: packet.ReceiveTimestamp,
+		reflectorSend: packet.Timestamp,
+	}, nil
+}
+
+// quotedSequence reads the sequence number where STAMP packets have it too
+func (twampFormat) quotedSequence(b []byte) (uint32, bool) {
+	return stampFormat{}.quotedSequence(b)
+}
@@ -0,0 +1,205 @@
+package probe
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// twampArrival is a test packet as the reflector received it
+type twampArrival struct {
+	sender STAMPSenderPacket
+	ttl    int
+	size   int
+}
+
+// startTWAMPReflector runs a stateless TWAMP-Light session-reflector on the
+// IPv4 loopback and returns its port along with the packets it receives
+func startTWAMPReflector(t *testing.T) (int, <-chan twampArrival) {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen on udp4: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := ipv4.NewPacketConn(conn).SetControlMessage(ipv4.FlagTTL, true); err != nil {
+		t.Fatalf("SetControlMessage: %v", err)
+	}
+
+	arrivals := make(chan twampArrival, 64)
+	go func() {
+		buffer := make([]byte, 4096)
+		reply := make([]byte, 4096)
+		oob := make([]byte, 128)
+		for {
+			n, oobn, _, peer, err := conn.ReadMsgUDP(buffer, oob)
+			recvTime := time.Now()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+
+			var cm ipv4.ControlMessage
+			if err := cm.Parse(oob[:oobn]); err != nil {
+				continue
+			}
+			sender, err := ParseTWAMPSenderPacket(buffer[:n])
+			if err != nil {
+				continue
+			}
+			arrivals <- twampArrival{sender: sender, ttl: cm.TTL, size: n}
+
+			packet := NewSTAMPReflectorPacket(sender, recvTime, cm.TTL)
+			packet.Timestamp = time.Now()
+			size, err := ReflectTWAMP(reply, buffer[:n], &packet)
+			if err != nil {
+				continue
+			}
+			conn.WriteToUDP(reply[:size], peer)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port, arrivals
+}
+
+func TestTWAMPLightProber(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        int
+		payload    int
+		wantTTL    int
+		wantSize   int
+		icmpErrors bool
+	}{
+		{"default ttl", 0, 0, twampSenderTTL, TWAMPReflectorLen, false},
+		{"explicit ttl", 7, 0, 7, TWAMPReflectorLen, true},
+		{"padded", 0, 512, twampSenderTTL, 512, false},
+		{"smallest packet", 0, TWAMPSenderLen, twampSenderTTL, TWAMPSenderLen, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, arrivals := startTWAMPReflector(t)
+			const count = 3
+			prober := NewTWAMPLightProber(TWAMPLightProbeConfig{
+				Target:      "127.0.0.1",
+				Port:        port,
+				Count:       count,
+				Interval:    10 * time.Millisecond,
+				PayloadSize: tt.payload,
+				Timeout:     time.Second,
+				TTL:         tt.ttl,
+			})
+			if prober.icmpErrors != tt.icmpErrors {
+				t.Errorf("icmpErrors = %v, want %v", prober.icmpErrors, tt.icmpErrors)
+			}
+
+			start := time.Now()
+			results, err := prober.Probe()
+			if err != nil {
+				t.Fatalf("Probe: %v", err)
+			}
+			end := time.Now()
+			checkResults(t, results, count)
+
+			for _, r := range results {
+				if r.ReflectorRecv.Before(r.SendTime) || r.ReflectorSend.Before(r.ReflectorRecv) {
+					t.Errorf("probe %d: sent %v, reflector received %v and sent %v",
+						r.Sequence, r.SendTime, r.ReflectorRecv, r.ReflectorSend)
+				}
+				if r.ReflectorSend.After(end) {
+					t.Errorf("probe %d: reflector sent %v after the run ended", r.Sequence, r.ReflectorSend)
+				}
+			}
+
+			for seq := 1; seq <= count; seq++ {
+				a := <-arrivals
+				if a.sender.Sequence != uint32(seq) {
+					t.Errorf("reflector saw sequence %d, want %d", a.sender.Sequence, seq)
+				}
+				if a.ttl != tt.wantTTL {
+					t.Errorf("probe %d arrived with TTL %d, want %d", seq, a.ttl, tt.wantTTL)
+				}
+				if a.size != tt.wantSize {
+					t.Errorf("probe %d was %d bytes, want %d", seq, a.size, tt.wantSize)
+				}
+				if ts := a.sender.Timestamp; ts.Before(start.Add(-time.Millisecond)) || ts.After(end) {
+					t.Errorf("probe %d timestamp %v outside the run", seq, ts)
+				}
+			}
+		})
+	}
+}
+
+func TestReflectTWAMP(t *testing.T) {
+	recv := time.Unix(1700000000, 250000000)
+	sender := STAMPSenderPacket{Sequence: 42, Timestamp: recv.Add(-time.Millisecond), ErrorEstimate: stampErrorEstimate}
+
+	tests := []struct {
+		name    string
+		size    int
+		padding []byte // Bytes after the sender fields
+		want    int
+	}{
+		{"smallest sender packet", TWAMPSenderLen, nil, TWAMPReflectorLen},
+		{"padded to reflector size", TWAMPReflectorLen, nil, TWAMPReflectorLen},
+		{"padding carried over", 100, padding(100 - TWAMPSenderLen), 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := make([]byte, tt.size)
+			if err := sender.MarshalTWAMP(request); err != nil {
+				t.Fatalf("MarshalTWAMP: %v", err)
+			}
+			copy(request[TWAMPSenderLen:], tt.padding)
+
+			packet := NewSTAMPReflectorPacket(sender, recv, 64)
+			packet.Timestamp = recv.Add(time.Microsecond)
+			reply := make([]byte, 4096)
+			n, err := ReflectTWAMP(reply, request, &packet)
+			if err != nil {
+				t.Fatalf("ReflectTWAMP: %v", err)
+			}
+			if n != tt.want {
+				t.Fatalf("reply is %d bytes, want %d", n, tt.want)
+			}
+
+			got, err := ParseTWAMPReflectorPacket(reply[:n])
+			if err != nil {
+				t.Fatalf("ParseTWAMPReflectorPacket: %v", err)
+			}
+			if got.SenderSequence != 42 || got.SenderTTL != 64 ||
+				!got.SenderTimestamp.Equal(sender.Timestamp) ||
+				!got.ReceiveTimestamp.Equal(recv) || !got.Timestamp.Equal(packet.Timestamp) {
+				t.Fatalf("reflected %+v", got)
+			}
+			// The reflector's extra fields take the end of the sender's padding
+			want := make([]byte, n-TWAMPReflectorLen)
+			copy(want, tt.padding)
+			if !bytes.Equal(reply[TWAMPReflectorLen:n], want) {
+				t.Fatalf("padding % x, want % x", reply[TWAMPReflectorLen:n], want)
+			}
+		})
+	}
+
+	if _, err := ReflectTWAMP(make([]byte, 4096), make([]byte, TWAMPSenderLen-1), &STAMPReflectorPacket{}); err == nil {
+		t.Fatal("short sender packet reflected")
+	}
+}
+
+// padding returns n bytes counting up from 1
+func padding(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i + 1)
+	}
+	return b
+}
@@ -1,12 +1,19 @@
 package probe
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/ErturkCan/netprobe/internal"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 // UDPProbeConfig holds configuration for UDP probes
@@ -15,26 +22,56 @@ type UDPProbeConfig struct {
 	Port        int           // Target port
 	Count       int           // Number of probes to send
 	Interval    time.Duration // Time between probes
-	PayloadSize int           // Size of payload in bytes (minimum 12 for timestamp)
-	Timeout     time.Duration // Timeout for responses
-}
+	PayloadSize int           // Size of payload in bytes (minimum 12, or 36 for packet version 2)
+	Timeout     time.Duration // Per-probe timeout for responses
+	IPVersion   int           // IP version to use: 4, 6 or 0 for either
+	TTL         int           // IPv4 TTL or IPv6 hop limit of probes (0 for the system default)
+
+	// PacketVersion selects the probe packet format (default PacketV1).
+	// PacketV2 asks the reflector for its receive and transmit times,
+	// from which OneWay derives forward and reverse delay.
+	PacketVersion int
 
-// UDPProbeResult holds results from a single probe
-type UDPProbeResult struct {
-	Sequence   uint32
-	RTT        time.Duration
-	PayloadLen int
-	Success    bool
-	Error      error
+	DontFragment     bool // Set DF and never fragment locally (Linux only)
+	KernelTimestamps bool // Take RTTs from kernel socket timestamps (Linux only)
 }
 
-// UDPProber performs UDP echo probes
+// UDPProber performs UDP echo probes. Probes are pipelined: a sender
+// goroutine emits probes at the configured interval while a receiver
+// goroutine matches replies to in-flight probes by sequence number.
+// Replies to version 2 packets from an updated reflector also carry the
+// reflector's receive and transmit times.
+//
+// When a TTL or DontFragment is set the prober also listens on a raw ICMP
+// socket, if permitted, so that time exceeded, unreachable and
+// fragmentation needed messages from routers along the path complete the
+// probes that triggered them.
 type UDPProber struct {
-	config UDPProbeConfig
+	config     UDPProbeConfig
+	format     udpFormat
+	icmpErrors bool // Listen for ICMP errors about the probes
+
+	mu         sync.Mutex      // Guards replies and timestamps
+	replies    ReplyStats      // Reply anomalies seen during the last run
+	timestamps TimestampSource // Timestamp source used by the last run
 }
 
+var (
+	_ Prober            = (*UDPProber)(nil)
+	_ ReplyReporter     = (*UDPProber)(nil)
+	_ TimestampReporter = (*UDPProber)(nil)
+)
+
 // NewUDPProber creates a new UDP prober
 func NewUDPProber(config UDPProbeConfig) *UDPProber {
+	if config.PacketVersion != PacketV2 {
+		config.PacketVersion = PacketV1
+	}
+	return newUDPProber(config, packetFormat{version: config.PacketVersion})
+}
+
+// newUDPProber creates a UDP prober that speaks the given packet format
+func newUDPProber(config UDPProbeConfig, format udpFormat) *UDPProber {
 	if config.Count == 0 {
 		config.Count = 10
 	}
@@ -44,83 +81,508 @@ func NewUDPProber(config UDPProbeConfig) *UDPProber {
 	if config.Interval == 0 {
 		config.Interval = 1 * time.Second
 	}
-	if config.PayloadSize < 12 {
-		config.PayloadSize = 12
+	if config.PayloadSize < format.minSize() {
+		config.PayloadSize = format.minSize()
 	}
 	if config.Timeout == 0 {
 		config.Timeout = 3 * time.Second
 	}
 
-	return &UDPProber{config: config}
+	return &UDPProber{
+		config:     config,
+		format:     format,
+		icmpErrors: config.TTL > 0 || config.DontFragment,
+	}
 }
 
 // Probe performs a series of UDP echo probes
-func (p *UDPProber) Probe() ([]UDPProbeResult, error) {
-	results := make([]UDPProbeResult, 0, p.config.Count)
+func (p *UDPProber) Probe() ([]Result, error) {
+	return p.ProbeContext(context.Background())
+}
+
+// ProbeContext performs a series of UDP echo probes until done or ctx is
+// cancelled, in which case the results gathered so far are returned with ctx.Err()
+func (p *UDPProber) ProbeContext(ctx context.Context) ([]Result, error) {
+	return collect(ctx, p.config.Count, p.ProbeStream)
+}
 
+// ProbeStream performs a series of UDP echo probes, passing each result to
+// handler as soon as it completes. Results are delivered in completion order.
+func (p *UDPProber) ProbeStream(ctx context.Context, handler ResultHandler) error {
 	// Resolve target address
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", p.config.Target, p.config.Port))
+	network := ipNetwork("udp", p.config.IPVersion)
+	addr, err := net.ResolveUDPAddr(network, net.JoinHostPort(p.config.Target, strconv.Itoa(p.config.Port)))
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve address: %w", err)
+		return fmt.Errorf("failed to resolve address: %w", err)
 	}
 
 	// Create UDP connection
-	conn, err := net.DialUDP("udp", nil, addr)
+	conn, err := net.DialUDP(network, nil, addr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to dial UDP: %w", err)
+		return fmt.Errorf("failed to dial UDP: %w", err)
 	}
 	defer conn.Close()
 
-	// Set read deadline for all operations
-	baseDeadline := time.Now().Add(time.Duration(p.config.Count) * (p.config.Interval + p.config.Timeout))
-	if err := conn.SetReadDeadline(baseDeadline); err != nil {
-		return nil, fmt.Errorf("failed to set read deadline: %w", err)
+	if p.config.TTL > 0 {
+		if err := setUDPTTL(conn, addr.IP, p.config.TTL); err != nil {
+			return fmt.Errorf("failed to set TTL: %w", err)
+		}
+	}
+	if p.config.DontFragment {
+		rc, err := conn.SyscallConn()
+		if err != nil {
+			return fmt.Errorf("failed to set don't fragment: %w", err)
+		}
+		if err := setDontFragment(rc, addr.IP.To4() == nil); err != nil {
+			return fmt.Errorf("failed to set don't fragment: %w", err)
+		}
+	}
+
+	// Fall back to userspace timestamps if the kernel cannot provide them
+	timestamps := TimestampUserspace
+	var rawConn syscall.RawConn
+	if p.config.KernelTimestamps {
+		if rc, err := conn.SyscallConn(); err == nil {
+			if source, err := enableTimestamps(rc); err == nil {
+				timestamps, rawConn = source, rc
+			}
+		}
+	}
+
+	var icmpConn *icmp.PacketConn
+	if p.icmpErrors {
+		// Without privileges only port unreachable and fragmentation
+		// needed are visible, without the reporting router
+		family := familyFor(addr.IP)
+		icmpConn, err = icmp.ListenPacket(family.network, family.listenAddr)
+		if err == nil {
+			defer icmpConn.Close()
+		}
 	}
 
-	// Send probes
-	for i := 0; i < p.config.Count; i++ {
+	p.mu.Lock()
+	p.replies = ReplyStats{}
+	p.timestamps = timestamps
+	p.mu.Unlock()
+
+	// Every probe produces exactly one result, so a channel sized to the
+	// probe count never blocks the sender, receiver or timers
+	results := make(chan Result, p.config.Count)
+	session := &udpSession{
+		prober:   p,
+		conn:     conn,
+		results:  results,
+		inflight: make(map[uint32]*udpInflight),
+		answered: make(map[uint32]bool),
+		expired:  make(map[uint32]bool),
+	}
+	if timestamps == TimestampKernel {
+		session.rawConn = rawConn
+		session.txKeys = make(map[uint32]uint32)
+	}
+	defer session.stopTimers()
+
+	go session.receive()
+	if icmpConn != nil {
+		go session.receiveICMP(icmpConn, addr)
+	}
+	go session.send(ctx)
+
+	for completed := 0; completed < p.config.Count; completed++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case r := <-results:
+			handler(r)
+		}
+	}
+
+	return nil
+}
+
+// TimestampSource returns the timestamp source used by the most recent run
+func (p *UDPProber) TimestampSource() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return string(p.timestamps)
+}
+
+// ReplyStats returns the late, duplicate and reordered reply counts from
+// the most recent run
+func (p *UDPProber) ReplyStats() ReplyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.replies
+}
+
+// udpFormat encodes the requests and decodes the replies of a UDP echo
+// protocol
+type udpFormat interface {
+	// minSize returns the smallest valid request size
+	minSize() int
+
+	// marshal encodes a request into b, leaving the rest as padding
+	marshal(b []byte, sequence uint32, sendTime time.Time) error
+
+	// parse decodes a reply
+	parse(b []byte) (udpReply, error)
+
+	// quotedSequence extracts the sequence number from the start of a
+	// request quoted in an ICMP error
+	quotedSequence(b []byte) (uint32, bool)
+}
+
+// udpReply is a decoded reply
+type udpReply struct {
+	sequence      uint32
+	reflectorRecv time.Time // Zero unless the reflector added its timestamps
+	reflectorSend time.Time
+}
+
+// udpInflight tracks a probe that has been sent but not yet answered
+type udpInflight struct {
+	result Result
+	timer  *time.Timer
+}
+
+// udpSession holds the state shared by the sender and receiver goroutines
+// of a single run
+type udpSession struct {
+	prober  *UDPProber
+	conn    *net.UDPConn
+	results chan<- Result
+
+	mu       sync.Mutex
+	inflight map[uint32]*udpInflight // Probes awaiting a reply
+	answered map[uint32]bool         // Probes that received a reply
+	expired  map[uint32]bool         // Probes that timed out
+	highest  uint32                  // Highest sequence answered so far
+
+	// Transmit timestamps are reported with a counter of the datagrams
+	// sent on the socket; txKeys maps that counter to sequence numbers.
+	// Both are unset unless kernel transmit timestamps are enabled.
+	rawConn syscall.RawConn
+	txKeys  map[uint32]uint32
+	sent    uint32
+}
+
+// send emits probes at the configured interval until done or cancelled
+func (s *udpSession) send(ctx context.Context) {
+	cfg := s.prober.config
+
+	for i := 0; i < cfg.Count; i++ {
 		if i > 0 {
-			time.Sleep(p.config.Interval)
+			if err := sleepContext(ctx, cfg.Interval); err != nil {
+				return
+			}
+		}
+
+		sequence := uint32(i + 1)
+
+		// Prepare payload in the prober's packet format
+		payload := make([]byte, cfg.PayloadSize)
+		if err := s.prober.format.marshal(payload, sequence, time.Now()); err != nil {
+			// Never registered, so fail cannot complete it
+			s.results <- Result{
+				Sequence:   int(sequence),
+				ErrorClass: ErrorSend,
+				Error:      fmt.Errorf("send failed: %w", err),
+			}
+			continue
 		}
 
-		result := p.sendProbe(conn, uint32(i+1))
-		results = append(results, result)
+		// Register the probe before sending so a fast reply always finds it
+		entry := &udpInflight{result: Result{Sequence: int(sequence)}}
+		s.mu.Lock()
+		s.inflight[sequence] = entry
+		entry.result.SendTime = time.Now()
+		entry.timer = time.AfterFunc(cfg.Timeout, func() {
+			s.expire(sequence)
+		})
+		if s.txKeys != nil {
+			s.txKeys[s.sent] = sequence
+			s.sent++
+		}
+		s.mu.Unlock()
+
+		if _, err := s.conn.Write(payload); err != nil {
+			// Failed sends do not consume a transmit timestamp key
+			if s.txKeys != nil {
+				s.mu.Lock()
+				s.sent--
+				delete(s.txKeys, s.sent)
+				s.mu.Unlock()
+			}
+			class := ErrorSend
+			if errors.Is(err, syscall.EMSGSIZE) {
+				class = ErrorTooBig
+			}
+			s.fail(sequence, class, fmt.Errorf("send failed: %w", err))
+		}
 	}
+}
+
+// receive reads replies and matches them to in-flight probes until the
+// connection is closed
+func (s *udpSession) receive() {
+	buffer := make([]byte, 65535)
+	oob := make([]byte, 128)
+
+	for {
+		n, oobn, _, _, err := s.conn.ReadMsgUDP(buffer, oob)
+		recvTime := time.Now()
+		if ts, ok := rxTimestamp(oob[:oobn]); ok {
+			recvTime = ts
+		}
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// A connected UDP socket reports ICMP port unreachable as
+			// ECONNREFUSED without saying which datagram triggered it,
+			// so charge it to the oldest outstanding probe
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				if sequence, ok := s.oldest(); ok {
+					s.failReply(sequence, ErrorRefused, fmt.Errorf("receive failed: %w", err), recvTime)
+				}
+			}
+			// Likewise a fragmentation needed message for a DF datagram
+			if errors.Is(err, syscall.EMSGSIZE) {
+				if sequence, ok := s.oldest(); ok {
+					s.failReply(sequence, ErrorTooBig, &FragmentationNeededError{}, recvTime)
+				}
+			}
+			continue
+		}
+
+		reply, err := s.prober.format.parse(buffer[:n])
+		if err != nil {
+			s.prober.countReply(func(rs *ReplyStats) { rs.Unmatched++ })
+			continue
+		}
 
-	return results, nil
+		// The transmit timestamp is queued before the datagram leaves, so
+		// it is always available once the reply is in
+		var txTimes map[uint32]time.Time
+		if s.rawConn != nil {
+			txTimes = readTxTimestamps(s.rawConn)
+		}
+		s.match(reply, n, recvTime, txTimes)
+	}
 }
 
-// sendProbe sends a single UDP probe and measures RTT
-func (p *UDPProber) sendProbe(conn *net.UDPConn, sequence uint32) UDPProbeResult {
-	result := UDPProbeResult{
-		Sequence: sequence,
+// receiveICMP reads ICMP error messages quoting our probes and fails the
+// matching in-flight probes until the connection is closed
+func (s *udpSession) receiveICMP(conn *icmp.PacketConn, addr *net.UDPAddr) {
+	family := familyFor(addr.IP)
+	local, _ := s.conn.LocalAddr().(*net.UDPAddr)
+	if local == nil {
+		return
 	}
+	buffer := make([]byte, 1500)
 
-	// Prepare payload: [4 bytes sequence][8 bytes timestamp][variable payload]
-	payload := make([]byte, p.config.PayloadSize)
-	binary.BigEndian.PutUint32(payload[0:4], sequence)
-	binary.BigEndian.PutUint64(payload[4:12], uint64(internal.NowNano()))
+	for {
+		n, peer, err := conn.ReadFrom(buffer)
+		recvTime := time.Now()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
 
-	// Send probe
-	sendTime := time.Now()
-	_, err := conn.Write(payload)
-	if err != nil {
-		result.Error = fmt.Errorf("send failed: %w", err)
-		return result
+		msg, err := icmp.ParseMessage(family.protocol, buffer[:n])
+		if err != nil {
+			continue
+		}
+
+		var data []byte
+		var class ErrorClass
+		var probeErr error
+		switch body := msg.Body.(type) {
+		case *icmp.TimeExceeded:
+			data, class = body.Data, ErrorTimeExceeded
+			probeErr = &TimeExceededError{Code: msg.Code, From: peer}
+		case *icmp.DstUnreach:
+			data, class = body.Data, ErrorUnreachable
+			probeErr = &DestinationUnreachableError{Code: msg.Code, From: peer}
+			if mtu, ok := fragmentationNeeded(family, msg.Code, buffer[:n]); ok {
+				class = ErrorTooBig
+				probeErr = &FragmentationNeededError{MTU: mtu, From: peer}
+			}
+		case *icmp.PacketTooBig:
+			data, class = body.Data, ErrorTooBig
+			probeErr = &FragmentationNeededError{MTU: body.MTU, From: peer}
+		default:
+			continue
+		}
+
+		// The quote must be a datagram from our socket to the target
+		protocol, dst, quoted, ok := quotedDatagram(family, data)
+		if !ok || protocol != syscall.IPPROTO_UDP || !dst.Equal(addr.IP) ||
+			int(binary.BigEndian.Uint16(quoted[0:2])) != local.Port ||
+			int(binary.BigEndian.Uint16(quoted[2:4])) != addr.Port {
+			continue
+		}
+
+		// Routers that quote past the UDP header reveal the sequence
+		// number; otherwise charge the oldest outstanding probe
+		sequence, ok := s.prober.format.quotedSequence(quoted[8:])
+		if !ok {
+			if sequence, ok = s.oldest(); !ok {
+				continue
+			}
+		}
+		s.failReply(sequence, class, probeErr, recvTime)
 	}
+}
 
-	// Receive response
-	buffer := make([]byte, 4096)
-	n, err := conn.Read(buffer)
-	if err != nil {
-		result.Error = fmt.Errorf("receive failed: %w", err)
-		return result
+// match completes the in-flight probe a reply belongs to, or records the
+// reply as late, duplicate or unmatched. Kernel transmit timestamps, keyed
+// by socket send counter, replace userspace send times.
+func (s *udpSession) match(reply udpReply, n int, recvTime time.Time, txTimes map[uint32]time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, ts := range txTimes {
+		if seq, ok := s.txKeys[key]; ok {
+			if entry, ok := s.inflight[seq]; ok {
+				entry.result.SendTime = ts
+			}
+			delete(s.txKeys, key)
+		}
 	}
 
-	receiveTime := time.Now()
-	result.RTT = receiveTime.Sub(sendTime)
-	result.PayloadLen = n
+	sequence := reply.sequence
+	entry, ok := s.inflight[sequence]
+	if !ok {
+		switch {
+		case s.answered[sequence]:
+			s.prober.countReply(func(rs *ReplyStats) { rs.Duplicate++ })
+		case s.expired[sequence]:
+			s.prober.countReply(func(rs *ReplyStats) { rs.Late++ })
+		default:
+			s.prober.countReply(func(rs *ReplyStats) { rs.Unmatched++ })
+		}
+		return
+	}
+
+	entry.timer.Stop()
+	delete(s.inflight, sequence)
+	s.answered[sequence] = true
+
+	result := entry.result
+	result.RecvTime = recvTime
+	result.RTT = recvTime.Sub(result.SendTime)
+	result.Bytes = n
 	result.Success = true
+	result.ReflectorRecv = reply.reflectorRecv
+	result.ReflectorSend = reply.reflectorSend
+
+	if sequence < s.highest {
+		result.Reordered = true
+		s.prober.countReply(func(rs *ReplyStats) { rs.Reordered++ })
+	} else {
+		s.highest = sequence
+	}
+
+	s.results <- result
+}
+
+// expire fails a probe whose timeout elapsed without a reply
+func (s *udpSession) expire(sequence uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.inflight[sequence]
+	if !ok {
+		return
+	}
+	delete(s.inflight, sequence)
+	s.expired[sequence] = true
+
+	result := entry.result
+	result.ErrorClass = ErrorTimeout
+	result.Error = fmt.Errorf("no reply within %v", s.prober.config.Timeout)
+	s.results <- result
+}
+
+// fail completes an in-flight probe with an error
+func (s *udpSession) fail(sequence uint32, class ErrorClass, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.inflight[sequence]
+	if !ok {
+		return
+	}
+	entry.timer.Stop()
+	delete(s.inflight, sequence)
+
+	result := entry.result
+	result.ErrorClass = class
+	result.Error = err
+	s.results <- result
+}
+
+// failReply completes an in-flight probe with an error reply, keeping the
+// time it took to arrive
+func (s *udpSession) failReply(sequence uint32, class ErrorClass, err error, recvTime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.inflight[sequence]
+	if !ok {
+		return
+	}
+	entry.timer.Stop()
+	delete(s.inflight, sequence)
+
+	result := entry.result
+	result.RecvTime = recvTime
+	result.RTT = recvTime.Sub(result.SendTime)
+	result.ErrorClass = class
+	result.Error = err
+	s.results <- result
+}
+
+// oldest returns the lowest outstanding sequence number
+func (s *udpSession) oldest() (uint32, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var oldest uint32
+	found := false
+	for sequence := range s.inflight {
+		if !found || sequence < oldest {
+			oldest = sequence
+			found = true
+		}
+	}
+	return oldest, found
+}
+
+// stopTimers cancels the timeouts of any probes still in flight
+func (s *udpSession) stopTimers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.inflight {
+		entry.timer.Stop()
+	}
+}
+
+// setUDPTTL sets the TTL (IPv4) or hop limit (IPv6) of outgoing datagrams
+func setUDPTTL(conn *net.UDPConn, ip net.IP, ttl int) error {
+	if ip.To4() != nil {
+		return ipv4.NewConn(conn).SetTTL(ttl)
+	}
+	return ipv6.NewConn(conn).SetHopLimit(ttl)
+}
 
-	return result
+// countReply updates the reply anomaly counters
+func (p *UDPProber) countReply(update func(*ReplyStats)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	update(&p.replies)
 }
@@ -0,0 +1,458 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startEcho runs a netprobe echo reflector on addr until the test ends and
+// returns the address it listens on
+func startEcho(t *testing.T, network, addr string) *net.UDPAddr {
+	t.Helper()
+
+	laddr, err := net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		t.Skipf("cannot resolve %s: %v", addr, err)
+	}
+	conn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		t.Skipf("cannot listen on %s %s: %v", network, addr, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 4096)
+		for {
+			n, peer, err := conn.ReadFromUDP(buffer)
+			recvTime := time.Now()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			ReflectPacket(buffer[:n], recvTime, time.Now())
+			conn.WriteToUDP(buffer[:n], peer)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+// checkResults fails the test unless results hold count successful probes
+// with sequence numbers 1 to count
+func checkResults(t *testing.T, results []Result, count int) {
+	t.Helper()
+
+	if len(results) != count {
+		t.Fatalf("got %d results, want %d", len(results), count)
+	}
+	seen := make(map[int]bool)
+	for _, r := range results {
+		if !r.Success {
+			t.Errorf("probe %d failed: %v (%s)", r.Sequence, r.Error, r.ErrorClass)
+			continue
+		}
+		if r.RTT <= 0 {
+			t.Errorf("probe %d: RTT %v, want > 0", r.Sequence, r.RTT)
+		}
+		seen[r.Sequence] = true
+	}
+	for seq := 1; seq <= count; seq++ {
+		if !seen[seq] {
+			t.Errorf("no successful result for sequence %d", seq)
+		}
+	}
+}
+
+func TestUDPProberIPv6Loopback(t *testing.T) {
+	server := startEcho(t, "udp6", "[::1]:0")
+
+	tests := []struct {
+		name          string
+		ipVersion     int
+		packetVersion int
+	}{
+		{"udp6", 6, PacketV1},
+		{"any family", 0, PacketV1},
+		{"packet version 2", 6, PacketV2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prober := NewUDPProber(UDPProbeConfig{
+				Target:        "::1",
+				Port:          server.Port,
+				Count:         3,
+				Interval:      10 * time.Millisecond,
+				Timeout:       time.Second,
+				IPVersion:     tt.ipVersion,
+				PacketVersion: tt.packetVersion,
+			})
+			results, err := prober.Probe()
+			if err != nil {
+				t.Fatalf("Probe: %v", err)
+			}
+			checkResults(t, results, 3)
+
+			for _, r := range results {
+				hasTimes := !r.ReflectorRecv.IsZero() && !r.ReflectorSend.IsZero()
+				if hasTimes != (tt.packetVersion == PacketV2) {
+					t.Errorf("probe %d: reflector timestamps %v, want %v", r.Sequence, hasTimes, tt.packetVersion == PacketV2)
+				}
+			}
+		})
+	}
+}
+
+func TestUDPProberIPv6Refused(t *testing.T) {
+	// Take a free port and close it again so nothing listens there
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("cannot listen on udp6: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	prober := NewUDPProber(UDPProbeConfig{
+		Target:    "::1",
+		Port:      port,
+		Count:     1,
+		Timeout:   time.Second,
+		IPVersion: 6,
+	})
+	results, err := prober.Probe()
+	if err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	if len(results) != 1 || results[0].ErrorClass != ErrorRefused {
+		t.Fatalf("got %+v, want one %s result", results, ErrorRefused)
+	}
+}
+
+// replyPlan gives the delay of each reply to a probe, by sequence number;
+// no delays drops the probe, and more than one duplicates the reply
+type replyPlan func(sequence uint32) []time.Duration
+
+// startReflector runs a netprobe reflector on the IPv4 loopback that answers
+// according to plan, calling inject once with the first sender's address,
+// and returns its port
+func startReflector(t *testing.T, plan replyPlan, inject func(conn *net.UDPConn, peer *net.UDPAddr)) int {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen on udp4: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 4096)
+		injected := false
+		for {
+			n, peer, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			packet, err := ParsePacket(buffer[:n])
+			if err != nil {
+				continue
+			}
+			if inject != nil && !injected {
+				inject(conn, peer)
+				injected = true
+			}
+
+			reply := append([]byte(nil), buffer[:n]...)
+			for _, delay := range plan(packet.Sequence) {
+				time.AfterFunc(delay, func() { conn.WriteToUDP(reply, peer) })
+			}
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// answerAll replies to every probe at once, except as overridden
+func answerAll(overrides map[uint32][]time.Duration) replyPlan {
+	return func(sequence uint32) []time.Duration {
+		if delays, ok := overrides[sequence]; ok {
+			return delays
+		}
+		return []time.Duration{0}
+	}
+}
+
+func TestUDPProberReplies(t *testing.T) {
+	const (
+		count    = 10
+		interval = 40 * time.Millisecond
+		timeout  = 150 * time.Millisecond
+	)
+	unknown := func(conn *net.UDPConn, peer *net.UDPAddr) {
+		packet := make([]byte, PacketV1Len)
+		(&Packet{Version: PacketV1, Sequence: 99}).Marshal(packet)
+		conn.WriteToUDP(packet, peer)
+		conn.WriteToUDP([]byte{0xff, 0xff}, peer)
+	}
+
+	tests := []struct {
+		name      string
+		plan      replyPlan
+		inject    func(conn *net.UDPConn, peer *net.UDPAddr)
+		timeouts  []int // Sequences that should time out
+		reordered []int // Sequences whose replies should be marked reordered
+		stats     ReplyStats
+	}{
+		{
+			name: "all answered",
+			plan: answerAll(nil),
+		},
+		{
+			name:     "dropped",
+			plan:     answerAll(map[uint32][]time.Duration{2: nil, 5: nil}),
+			timeouts: []int{2, 5},
+		},
+		{
+			// Arrives 100ms after its probe timed out, while later probes
+			// are still running
+			name:     "late",
+			plan:     answerAll(map[uint32][]time.Duration{1: {timeout + 100*time.Millisecond}}),
+			timeouts: []int{1},
+			stats:    ReplyStats{Late: 1},
+		},
+		{
+			name:  "duplicate",
+			plan:  answerAll(map[uint32][]time.Duration{2: {0, 10 * time.Millisecond}}),
+			stats: ReplyStats{Duplicate: 1},
+		},
+		{
+			// Held until after the reply to probe 3, within the timeout
+			name:      "reordered",
+			plan:      answerAll(map[uint32][]time.Duration{2: {interval + interval/2}}),
+			reordered: []int{2},
+			stats:     ReplyStats{Reordered: 1},
+		},
+		{
+			name:   "unmatched",
+			plan:   answerAll(nil),
+			inject: unknown,
+			stats:  ReplyStats{Unmatched: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := startReflector(t, tt.plan, tt.inject)
+			prober := NewUDPProber(UDPProbeConfig{
+				Target:    "127.0.0.1",
+				Port:      port,
+				Count:     count,
+				Interval:  interval,
+				Timeout:   timeout,
+				IPVersion: 4,
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var results []Result
+			if err := prober.ProbeStream(ctx, func(r Result) { results = append(results, r) }); err != nil {
+				t.Fatalf("ProbeStream: %v", err)
+			}
+			if len(results) != count {
+				t.Fatalf("got %d results, want %d", len(results), count)
+			}
+
+			bySequence := make(map[int]Result)
+			for _, r := range results {
+				if _, ok := bySequence[r.Sequence]; ok {
+					t.Fatalf("two results for sequence %d", r.Sequence)
+				}
+				bySequence[r.Sequence] = r
+			}
+			timeouts := setOf(tt.timeouts)
+			reordered := setOf(tt.reordered)
+			for seq := 1; seq <= count; seq++ {
+				r, ok := bySequence[seq]
+				switch {
+				case !ok:
+					t.Errorf("no result for sequence %d", seq)
+				case timeouts[seq]:
+					if r.Success || r.ErrorClass != ErrorTimeout {
+						t.Errorf("probe %d: success %v class %q, want %s", seq, r.Success, r.ErrorClass, ErrorTimeout)
+					}
+				case !r.Success || r.ErrorClass != ErrorNone:
+					t.Errorf("probe %d failed: %v (%s)", seq, r.Error, r.ErrorClass)
+				case r.Reordered != reordered[seq]:
+					t.Errorf("probe %d: reordered %v, want %v", seq, r.Reordered, reordered[seq])
+				}
+			}
+
+			if got := prober.ReplyStats(); got != tt.stats {
+				t.Errorf("ReplyStats() = %+v, want %+v", got, tt.stats)
+			}
+		})
+	}
+}
+
+// setOf returns the sequences as a set
+func setOf(sequences []int) map[int]bool {
+	set := make(map[int]bool, len(sequences))
+	for _, seq := range sequences {
+		set[seq] = true
+	}
+	return set
+}
+
+// failingFormat is a version 1 packet format that cannot encode one probe
+type failingFormat struct {
+	packetFormat
+	sequence uint32
+}
+
+func (f failingFormat) marshal(b []byte, sequence uint32, sendTime time.Time) error {
+	if sequence == f.sequence {
+		return errors.New("cannot encode")
+	}
+	return f.packetFormat.marshal(b, sequence, sendTime)
+}
+
+func TestUDPProberMarshalFailure(t *testing.T) {
+	port := startReflector(t, answerAll(nil), nil)
+	prober := newUDPProber(UDPProbeConfig{
+		Target:    "127.0.0.1",
+		Port:      port,
+		Count:     3,
+		Interval:  10 * time.Millisecond,
+		Timeout:   time.Second,
+		IPVersion: 4,
+	}, failingFormat{packetFormat{version: PacketV1}, 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var results []Result
+	if err := prober.ProbeStream(ctx, func(r Result) { results = append(results, r) }); err != nil {
+		t.Fatalf("ProbeStream: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	for _, r := range results {
+		wantSuccess := r.Sequence != 2
+		if r.Success != wantSuccess {
+			t.Errorf("probe %d: success %v, want %v", r.Sequence, r.Success, wantSuccess)
+		}
+		if !wantSuccess && r.ErrorClass != ErrorSend {
+			t.Errorf("probe %d: class %q, want %s", r.Sequence, r.ErrorClass, ErrorSend)
+		}
+	}
+}
+
+// checkCancellation streams a run of count probes, cancels it once after
+// results have arrived, and checks that it returns promptly with the
+// partial results, delivers nothing afterwards and leaves no goroutines
+// behind. It returns false if the run failed to start.
+func checkCancellation(t *testing.T, p Prober, count, after int) bool {
+	t.Helper()
+
+	baseline := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var results []Result
+	var cancelled time.Time
+	returned := false
+	err := p.ProbeStream(ctx, func(r Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if returned {
+			t.Errorf("result for probe %d delivered after ProbeStream returned", r.Sequence)
+		}
+		results = append(results, r)
+		if len(results) == after {
+			cancelled = time.Now()
+			cancel()
+		}
+	})
+	mu.Lock()
+	returned = true
+	n := len(results)
+	mu.Unlock()
+
+	if err != nil && !errors.Is(err, context.Canceled) && n == 0 {
+		return false
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ProbeStream = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(cancelled); elapsed > 250*time.Millisecond {
+		t.Errorf("ProbeStream took %v to return after cancellation", elapsed)
+	}
+	if n < after || n >= count {
+		t.Errorf("got %d results, want at least %d of %d", n, after, count)
+	}
+
+	// Give in-flight replies and timers a chance to deliver late results
+	// and the run's goroutines time to exit
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if leaked := runtime.NumGoroutine() - baseline; leaked > 0 {
+		buf := make([]byte, 1<<16)
+		t.Errorf("%d goroutines still running after cancellation:\n%s", leaked, buf[:runtime.Stack(buf, true)])
+	}
+	return true
+}
+
+func TestUDPProberCancel(t *testing.T) {
+	// Replies take 30ms and stop after probe 5, so probes are still in
+	// flight, awaiting replies or their 5s timeout, when the run is cancelled
+	port := startReflector(t, func(sequence uint32) []time.Duration {
+		if sequence > 5 {
+			return nil
+		}
+		return []time.Duration{30 * time.Millisecond}
+	}, nil)
+	prober := NewUDPProber(UDPProbeConfig{
+		Target:    "127.0.0.1",
+		Port:      port,
+		Count:     50,
+		Interval:  10 * time.Millisecond,
+		Timeout:   5 * time.Second,
+		IPVersion: 4,
+	})
+	if !checkCancellation(t, prober, 50, 3) {
+		t.Fatal("UDP run failed to start")
+	}
+
+	// ProbeContext hands back what it has so far
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	results, err := prober.ProbeContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ProbeContext = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 450*time.Millisecond {
+		t.Errorf("ProbeContext took %v with a 200ms deadline", elapsed)
+	}
+	if len(results) == 0 || len(results) >= 50 {
+		t.Fatalf("got %d results, want some but not all of 50", len(results))
+	}
+	for _, r := range results {
+		if r.Sequence > 5 || !r.Success {
+			t.Errorf("probe %d: success %v (%v), want only answered probes before the deadline", r.Sequence, r.Success, r.Error)
+		}
+	}
+}
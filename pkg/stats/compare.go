@@ -0,0 +1,250 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Comparison settings
+const (
+	CompareAlpha       = 0.05  // Significance level of the tests
+	CompareBootstrap   = 2000  // Bootstrap resamples for confidence intervals
+	negligibleEffect   = 0.147 // Cliff's delta below this is negligible (Romano et al.)
+	compareBootstrapCI = 95    // Confidence level of the intervals, as a percentage
+)
+
+var errCompareEmpty = errors.New("both runs need at least one sample")
+
+// Comparison describes how latency changed from run A to run B. Differences
+// are B minus A, so positive values mean B is slower.
+type Comparison struct {
+	CountA, CountB   int
+	MedianA, MedianB time.Duration
+	P99A, P99B       time.Duration
+
+	MedianDiff     time.Duration // Median of B minus median of A
+	MedianDiffLow  time.Duration // Lower bound of the 95% bootstrap interval
+	MedianDiffHigh time.Duration // Upper bound of the 95% bootstrap interval
+	P99Diff        time.Duration // P99 of B minus p99 of A
+	P99DiffLow     time.Duration
+	P99DiffHigh    time.Duration
+
+	MannWhitneyU float64 // U statistic of B
+	MannWhitneyP float64 // Two-sided p-value, normal approximation with tie correction
+	KSStatistic  float64 // Largest distance between the two empirical CDFs
+	KSP          float64 // Two-sided asymptotic p-value
+
+	EffectSize      float64 // Cliff's delta: P(B > A) - P(B < A), from -1 to 1
+	EffectMagnitude string  // "Negligible", "Small", "Medium" or "Large"
+	Verdict         string  // "Worse", "Better", "Distribution changed" or "No significant change"
+}
+
+// Compare tests whether the latency samples of run B differ from those of
+// run A. The Mann-Whitney U test and Cliff's delta decide whether B tends
+// to be slower or faster; the Kolmogorov-Smirnov test also catches changes
+// in spread or shape that leave the typical value alone. Confidence
+// intervals for the median and p99 differences come from a bootstrap with
+// a fixed seed, so the same inputs always give the same result.
+func Compare(a, b []time.Duration) (Comparison, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return Comparison{}, errCompareEmpty
+	}
+
+	sa, sb := sortedFloats(a), sortedFloats(b)
+	c := Comparison{
+		CountA:  len(a),
+		CountB:  len(b),
+		MedianA: time.Duration(quantile(sa, 50)),
+		MedianB: time.Duration(quantile(sb, 50)),
+		P99A:    time.Duration(quantile(sa, 99)),
+		P99B:    time.Duration(quantile(sb, 99)),
+	}
+	c.MedianDiff = c.MedianB - c.MedianA
+	c.P99Diff = c.P99B - c.P99A
+
+	c.MannWhitneyU, c.MannWhitneyP = mannWhitney(sa, sb)
+	c.EffectSize = 2*c.MannWhitneyU/(float64(len(a))*float64(len(b))) - 1
+	c.EffectMagnitude = assessEffect(c.EffectSize)
+	c.KSStatistic, c.KSP = kolmogorovSmirnov(sa, sb)
+
+	c.MedianDiffLow, c.MedianDiffHigh, c.P99DiffLow, c.P99DiffHigh = bootstrapDiffs(sa, sb)
+
+	switch {
+	case c.MannWhitneyP < CompareAlpha && math.Abs(c.EffectSize) >= negligibleEffect:
+		if c.EffectSize > 0 {
+			c.Verdict = "Worse"
+		} else {
+			c.Verdict = "Better"
+		}
+	case c.KSP < CompareAlpha:
+		c.Verdict = "Distribution changed"
+	default:
+		c.Verdict = "No significant change"
+	}
+
+	return c, nil
+}
+
+// sortedFloats returns the samples in nanoseconds, sorted
+func sortedFloats(d []time.Duration) []float64 {
+	f := make([]float64, len(d))
+	for i, v := range d {
+		f[i] = float64(v)
+	}
+	sort.Float64s(f)
+	return f
+}
+
+// quantile interpolates the pth percentile of sorted values like
+// LatencyHistogram.Percentile
+func quantile(sorted []float64, p float64) float64 {
+	index := (p / 100.0) * float64(len(sorted)-1)
+	lower := int(index)
+	if lower+1 >= len(sorted) {
+		return sorted[lower]
+	}
+	frac := index - float64(lower)
+	return sorted[lower]*(1-frac) + sorted[lower+1]*frac
+}
+
+// mannWhitney returns the U statistic of b against a and its two-sided
+// p-value from the normal approximation with tie and continuity corrections
+func mannWhitney(a, b []float64) (u, p float64) {
+	na, nb := float64(len(a)), float64(len(b))
+	n := na + nb
+
+	// Rank b within the merged samples, giving ties their mean rank
+	var rankSumB, tieTerm float64
+	i, j := 0, 0
+	rank := 1.0
+	for i < len(a) || j < len(b) {
+		var v float64
+		if j >= len(b) || (i < len(a) && a[i] < b[j]) {
+			v = a[i]
+		} else {
+			v = b[j]
+		}
+		ta, tb := 0, 0
+		for i < len(a) && a[i] == v {
+			ta++
+			i++
+		}
+		for j < len(b) && b[j] == v {
+			tb++
+			j++
+		}
+		t := float64(ta + tb)
+		meanRank := rank + (t-1)/2
+		rankSumB += meanRank * float64(tb)
+		tieTerm += t*t*t - t
+		rank += t
+	}
+
+	u = rankSumB - nb*(nb+1)/2
+	mean := na * nb / 2
+	variance := na * nb / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if n < 2 || variance <= 0 {
+		return u, 1
+	}
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return u, math.Erfc(z / math.Sqrt2)
+}
+
+// kolmogorovSmirnov returns the two-sample KS statistic and its asymptotic
+// two-sided p-value (Numerical Recipes, section 14.3)
+func kolmogorovSmirnov(a, b []float64) (d, p float64) {
+	na, nb := float64(len(a)), float64(len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		v := math.Min(a[i], b[j])
+		for i < len(a) && a[i] == v {
+			i++
+		}
+		for j < len(b) && b[j] == v {
+			j++
+		}
+		d = math.Max(d, math.Abs(float64(i)/na-float64(j)/nb))
+	}
+
+	ne := math.Sqrt(na * nb / (na + nb))
+	lambda := (ne + 0.12 + 0.11/ne) * d
+	return d, ksProbability(lambda)
+}
+
+// ksProbability is the Kolmogorov distribution tail Q(lambda)
+func ksProbability(lambda float64) float64 {
+	if lambda < 0.2 {
+		return 1
+	}
+	sum, sign := 0.0, 1.0
+	for k := 1; k <= 100; k++ {
+		term := sign * 2 * math.Exp(-2*float64(k*k)*lambda*lambda)
+		sum += term
+		if math.Abs(term) < 1e-10 {
+			break
+		}
+		sign = -sign
+	}
+	return math.Max(0, math.Min(1, sum))
+}
+
+// bootstrapDiffs resamples both runs and returns the 95% percentile
+// intervals of the median and p99 differences
+func bootstrapDiffs(a, b []float64) (medLow, medHigh, p99Low, p99High time.Duration) {
+	rng := rand.New(rand.NewSource(1))
+	ra := make([]float64, len(a))
+	rb := make([]float64, len(b))
+	medians := make([]float64, CompareBootstrap)
+	p99s := make([]float64, CompareBootstrap)
+
+	resample := func(dst, src []float64) {
+		for i := range dst {
+			dst[i] = src[rng.Intn(len(src))]
+		}
+		sort.Float64s(dst)
+	}
+	for i := 0; i < CompareBootstrap; i++ {
+		resample(ra, a)
+		resample(rb, b)
+		medians[i] = quantile(rb, 50) - quantile(ra, 50)
+		p99s[i] = quantile(rb, 99) - quantile(ra, 99)
+	}
+	sort.Float64s(medians)
+	sort.Float64s(p99s)
+
+	tail := float64(100-compareBootstrapCI) / 2
+	return time.Duration(quantile(medians, tail)), time.Duration(quantile(medians, 100-tail)),
+		time.Duration(quantile(p99s, tail)), time.Duration(quantile(p99s, 100-tail))
+}
+
+// assessEffect rates the size of Cliff's delta (Romano et al., 2006)
+func assessEffect(delta float64) string {
+	switch d := math.Abs(delta); {
+	case d < negligibleEffect:
+		return "Negligible"
+	case d < 0.33:
+		return "Small"
+	case d < 0.474:
+		return "Medium"
+	default:
+		return "Large"
+	}
+}
+
+// String returns a formatted string representation
+func (c Comparison) String() string {
+	return fmt.Sprintf(
+		"%s: median %+.3fms [%+.3f, %+.3f], p99 %+.3fms [%+.3f, %+.3f], Mann-Whitney p=%.4f, KS p=%.4f, Cliff's delta %+.3f (%s)",
+		c.Verdict,
+		c.MedianDiff.Seconds()*1000, c.MedianDiffLow.Seconds()*1000, c.MedianDiffHigh.Seconds()*1000,
+		c.P99Diff.Seconds()*1000, c.P99DiffLow.Seconds()*1000, c.P99DiffHigh.Seconds()*1000,
+		c.MannWhitneyP, c.KSP, c.EffectSize, c.EffectMagnitude,
+	)
+}
@@ -0,0 +1,157 @@
+package stats
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// durations converts whole units to durations
+func durations(unit time.Duration, values ...int) []time.Duration {
+	d := make([]time.Duration, len(values))
+	for i, v := range values {
+		d[i] = time.Duration(v) * unit
+	}
+	return d
+}
+
+func TestCompareTextbook(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      []time.Duration
+		u, p      float64
+		ks, ksP   float64
+		effect    float64
+		magnitude string
+	}{
+		{
+			// B beats A in 20 of 30 pairs; with no ties the variance is
+			// na*nb*(n+1)/12 = 30, so z = (5 - 0.5) / sqrt(30)
+			name:      "no ties",
+			a:         durations(time.Millisecond, 1, 3, 5, 7, 9),
+			b:         durations(time.Millisecond, 2, 4, 6, 8, 10, 12),
+			u:         20,
+			p:         0.411314,
+			ks:        1.0 / 3,
+			ksP:       0.847054,
+			effect:    1.0 / 3,
+			magnitude: "Medium",
+		},
+		{
+			// Two ties of three: the variance drops to
+			// 16/12 * (9 - 48/56) = 10.857
+			name:      "ties",
+			a:         durations(time.Millisecond, 1, 2, 2, 3),
+			b:         durations(time.Millisecond, 2, 3, 3, 4),
+			u:         13,
+			p:         0.172034,
+			ks:        0.5,
+			effect:    0.625,
+			magnitude: "Large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Compare(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("Compare: %v", err)
+			}
+			if c.MannWhitneyU != tt.u || math.Abs(c.MannWhitneyP-tt.p) > 1e-6 {
+				t.Errorf("U = %v p = %v, want %v and %v", c.MannWhitneyU, c.MannWhitneyP, tt.u, tt.p)
+			}
+			if math.Abs(c.KSStatistic-tt.ks) > 1e-9 {
+				t.Errorf("KS D = %v, want %v", c.KSStatistic, tt.ks)
+			}
+			if tt.ksP > 0 && math.Abs(c.KSP-tt.ksP) > 1e-6 {
+				t.Errorf("KS p = %v, want %v", c.KSP, tt.ksP)
+			}
+			if math.Abs(c.EffectSize-tt.effect) > 1e-9 || c.EffectMagnitude != tt.magnitude {
+				t.Errorf("effect %v (%s), want %v (%s)", c.EffectSize, c.EffectMagnitude, tt.effect, tt.magnitude)
+			}
+			// Too few samples for significance either way
+			if c.Verdict != "No significant change" {
+				t.Errorf("verdict %q, want no significant change", c.Verdict)
+			}
+		})
+	}
+}
+
+func TestCompareVerdict(t *testing.T) {
+	base := testSamples(500, 10)
+	shifted := make([]time.Duration, len(base))
+	for i, d := range base {
+		shifted[i] = d + 10*time.Millisecond
+	}
+
+	// Same median, ten times the spread
+	rng := rand.New(rand.NewSource(11))
+	narrow := make([]time.Duration, 500)
+	wide := make([]time.Duration, 500)
+	for i := range narrow {
+		narrow[i] = 20*time.Millisecond + time.Duration((rng.Float64()-0.5)*float64(2*time.Millisecond))
+		wide[i] = 20*time.Millisecond + time.Duration((rng.Float64()-0.5)*float64(20*time.Millisecond))
+	}
+
+	tests := []struct {
+		name    string
+		a, b    []time.Duration
+		verdict string
+	}{
+		{"identical", base, base, "No significant change"},
+		{"slower", base, shifted, "Worse"},
+		{"faster", shifted, base, "Better"},
+		{"wider", narrow, wide, "Distribution changed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Compare(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("Compare: %v", err)
+			}
+			if c.Verdict != tt.verdict {
+				t.Fatalf("verdict %q, want %q: %v", c.Verdict, tt.verdict, c)
+			}
+			if c.MedianDiffLow > c.MedianDiff || c.MedianDiff > c.MedianDiffHigh {
+				t.Errorf("median difference %v outside its interval [%v, %v]", c.MedianDiff, c.MedianDiffLow, c.MedianDiffHigh)
+			}
+			if c.P99DiffLow > c.P99DiffHigh {
+				t.Errorf("p99 interval [%v, %v] inverted", c.P99DiffLow, c.P99DiffHigh)
+			}
+		})
+	}
+
+	c, _ := Compare(base, base)
+	if c.MannWhitneyP != 1 || c.KSStatistic != 0 || c.EffectSize != 0 || c.MedianDiff != 0 {
+		t.Errorf("identical runs: %v", c)
+	}
+	c, _ = Compare(base, shifted)
+	if c.MedianDiff != 10*time.Millisecond || c.MedianDiffLow > 10*time.Millisecond || c.MedianDiffHigh < 10*time.Millisecond {
+		t.Errorf("shifted by 10ms: median difference %v [%v, %v]", c.MedianDiff, c.MedianDiffLow, c.MedianDiffHigh)
+	}
+}
+
+func TestCompareBootstrapDeterministic(t *testing.T) {
+	a, b := testSamples(300, 12), testSamples(200, 13)
+	first, err := Compare(a, b)
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if c, _ := Compare(a, b); c != first {
+			t.Fatalf("run %d: %v, first %v", i+2, c, first)
+		}
+	}
+	if first.MedianDiffLow == first.MedianDiffHigh {
+		t.Errorf("degenerate median interval [%v, %v]", first.MedianDiffLow, first.MedianDiffHigh)
+	}
+}
+
+func TestCompareEmpty(t *testing.T) {
+	if _, err := Compare(nil, durations(time.Millisecond, 1)); !errors.Is(err, errCompareEmpty) {
+		t.Fatalf("Compare with an empty run: %v, want errCompareEmpty", err)
+	}
+}
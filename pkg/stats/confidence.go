@@ -0,0 +1,138 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultConfidence is the confidence level of percentile intervals, as a
+// percentage
+const DefaultConfidence = 95.0
+
+// ReportedPercentiles are the percentiles given in HistogramStats
+var ReportedPercentiles = []float64{50, 90, 99, 99.9}
+
+// PercentileCI is a percentile estimate with a distribution-free confidence
+// interval. The bounds are order statistics X(l) and X(u) chosen so that the
+// number of samples below the true percentile, which is binomial, falls
+// between l and u-1 with at least the given confidence.
+//
+// With too few samples the interval reaches past the smallest or largest
+// sample; the bound is then reported as the observed minimum or maximum and
+// Bounded is false.
+type PercentileCI struct {
+	Percentile float64       // Percentile, 0-100
+	Value      time.Duration // Point estimate
+	Lower      time.Duration // Lower bound of the interval
+	Upper      time.Duration // Upper bound of the interval
+	Confidence float64       // Confidence level, as a percentage
+	Bounded    bool          // Whether both bounds lie within the samples
+	MinSamples int           // Samples needed for a bounded interval
+}
+
+// PercentileInterval computes the confidence interval of the pth percentile
+// (0-100) of a distribution at the given confidence level (0-100)
+func PercentileInterval(d Distribution, p, confidence float64) PercentileCI {
+	ci := PercentileCI{
+		Percentile: p,
+		Value:      d.Percentile(p),
+		Confidence: confidence,
+		MinSamples: MinSamplesForInterval(p, confidence),
+	}
+
+	n := d.Count()
+	if n == 0 {
+		return ci
+	}
+
+	lo, hi := binomialRanks(n, p/100, 1-confidence/100)
+	ci.Bounded = lo >= 1 && hi <= n
+	ci.Lower, ci.Upper = d.Min(), d.Max()
+	if lo >= 1 {
+		ci.Lower = d.OrderStatistic(lo)
+	}
+	if hi <= n {
+		ci.Upper = d.OrderStatistic(hi)
+	}
+
+	return ci
+}
+
+// PercentileIntervals computes confidence intervals for the
+// ReportedPercentiles of a distribution
+func PercentileIntervals(d Distribution, confidence float64) []PercentileCI {
+	cis := make([]PercentileCI, len(ReportedPercentiles))
+	for i, p := range ReportedPercentiles {
+		cis[i] = PercentileInterval(d, p, confidence)
+	}
+	return cis
+}
+
+// MinSamplesForInterval returns the smallest number of samples for which
+// the interval of the pth percentile lies within the samples. That needs
+// both the chance of every sample falling below the percentile, q^n, and
+// of none doing so, (1-q)^n, to be at most half of 1 - confidence.
+func MinSamplesForInterval(p, confidence float64) int {
+	q := p / 100
+	if q <= 0 || q >= 1 {
+		return 1
+	}
+	tail := math.Log((1 - confidence/100) / 2)
+	n := math.Max(tail/math.Log(q), tail/math.Log(1-q))
+	return int(math.Ceil(n - 1e-9))
+}
+
+// binomialRanks returns the one-based ranks l and u of the order statistics
+// bounding the q quantile of n samples with error rate alpha: l is the
+// largest rank with P(B < l) <= alpha/2 and u the smallest with
+// P(B >= u) <= alpha/2, where B ~ Binomial(n, q). A rank of 0 or n+1 means
+// that bound lies beyond the samples.
+func binomialRanks(n int, q, alpha float64) (lo, hi int) {
+	if q <= 0 {
+		return 1, 1
+	}
+	if q >= 1 {
+		return n, n
+	}
+
+	// Binomial mass more than ten standard deviations from the mean is
+	// negligible, so the CDF only needs summing near it
+	mean := float64(n) * q
+	sd := math.Sqrt(mean * (1 - q))
+	first := max(0, int(mean-10*sd)-10)
+	last := min(n, int(mean+10*sd)+10)
+
+	lgN, _ := math.Lgamma(float64(n + 1))
+	lgK, _ := math.Lgamma(float64(first + 1))
+	lgNK, _ := math.Lgamma(float64(n - first + 1))
+	logPMF := lgN - lgK - lgNK + float64(first)*math.Log(q) + float64(n-first)*math.Log(1-q)
+	logOdds := math.Log(q / (1 - q))
+
+	lo, hi = first, n+1
+	cdf := 0.0
+	for k := first; k <= last; k++ {
+		cdf += math.Exp(logPMF)
+		if cdf <= alpha/2 {
+			lo = k + 1
+		}
+		if cdf >= 1-alpha/2 {
+			hi = k + 1
+			break
+		}
+		logPMF += math.Log(float64(n-k)/float64(k+1)) + logOdds
+	}
+
+	return lo, hi
+}
+
+// String returns a formatted string representation
+func (ci PercentileCI) String() string {
+	s := fmt.Sprintf("p%g: %.3fms, %g%% CI [%.3fms, %.3fms]",
+		ci.Percentile, ci.Value.Seconds()*1000, ci.Confidence,
+		ci.Lower.Seconds()*1000, ci.Upper.Seconds()*1000)
+	if !ci.Bounded {
+		s += fmt.Sprintf(" (unbounded, needs %d samples)", ci.MinSamples)
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+// millisecondSamples returns 1ms, 2ms, ... nms in shuffled order
+func millisecondSamples(n int) []time.Duration {
+	samples := make([]time.Duration, n)
+	for i := range samples {
+		samples[i] = time.Duration((i*7919)%n+1) * time.Millisecond
+	}
+	return samples
+}
+
+func TestPercentileInterval(t *testing.T) {
+	tests := []struct {
+		name         string
+		n            int
+		p            float64
+		lower, upper time.Duration
+		bounded      bool
+	}{
+		// Ranks 40 and 61 of 100 bound the median with 95% confidence
+		{"median of 100", 100, 50, 40 * time.Millisecond, 61 * time.Millisecond, true},
+		{"p90 of 1000", 1000, 90, 881 * time.Millisecond, 919 * time.Millisecond, true},
+		// Too few samples for p99: the upper bound is cut at the maximum
+		{"p99 of 100", 100, 99, 97 * time.Millisecond, 100 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := millisecondSamples(tt.n)
+			lo, hi := binomialRanks(tt.n, tt.p/100, 0.05)
+
+			exact := NewLatencyHistogram(tt.n)
+			exact.AddSamples(samples)
+			ci := PercentileInterval(exact, tt.p, DefaultConfidence)
+			if ci.Lower != tt.lower || ci.Upper != tt.upper || ci.Bounded != tt.bounded {
+				t.Fatalf("interval [%v, %v] bounded %v (ranks %d and %d), want [%v, %v] bounded %v",
+					ci.Lower, ci.Upper, ci.Bounded, lo, hi, tt.lower, tt.upper, tt.bounded)
+			}
+			if ci.Value != exact.Percentile(tt.p) {
+				t.Errorf("point estimate %v, want %v", ci.Value, exact.Percentile(tt.p))
+			}
+
+			// Bucketed distributions read the same ranks, to their precision
+			for _, d := range []Distribution{NewHDRHistogram(0, 3), NewDDSketch(0, 0)} {
+				d.AddSamples(samples)
+				ci := PercentileInterval(d, tt.p, DefaultConfidence)
+				for _, b := range [][2]time.Duration{{ci.Lower, tt.lower}, {ci.Upper, tt.upper}} {
+					if diff := b[0] - b[1]; diff < -b[1]/100 || diff > b[1]/100 {
+						t.Errorf("%T: interval [%v, %v], want [%v, %v]", d, ci.Lower, ci.Upper, tt.lower, tt.upper)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestOrderStatistic(t *testing.T) {
+	samples := millisecondSamples(50)
+	for _, d := range []Distribution{NewLatencyHistogram(50), NewHDRHistogram(0, 3), NewDDSketch(0, 0)} {
+		d.AddSamples(samples)
+		for k := 1; k <= 50; k++ {
+			want := time.Duration(k) * time.Millisecond
+			if got := d.OrderStatistic(k); got-want < -want/100 || got-want > want/100 {
+				t.Errorf("%T: order statistic %d = %v, want %v", d, k, got, want)
+			}
+		}
+		if d.OrderStatistic(0) != 0 || d.OrderStatistic(51) != 0 {
+			t.Errorf("%T: out of range ranks give %v and %v", d, d.OrderStatistic(0), d.OrderStatistic(51))
+		}
+	}
+}
+
+func TestMinSamplesForInterval(t *testing.T) {
+	for _, tt := range []struct {
+		p    float64
+		want int
+	}{
+		{50, 6}, {90, 36}, {99, 368}, {99.9, 3688}, {0, 1}, {100, 1},
+	} {
+		if got := MinSamplesForInterval(tt.p, DefaultConfidence); got != tt.want {
+			t.Errorf("MinSamplesForInterval(%g) = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// DDSketch defaults
+const (
+	DefaultSketchAccuracy = 0.01 // 1% relative error
+	DefaultSketchMaxBins  = 2048 // Enough for 1ns to years at 1%
+)
+
+var errSketchMismatch = errors.New("sketches have different relative accuracy")
+
+// DDSketch is a streaming quantile sketch with bounded relative error
+// (Masson, Rim and Lee, VLDB 2019). Values in nanoseconds are counted in
+// bins whose bounds grow geometrically by gamma = (1+a)/(1-a), so every
+// percentile is within a relative error a of the true value. At most
+// maxBins bins are kept; beyond that the lowest bins are folded together,
+// which only affects the lowest percentiles.
+//
+// Sketches with the same accuracy merge exactly, and they encode to JSON,
+// so agents can ship sketches to a collector that computes percentiles
+// over all of them without raw samples.
+type DDSketch struct {
+	accuracy float64 // Relative accuracy a
+	gamma    float64 // Bin growth factor
+	logGamma float64 // ln(gamma)
+	maxBins  int     // Bin limit
+
+	offset int      // Key of bins[0]
+	bins   []uint64 // Counts for consecutive keys
+	zero   uint64   // Values below one nanosecond
+	count  uint64   // Samples recorded
+	mean   float64  // Running mean in nanoseconds (Welford)
+	m2     float64  // Running sum of squared deviations (Welford)
+	min    float64  // Smallest sample in nanoseconds
+	max    float64  // Largest sample in nanoseconds
+}
+
+// NewDDSketch creates a sketch with the given relative accuracy (between 0
+// and 1) and bin limit. Zero arguments select DefaultSketchAccuracy and
+// DefaultSketchMaxBins.
+func NewDDSketch(accuracy float64, maxBins int) *DDSketch {
+	if accuracy <= 0 || accuracy >= 1 {
+		accuracy = DefaultSketchAccuracy
+	}
+	if maxBins <= 0 {
+		maxBins = DefaultSketchMaxBins
+	}
+
+	gamma := (1 + accuracy) / (1 - accuracy)
+	return &DDSketch{
+		accuracy: accuracy,
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		maxBins:  maxBins,
+		min:      math.Inf(1),
+		max:      math.Inf(-1),
+	}
+}
+
+// key returns the bin of a value of at least one nanosecond
+func (s *DDSketch) key(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// value returns the point of a bin within the relative accuracy of every
+// value in it
+func (s *DDSketch) value(key int) float64 {
+	return 2 * math.Pow(s.gamma, float64(key)) / (s.gamma + 1)
+}
+
+// AddSample adds an RTT sample to the sketch. Negative values count as zero.
+func (s *DDSketch) AddSample(rtt time.Duration) {
+	v := float64(rtt)
+	if v < 0 {
+		v = 0
+	}
+
+	if v < 1 {
+		s.zero++
+	} else {
+		s.addToBin(s.key(v), 1)
+	}
+	s.addMoments(1, v, 0)
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+}
+
+// addMoments folds n samples with the given mean and sum of squared
+// deviations into the running mean and variance (Chan et al.)
+func (s *DDSketch) addMoments(n uint64, mean, m2 float64) {
+	total := s.count + n
+	delta := mean - s.mean
+	s.mean += delta * float64(n) / float64(total)
+	s.m2 += m2 + delta*delta*float64(s.count)*float64(n)/float64(total)
+	s.count = total
+}
+
+// AddSamples adds multiple RTT samples
+func (s *DDSketch) AddSamples(rtts []time.Duration) {
+	for _, rtt := range rtts {
+		s.AddSample(rtt)
+	}
+}
+
+// addToBin adds n to a bin, growing the store and folding the lowest bins
+// into one when it would exceed maxBins
+func (s *DDSketch) addToBin(key int, n uint64) {
+	if len(s.bins) == 0 {
+		s.offset = key
+		s.bins = []uint64{n}
+		return
+	}
+
+	high := s.offset + len(s.bins) - 1
+	if key > high {
+		high = key
+	}
+	low := s.offset
+	if key < low {
+		low = key
+	}
+	if high-low+1 > s.maxBins {
+		low = high - s.maxBins + 1
+	}
+
+	// Grow downwards, or fold everything below low into it
+	switch {
+	case low < s.offset:
+		s.bins = append(make([]uint64, s.offset-low), s.bins...)
+		s.offset = low
+	case low > s.offset:
+		shift := low - s.offset
+		var folded uint64
+		for i := 0; i < shift && i < len(s.bins); i++ {
+			folded += s.bins[i]
+		}
+		if shift < len(s.bins) {
+			s.bins = s.bins[shift:]
+		} else {
+			s.bins = s.bins[:0]
+		}
+		s.offset = low
+		if len(s.bins) == 0 {
+			s.bins = append(s.bins, 0)
+		}
+		s.bins[0] += folded
+	}
+
+	// Grow upwards
+	if extra := high - (s.offset + len(s.bins) - 1); extra > 0 {
+		s.bins = append(s.bins, make([]uint64, extra)...)
+	}
+
+	if key < s.offset {
+		key = s.offset
+	}
+	s.bins[key-s.offset] += n
+}
+
+// Merge adds all samples of other to s. Both must have the same relative
+// accuracy.
+func (s *DDSketch) Merge(other *DDSketch) error {
+	if s.gamma != other.gamma {
+		return errSketchMismatch
+	}
+	if other.count == 0 {
+		return nil
+	}
+
+	for i, n := range other.bins {
+		if n > 0 {
+			s.addToBin(other.offset+i, n)
+		}
+	}
+	s.zero += other.zero
+	s.addMoments(other.count, other.mean, other.m2)
+	s.min = math.Min(s.min, other.min)
+	s.max = math.Max(s.max, other.max)
+	return nil
+}
+
+// Count returns the number of samples
+func (s *DDSketch) Count() int {
+	return int(s.count)
+}
+
+// Min returns the minimum latency
+func (s *DDSketch) Min() time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	return time.Duration(s.min)
+}
+
+// Max returns the maximum latency
+func (s *DDSketch) Max() time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	return time.Duration(s.max)
+}
+
+// Mean returns the mean (average) latency
+func (s *DDSketch) Mean() time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	return time.Duration(math.Round(s.mean))
+}
+
+// StdDev returns the standard deviation of latency
+func (s *DDSketch) StdDev() time.Duration {
+	if s.count < 2 {
+		return 0
+	}
+	// Rounding can leave m2 just below zero when all samples are equal
+	return time.Duration(math.Round(math.Sqrt(max(s.m2, 0) / float64(s.count))))
+}
+
+// Percentile returns the latency at the given percentile (0-100),
+// interpolating between ranks like LatencyHistogram. Each rank is within
+// the relative accuracy of its true value.
+func (s *DDSketch) Percentile(p float64) time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	if p < 0 || p > 100 {
+		return 0
+	}
+
+	index := (p / 100.0) * float64(s.count-1)
+	lower := uint64(index)
+	frac := index - float64(lower)
+
+	value := s.valueAtRank(lower)
+	if frac == 0 || lower+1 >= s.count {
+		return time.Duration(value)
+	}
+	upper := s.valueAtRank(lower + 1)
+	return time.Duration(value*(1-frac) + upper*frac)
+}
+
+// OrderStatistic returns the kth smallest sample (one-based), within the
+// relative accuracy, or 0 if k is out of range
+func (s *DDSketch) OrderStatistic(k int) time.Duration {
+	if k < 1 || uint64(k) > s.count {
+		return 0
+	}
+	return time.Duration(s.valueAtRank(uint64(k - 1)))
+}
+
+// valueAtRank estimates the value of the sample at a zero-based rank,
+// limited to the exact minimum and maximum
+func (s *DDSketch) valueAtRank(rank uint64) float64 {
+	if rank == 0 {
+		return s.min
+	}
+	if rank >= s.count-1 {
+		return s.max
+	}
+
+	seen := s.zero
+	if seen > rank {
+		return 0
+	}
+	for i, n := range s.bins {
+		seen += n
+		if seen > rank {
+			return math.Max(s.min, math.Min(s.max, s.value(s.offset+i)))
+		}
+	}
+	return s.max
+}
+
+// P50 returns the 50th percentile (median)
+func (s *DDSketch) P50() time.Duration {
+	return s.Percentile(50)
+}
+
+// P90 returns the 90th percentile
+func (s *DDSketch) P90() time.Duration {
+	return s.Percentile(90)
+}
+
+// P99 returns the 99th percentile
+func (s *DDSketch) P99() time.Duration {
+	return s.Percentile(99)
+}
+
+// P999 returns the 99.9th percentile
+func (s *DDSketch) P999() time.Duration {
+	return s.Percentile(99.9)
+}
+
+// GetStats returns all statistics at once
+func (s *DDSketch) GetStats() HistogramStats {
+	return HistogramStats{
+		Count:  s.Count(),
+		Min:    s.Min(),
+		Max:    s.Max(),
+		Mean:   s.Mean(),
+		StdDev: s.StdDev(),
+		P50:    s.P50(),
+		P90:    s.P90(),
+		P99:    s.P99(),
+		P999:   s.P999(),
+	}
+}
+
+// ddSketchJSON is the serialized form of a DDSketch, with only the
+// non-empty bins keyed by bin index. Empty sketches have no minimum or
+// maximum, which JSON numbers cannot represent as infinity.
+type ddSketchJSON struct {
+	RelativeAccuracy float64        `json:"relative_accuracy"`
+	MaxBins          int            `json:"max_bins"`
+	Bins             map[int]uint64 `json:"bins"`
+	Zero             uint64         `json:"zero"`
+	Count            uint64         `json:"count"`
+	MeanNs           float64        `json:"mean_ns"`
+	M2Ns             float64        `json:"m2_ns"`
+	MinNs            float64        `json:"min_ns"`
+	MaxNs            float64        `json:"max_ns"`
+}
+
+// MarshalJSON encodes the sketch, including its bins, as JSON
+func (s *DDSketch) MarshalJSON() ([]byte, error) {
+	enc := ddSketchJSON{
+		RelativeAccuracy: s.accuracy,
+		MaxBins:          s.maxBins,
+		Bins:             make(map[int]uint64),
+		Zero:             s.zero,
+		Count:            s.count,
+		MeanNs:           s.mean,
+		M2Ns:             s.m2,
+	}
+	for i, n := range s.bins {
+		if n > 0 {
+			enc.Bins[s.offset+i] = n
+		}
+	}
+	if s.count > 0 {
+		enc.MinNs, enc.MaxNs = s.min, s.max
+	}
+	return json.Marshal(enc)
+}
+
+// UnmarshalJSON decodes a sketch encoded by MarshalJSON
+func (s *DDSketch) UnmarshalJSON(data []byte) error {
+	var enc ddSketchJSON
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return fmt.Errorf("failed to decode sketch: %w", err)
+	}
+	if enc.RelativeAccuracy <= 0 || enc.RelativeAccuracy >= 1 {
+		return fmt.Errorf("invalid sketch relative accuracy %v", enc.RelativeAccuracy)
+	}
+
+	*s = *NewDDSketch(enc.RelativeAccuracy, enc.MaxBins)
+	for key, n := range enc.Bins {
+		s.addToBin(key, n)
+	}
+	s.zero = enc.Zero
+	s.count = enc.Count
+	s.mean = enc.MeanNs
+	s.m2 = enc.M2Ns
+	if s.count > 0 {
+		s.min, s.max = enc.MinNs, enc.MaxNs
+	}
+	return nil
+}
+
+// String returns a formatted string representation
+func (s *DDSketch) String() string {
+	return fmt.Sprintf("DDSketch(%.2f%% accuracy, %d bins): %v", s.accuracy*100, len(s.bins), s.GetStats())
+}
@@ -0,0 +1,232 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDDSketchAccuracy(t *testing.T) {
+	samples := testSamples(20000, 4)
+	exact := exactHistogram(samples)
+
+	tests := []struct {
+		accuracy float64
+		maxBins  int
+	}{
+		{DefaultSketchAccuracy, 0},
+		{0.05, 0},
+		{0.001, 1 << 14}, // Finer bins need more of them to span the samples
+	}
+
+	for _, tt := range tests {
+		accuracy := tt.accuracy
+		s := NewDDSketch(accuracy, tt.maxBins)
+		s.AddSamples(samples)
+
+		if s.Count() != exact.Count() || s.Min() != exact.Min() || s.Max() != exact.Max() {
+			t.Errorf("accuracy %g: count %d range %v to %v, want %d and %v to %v", accuracy,
+				s.Count(), s.Min(), s.Max(), exact.Count(), exact.Min(), exact.Max())
+		}
+		checkRelative(t, s, exact, accuracy)
+	}
+}
+
+func TestDDSketchFolding(t *testing.T) {
+	samples := testSamples(20000, 4)
+	exact := exactHistogram(samples)
+
+	// 200 bins at 1% span a factor of about 55, from below p90 to the
+	// maximum; folding the lowest bins leaves those percentiles intact
+	s := NewDDSketch(DefaultSketchAccuracy, 200)
+	s.AddSamples(samples)
+	if len(s.bins) > 200 {
+		t.Fatalf("%d bins, limit 200", len(s.bins))
+	}
+	for _, p := range []float64{90, 99, 99.9, 100} {
+		want := exact.Percentile(p)
+		bound := time.Duration(DefaultSketchAccuracy*float64(want)) + time.Microsecond
+		if d := s.Percentile(p) - want; d < -bound || d > bound {
+			t.Errorf("p%g = %v, exact %v, off by more than %v", p, s.Percentile(p), want, bound)
+		}
+	}
+	if s.Count() != exact.Count() || s.Min() != exact.Min() {
+		t.Errorf("count %d min %v, want %d and %v", s.Count(), s.Min(), exact.Count(), exact.Min())
+	}
+}
+
+func TestDDSketchZero(t *testing.T) {
+	s := NewDDSketch(0, 0)
+	s.AddSamples([]time.Duration{-time.Millisecond, 0, 0, 10 * time.Millisecond})
+
+	if s.Count() != 4 || s.Min() != 0 || s.Max() != 10*time.Millisecond {
+		t.Fatalf("count %d range %v to %v, want 4 and 0 to 10ms", s.Count(), s.Min(), s.Max())
+	}
+	if p := s.Percentile(50); p != 0 {
+		t.Fatalf("p50 = %v, want 0", p)
+	}
+}
+
+func TestDDSketchMoments(t *testing.T) {
+	s := NewDDSketch(0, 0)
+	for _, ms := range []time.Duration{2, 4, 4, 4, 5, 5, 7, 9} {
+		s.AddSample(ms * time.Millisecond)
+	}
+	if s.Mean() != 5*time.Millisecond || s.StdDev() != 2*time.Millisecond {
+		t.Fatalf("mean %v stddev %v, want 5ms and 2ms", s.Mean(), s.StdDev())
+	}
+
+	exact := exactHistogram(testSamples(10000, 10))
+	s = NewDDSketch(0, 0)
+	s.AddSamples(testSamples(10000, 10))
+	if d := s.StdDev() - exact.StdDev(); d < -1 || d > 1 {
+		t.Errorf("stddev %v, want %v", s.StdDev(), exact.StdDev())
+	}
+}
+
+func TestDDSketchMomentsLargeOffset(t *testing.T) {
+	// 1000 samples one nanosecond apart, 10s from zero: the sum of squares
+	// is around 1e23, far beyond what float64 holds to the nanosecond, so
+	// sumSq/n - mean^2 would cancel to noise. The standard deviation is
+	// sqrt((1000^2-1)/12), about 288.7ns.
+	const offset = 10 * time.Second
+	var low, high []time.Duration
+	for i := 0; i < 1000; i++ {
+		if i < 500 {
+			low = append(low, offset+time.Duration(i))
+		} else {
+			high = append(high, offset+time.Duration(i))
+		}
+	}
+
+	whole, merged, other := NewDDSketch(0, 0), NewDDSketch(0, 0), NewDDSketch(0, 0)
+	whole.AddSamples(low)
+	whole.AddSamples(high)
+	merged.AddSamples(low)
+	other.AddSamples(high)
+	if err := merged.Merge(other); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	for name, s := range map[string]*DDSketch{"added": whole, "merged": merged} {
+		// The mean of 499.5ns past the offset rounds up
+		if s.Mean() != offset+500*time.Nanosecond {
+			t.Errorf("%s: mean %v, want %v", name, s.Mean(), offset+500*time.Nanosecond)
+		}
+		if s.StdDev() != 289*time.Nanosecond {
+			t.Errorf("%s: stddev %v, want 289ns", name, s.StdDev())
+		}
+	}
+
+	// Identical samples have no spread, however large they are
+	constant := NewDDSketch(0, 0)
+	for i := 0; i < 1000; i++ {
+		constant.AddSample(offset + 123*time.Nanosecond)
+	}
+	if constant.StdDev() != 0 {
+		t.Errorf("constant samples: stddev %v, want 0", constant.StdDev())
+	}
+}
+
+func TestDDSketchMerge(t *testing.T) {
+	a, b := testSamples(5000, 5), testSamples(3000, 6)
+
+	s, other, whole := NewDDSketch(0, 0), NewDDSketch(0, 0), NewDDSketch(0, 0)
+	s.AddSamples(a)
+	other.AddSamples(b)
+	whole.AddSamples(a)
+	whole.AddSamples(b)
+	if err := s.Merge(other); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	for p := 0.0; p <= 100; p += 0.5 {
+		if s.Percentile(p) != whole.Percentile(p) {
+			t.Fatalf("p%g = %v, want %v", p, s.Percentile(p), whole.Percentile(p))
+		}
+	}
+	if s.Count() != whole.Count() || s.Min() != whole.Min() || s.Max() != whole.Max() {
+		t.Errorf("count %d range %v to %v, want %d and %v to %v",
+			s.Count(), s.Min(), s.Max(), whole.Count(), whole.Min(), whole.Max())
+	}
+	if d := s.Mean() - whole.Mean(); d < -1 || d > 1 {
+		t.Errorf("mean %v, want %v", s.Mean(), whole.Mean())
+	}
+
+	// Merging into an empty sketch copies the other
+	empty := NewDDSketch(0, 0)
+	if err := empty.Merge(whole); err != nil {
+		t.Fatalf("Merge into empty: %v", err)
+	}
+	if empty.GetStats() != whole.GetStats() {
+		t.Errorf("merged into empty sketch: %v, want %v", empty.GetStats(), whole.GetStats())
+	}
+}
+
+func TestDDSketchMergeMismatch(t *testing.T) {
+	s, other := NewDDSketch(0.01, 0), NewDDSketch(0.02, 0)
+	s.AddSamples(testSamples(100, 7))
+	other.AddSamples(testSamples(100, 8))
+	before := s.GetStats()
+
+	if err := s.Merge(other); !errors.Is(err, errSketchMismatch) {
+		t.Fatalf("Merge = %v, want errSketchMismatch", err)
+	}
+	if s.GetStats() != before {
+		t.Fatalf("failed merge changed %v to %v", before, s.GetStats())
+	}
+}
+
+func TestDDSketchJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []time.Duration
+	}{
+		{"empty", nil},
+		{"with zeros", []time.Duration{0, time.Microsecond, 3 * time.Millisecond}},
+		{"log-normal", testSamples(10000, 9)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewDDSketch(0.005, 0)
+			s.AddSamples(tt.samples)
+
+			data, err := json.Marshal(s)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var got DDSketch
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			if got.accuracy != s.accuracy || got.maxBins != s.maxBins {
+				t.Errorf("accuracy %g and %d bins, want %g and %d", got.accuracy, got.maxBins, s.accuracy, s.maxBins)
+			}
+			if got.GetStats() != s.GetStats() {
+				t.Errorf("stats %v, want %v", got.GetStats(), s.GetStats())
+			}
+			for p := 0.0; p <= 100; p += 0.1 {
+				if got.Percentile(p) != s.Percentile(p) {
+					t.Fatalf("p%g = %v, want %v", p, got.Percentile(p), s.Percentile(p))
+				}
+			}
+
+			// A decoded sketch keeps merging with the original's settings
+			if err := got.Merge(s); err != nil {
+				t.Fatalf("Merge after decoding: %v", err)
+			}
+		})
+	}
+}
+
+func TestDDSketchUnmarshalInvalid(t *testing.T) {
+	for _, data := range []string{`{"relative_accuracy": 0}`, `{"relative_accuracy": 1.5}`, `[]`} {
+		var s DDSketch
+		if err := json.Unmarshal([]byte(data), &s); err == nil {
+			t.Errorf("decoded %s", data)
+		}
+	}
+}
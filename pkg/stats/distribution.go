@@ -0,0 +1,26 @@
+package stats
+
+import "time"
+
+// Distribution is a summary of latency samples that answers percentile
+// queries. LatencyHistogram keeps every sample, HDRHistogram buckets them
+// with fixed memory, and DDSketch bounds the relative error and can be
+// merged across agents.
+type Distribution interface {
+	AddSample(rtt time.Duration)
+	AddSamples(rtts []time.Duration)
+	Count() int
+	Min() time.Duration
+	Max() time.Duration
+	Mean() time.Duration
+	StdDev() time.Duration
+	Percentile(p float64) time.Duration
+	OrderStatistic(k int) time.Duration
+	GetStats() HistogramStats
+}
+
+var (
+	_ Distribution = (*LatencyHistogram)(nil)
+	_ Distribution = (*HDRHistogram)(nil)
+	_ Distribution = (*DDSketch)(nil)
+)
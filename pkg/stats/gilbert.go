@@ -0,0 +1,136 @@
+package stats
+
+import "fmt"
+
+// DefaultGmin is the RFC 3611 gap threshold: a burst ends once this many
+// consecutive packets have been received
+const DefaultGmin = 16
+
+// GilbertElliott is a two-state Gilbert-Elliott loss model. Packets are
+// sent either in the gap (good) state, where losses are rare, or in the
+// burst (bad) state, where they are frequent, and the state changes
+// between packets with probabilities P and R.
+type GilbertElliott struct {
+	P               float64 // Probability of moving from gap to burst state, per packet
+	R               float64 // Probability of moving from burst to gap state, per packet
+	BurstDensity    float64 // Packets lost in the burst state, as a percentage
+	GapDensity      float64 // Packets lost in the gap state, as a percentage
+	MeanBurstLength float64 // Mean burst length, in packets
+	MeanGapLength   float64 // Mean gap length, in packets
+	Bursts          int     // Number of bursts
+	Packets         int     // Packets in the loss pattern
+	Lost            int     // Packets lost
+}
+
+// FitGilbertElliott fits a Gilbert-Elliott model to a loss pattern, given
+// as one flag per packet in sequence order with true for a loss.
+//
+// Packets are split into bursts and gaps as in RFC 3611: a burst is the
+// longest run that starts and ends with a loss and never contains gmin or
+// more consecutive received packets, and everything else is gap. A loss on
+// its own between two such runs stays in the gap. P and R are then the
+// observed transition frequencies between the two states, and the burst and
+// gap densities their loss rates. A gmin of 0 selects DefaultGmin.
+func FitGilbertElliott(lost []bool, gmin int) GilbertElliott {
+	if gmin <= 0 {
+		gmin = DefaultGmin
+	}
+
+	ge := GilbertElliott{Packets: len(lost)}
+	burst := make([]bool, len(lost))
+
+	// Group losses separated by fewer than gmin received packets; groups
+	// of two or more losses are bursts spanning first to last loss
+	first, last, count := -1, -1, 0
+	closeGroup := func() {
+		if count >= 2 {
+			for i := first; i <= last; i++ {
+				burst[i] = true
+			}
+			ge.Bursts++
+		}
+	}
+	for i, l := range lost {
+		if !l {
+			continue
+		}
+		ge.Lost++
+		if count > 0 && i-last-1 >= gmin {
+			closeGroup()
+			count = 0
+		}
+		if count == 0 {
+			first = i
+		}
+		last = i
+		count++
+	}
+	if count > 0 {
+		closeGroup()
+	}
+
+	// Loss rate and length of each state, and transitions between them
+	var burstPackets, burstLost, gapPackets, gapLost int
+	var fromGap, gapToBurst, fromBurst, burstToGap, gaps int
+	for i, b := range burst {
+		if b {
+			burstPackets++
+			if lost[i] {
+				burstLost++
+			}
+		} else {
+			gapPackets++
+			if lost[i] {
+				gapLost++
+			}
+			if i == 0 || burst[i-1] {
+				gaps++
+			}
+		}
+
+		if i+1 == len(burst) {
+			break
+		}
+		switch next := burst[i+1]; {
+		case b:
+			fromBurst++
+			if !next {
+				burstToGap++
+			}
+		default:
+			fromGap++
+			if next {
+				gapToBurst++
+			}
+		}
+	}
+
+	if fromGap > 0 {
+		ge.P = float64(gapToBurst) / float64(fromGap)
+	}
+	if fromBurst > 0 {
+		ge.R = float64(burstToGap) / float64(fromBurst)
+	}
+	if burstPackets > 0 {
+		ge.BurstDensity = float64(burstLost) / float64(burstPackets) * 100
+	}
+	if gapPackets > 0 {
+		ge.GapDensity = float64(gapLost) / float64(gapPackets) * 100
+	}
+	if ge.Bursts > 0 {
+		ge.MeanBurstLength = float64(burstPackets) / float64(ge.Bursts)
+	}
+	if gaps > 0 {
+		ge.MeanGapLength = float64(gapPackets) / float64(gaps)
+	}
+
+	return ge
+}
+
+// String returns a formatted string representation
+func (ge GilbertElliott) String() string {
+	return fmt.Sprintf(
+		"p: %.4f, r: %.4f, Burst density: %.1f%%, Gap density: %.1f%%, Mean burst length: %.1f, Bursts: %d",
+		ge.P, ge.R, ge.BurstDensity, ge.GapDensity, ge.MeanBurstLength, ge.Bursts,
+	)
+}
@@ -0,0 +1,152 @@
+package stats
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// lossPattern turns a string of '.' (received) and 'X' (lost) into loss flags
+func lossPattern(s string) []bool {
+	lost := make([]bool, len(s))
+	for i, c := range s {
+		lost[i] = c == 'X'
+	}
+	return lost
+}
+
+func TestFitGilbertElliott(t *testing.T) {
+	quiet := strings.Repeat(".", 20)
+
+	tests := []struct {
+		name    string
+		pattern string
+		gmin    int
+		want    GilbertElliott
+	}{
+		{
+			name: "empty",
+			want: GilbertElliott{},
+		},
+		{
+			name:    "no loss",
+			pattern: "..........",
+			want:    GilbertElliott{MeanGapLength: 10, Packets: 10},
+		},
+		{
+			name:    "all lost",
+			pattern: "XXXXXXXXXX",
+			want:    GilbertElliott{BurstDensity: 100, MeanBurstLength: 10, Bursts: 1, Packets: 10, Lost: 10},
+		},
+		{
+			// Each loss is followed by exactly gmin received packets, so
+			// none of them join up
+			name:    "isolated losses at gmin",
+			pattern: "..X....X....X..",
+			gmin:    4,
+			want:    GilbertElliott{GapDensity: 20, MeanGapLength: 15, Packets: 15, Lost: 3},
+		},
+		{
+			// One received packet fewer between the losses makes them a
+			// single burst from the first to the last
+			name:    "losses one below gmin",
+			pattern: "..X...X...X..",
+			gmin:    4,
+			want: GilbertElliott{
+				P:               1.0 / 3,
+				R:               1.0 / 9,
+				BurstDensity:    100.0 / 3,
+				MeanBurstLength: 9,
+				MeanGapLength:   2,
+				Bursts:          1,
+				Packets:         13,
+				Lost:            3,
+			},
+		},
+		{
+			name:    "single long burst",
+			pattern: quiet + "XX.XXX.X" + quiet,
+			want: GilbertElliott{
+				P:               1.0 / 39,
+				R:               1.0 / 8,
+				BurstDensity:    75,
+				MeanBurstLength: 8,
+				MeanGapLength:   20,
+				Bursts:          1,
+				Packets:         48,
+				Lost:            6,
+			},
+		},
+		{
+			// A lone loss, then bursts at 4-7 and 12-15
+			name:    "mixed",
+			pattern: "X...XX.X....X..X....",
+			gmin:    3,
+			want: GilbertElliott{
+				P:               2.0 / 11,
+				R:               2.0 / 8,
+				BurstDensity:    500.0 / 8,
+				GapDensity:      100.0 / 12,
+				MeanBurstLength: 4,
+				MeanGapLength:   4,
+				Bursts:          2,
+				Packets:         20,
+				Lost:            6,
+			},
+		},
+		{
+			name:    "burst at the start",
+			pattern: "XX.X" + quiet,
+			want: GilbertElliott{
+				P:               0,
+				R:               1.0 / 4,
+				BurstDensity:    75,
+				MeanBurstLength: 4,
+				MeanGapLength:   20,
+				Bursts:          1,
+				Packets:         24,
+				Lost:            3,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FitGilbertElliott(lossPattern(tt.pattern), tt.gmin)
+
+			if got.Bursts != tt.want.Bursts || got.Packets != tt.want.Packets || got.Lost != tt.want.Lost {
+				t.Errorf("bursts %d packets %d lost %d, want %d, %d and %d",
+					got.Bursts, got.Packets, got.Lost, tt.want.Bursts, tt.want.Packets, tt.want.Lost)
+			}
+			for _, f := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"P", got.P, tt.want.P},
+				{"R", got.R, tt.want.R},
+				{"BurstDensity", got.BurstDensity, tt.want.BurstDensity},
+				{"GapDensity", got.GapDensity, tt.want.GapDensity},
+				{"MeanBurstLength", got.MeanBurstLength, tt.want.MeanBurstLength},
+				{"MeanGapLength", got.MeanGapLength, tt.want.MeanGapLength},
+			} {
+				if math.Abs(f.got-f.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", f.name, f.got, f.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFitGilbertElliottDefaultGmin(t *testing.T) {
+	// Losses DefaultGmin-1 packets apart form one burst, DefaultGmin apart
+	// stay isolated
+	near := "X" + strings.Repeat(".", DefaultGmin-1) + "X"
+	far := "X" + strings.Repeat(".", DefaultGmin) + "X"
+
+	if ge := FitGilbertElliott(lossPattern(near), 0); ge.Bursts != 1 || ge.MeanBurstLength != float64(len(near)) {
+		t.Errorf("losses %d apart: %d bursts of %v, want one of %d", DefaultGmin-1, ge.Bursts, ge.MeanBurstLength, len(near))
+	}
+	if ge := FitGilbertElliott(lossPattern(far), 0); ge.Bursts != 0 {
+		t.Errorf("losses %d apart: %d bursts, want none", DefaultGmin, ge.Bursts)
+	}
+}
@@ -0,0 +1,340 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// HDR histogram defaults
+const (
+	DefaultHDRHighest           = time.Hour // Largest value tracked without clamping
+	DefaultHDRSignificantDigits = 3         // Relative precision of 0.1%
+)
+
+// HDRHistogram is a log-linear bucketed latency histogram in the style of
+// HdrHistogram. Values are recorded in nanoseconds into buckets that double
+// in width, each split into enough linear sub-buckets to keep the given
+// number of significant decimal digits, so memory is fixed by the value
+// range and precision rather than the number of samples, and inserts are
+// O(1). Min, max, mean and standard deviation are tracked exactly;
+// percentiles are exact to the bucket resolution.
+//
+// Histograms with the same layout merge by adding counts, which makes them
+// suitable for multi-day runs and for combining runs.
+type HDRHistogram struct {
+	highest           int64 // Largest trackable value in nanoseconds
+	significantDigits int   // Decimal digits of precision
+
+	subBucketHalfCountMagnitude uint  // log2 of subBucketHalfCount
+	subBucketHalfCount          int   // Sub-buckets in each bucket above the first
+	subBucketMask               int64 // Values below this share the first bucket
+	bucketCount                 int   // Number of power-of-two buckets
+
+	counts []int64 // Samples per sub-bucket
+	total  int64   // Samples recorded
+	min    int64   // Smallest sample in nanoseconds
+	max    int64   // Largest sample in nanoseconds
+	mean   float64 // Running mean in nanoseconds (Welford)
+	m2     float64 // Running sum of squared deviations (Welford)
+}
+
+// NewHDRHistogram creates a histogram tracking values up to highest with
+// the given number of significant digits (1 to 5). Larger values are
+// recorded as highest and negative values as zero. Zero arguments select
+// DefaultHDRHighest and DefaultHDRSignificantDigits.
+func NewHDRHistogram(highest time.Duration, significantDigits int) *HDRHistogram {
+	if highest <= 0 {
+		highest = DefaultHDRHighest
+	}
+	if significantDigits < 1 || significantDigits > 5 {
+		significantDigits = DefaultHDRSignificantDigits
+	}
+
+	// Enough sub-buckets to tell apart values 10^-digits apart at the top
+	// of each bucket, rounded up to a power of two
+	largestSingleUnit := 2 * int64(math.Pow10(significantDigits))
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(float64(largestSingleUnit))))
+	subBucketCount := int64(1) << subBucketCountMagnitude
+
+	h := &HDRHistogram{
+		highest:                     int64(highest),
+		significantDigits:           significantDigits,
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		subBucketHalfCount:          int(subBucketCount / 2),
+		subBucketMask:               subBucketCount - 1,
+		min:                         math.MaxInt64,
+	}
+
+	// Buckets double until the largest trackable value fits
+	h.bucketCount = 1
+	for smallestUntrackable := subBucketCount; smallestUntrackable <= h.highest; smallestUntrackable <<= 1 {
+		h.bucketCount++
+		if smallestUntrackable > math.MaxInt64/2 {
+			break
+		}
+	}
+	h.counts = make([]int64, (h.bucketCount+1)*h.subBucketHalfCount)
+
+	return h
+}
+
+// countsIndex returns the sub-bucket a value in nanoseconds falls into
+func (h *HDRHistogram) countsIndex(v int64) int {
+	bucket := 64 - bits.LeadingZeros64(uint64(v|h.subBucketMask)) - int(h.subBucketHalfCountMagnitude+1)
+	subBucket := int(v >> uint(bucket))
+	return (bucket+1)<<h.subBucketHalfCountMagnitude + subBucket - h.subBucketHalfCount
+}
+
+// valueRange returns the lowest value of a sub-bucket and its width
+func (h *HDRHistogram) valueRange(index int) (lowest, width int64) {
+	bucket := index>>h.subBucketHalfCountMagnitude - 1
+	subBucket := index&(h.subBucketHalfCount-1) + h.subBucketHalfCount
+	if bucket < 0 {
+		subBucket -= h.subBucketHalfCount
+		bucket = 0
+	}
+	return int64(subBucket) << uint(bucket), int64(1) << uint(bucket)
+}
+
+// AddSample adds an RTT sample to the histogram
+func (h *HDRHistogram) AddSample(rtt time.Duration) {
+	h.record(int64(rtt))
+}
+
+// AddSamples adds multiple RTT samples
+func (h *HDRHistogram) AddSamples(rtts []time.Duration) {
+	for _, rtt := range rtts {
+		h.AddSample(rtt)
+	}
+}
+
+// record adds a sample in nanoseconds
+func (h *HDRHistogram) record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	if v > h.highest {
+		v = h.highest
+	}
+
+	h.counts[h.countsIndex(v)]++
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.addMoments(1, float64(v), 0)
+}
+
+// addMoments folds n samples with the given mean and sum of squared
+// deviations into the running mean and variance (Chan et al.)
+func (h *HDRHistogram) addMoments(n int64, mean, m2 float64) {
+	total := h.total + n
+	delta := mean - h.mean
+	h.mean += delta * float64(n) / float64(total)
+	h.m2 += m2 + delta*delta*float64(h.total)*float64(n)/float64(total)
+	h.total = total
+}
+
+// Merge adds all samples of other to h. Histograms with the same layout
+// are merged exactly; otherwise each of other's sub-buckets is recorded at
+// its midpoint, within the precision of the coarser histogram.
+func (h *HDRHistogram) Merge(other *HDRHistogram) {
+	if other.total == 0 {
+		return
+	}
+
+	if h.highest == other.highest && h.significantDigits == other.significantDigits {
+		for i, n := range other.counts {
+			h.counts[i] += n
+		}
+		if other.min < h.min {
+			h.min = other.min
+		}
+		if other.max > h.max {
+			h.max = other.max
+		}
+		h.addMoments(other.total, other.mean, other.m2)
+		return
+	}
+
+	// Only the counts are re-bucketed; the exact extremes and moments are
+	// carried over as they are
+	for i, n := range other.counts {
+		if n == 0 {
+			continue
+		}
+		lowest, width := other.valueRange(i)
+		v := lowest + width/2
+		if v > other.max {
+			v = other.max
+		}
+		if v < other.min {
+			v = other.min
+		}
+		if v > h.highest {
+			v = h.highest
+		}
+		h.counts[h.countsIndex(v)] += n
+	}
+	if min := clampInt64(other.min, 0, h.highest); min < h.min {
+		h.min = min
+	}
+	if max := clampInt64(other.max, 0, h.highest); max > h.max {
+		h.max = max
+	}
+	h.addMoments(other.total, other.mean, other.m2)
+}
+
+// clampInt64 limits v to [lo, hi]
+func clampInt64(v, lo, hi int64) int64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// Reset removes all samples
+func (h *HDRHistogram) Reset() {
+	clear(h.counts)
+	h.total = 0
+	h.min = math.MaxInt64
+	h.max = 0
+	h.mean = 0
+	h.m2 = 0
+}
+
+// Count returns the number of samples
+func (h *HDRHistogram) Count() int {
+	return int(h.total)
+}
+
+// Min returns the minimum latency
+func (h *HDRHistogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min)
+}
+
+// Max returns the maximum latency
+func (h *HDRHistogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+// Mean returns the mean (average) latency
+func (h *HDRHistogram) Mean() time.Duration {
+	return time.Duration(math.Round(h.mean))
+}
+
+// StdDev returns the standard deviation of latency
+func (h *HDRHistogram) StdDev() time.Duration {
+	if h.total < 2 {
+		return 0
+	}
+	return time.Duration(math.Round(math.Sqrt(h.m2 / float64(h.total))))
+}
+
+// Percentile returns the latency at the given percentile (0-100),
+// interpolating between ranks like LatencyHistogram. Each rank takes the
+// highest value of its sub-bucket, limited to the exact minimum and maximum.
+func (h *HDRHistogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if p < 0 || p > 100 {
+		return 0
+	}
+
+	index := (p / 100.0) * float64(h.total-1)
+	lower := int64(index)
+	frac := index - float64(lower)
+
+	value := h.valueAtRank(lower)
+	if frac == 0 || lower+1 >= h.total {
+		return time.Duration(value)
+	}
+	upper := h.valueAtRank(lower + 1)
+	return time.Duration(float64(value)*(1-frac) + float64(upper)*frac)
+}
+
+// OrderStatistic returns the kth smallest sample (one-based), to the
+// bucket resolution, or 0 if k is out of range
+func (h *HDRHistogram) OrderStatistic(k int) time.Duration {
+	if k < 1 || int64(k) > h.total {
+		return 0
+	}
+	return time.Duration(h.valueAtRank(int64(k - 1)))
+}
+
+// valueAtRank returns the value of the sample at a zero-based rank
+func (h *HDRHistogram) valueAtRank(rank int64) int64 {
+	if rank == 0 {
+		return h.min
+	}
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen > rank {
+			lowest, width := h.valueRange(i)
+			return clampInt64(lowest+width-1, h.min, h.max)
+		}
+	}
+	return h.max
+}
+
+// P50 returns the 50th percentile (median)
+func (h *HDRHistogram) P50() time.Duration {
+	return h.Percentile(50)
+}
+
+// P90 returns the 90th percentile
+func (h *HDRHistogram) P90() time.Duration {
+	return h.Percentile(90)
+}
+
+// P99 returns the 99th percentile
+func (h *HDRHistogram) P99() time.Duration {
+	return h.Percentile(99)
+}
+
+// P999 returns the 99.9th percentile
+func (h *HDRHistogram) P999() time.Duration {
+	return h.Percentile(99.9)
+}
+
+// Percentiles returns multiple percentiles at once
+func (h *HDRHistogram) Percentiles(percentiles []float64) map[float64]time.Duration {
+	result := make(map[float64]time.Duration, len(percentiles))
+	for _, p := range percentiles {
+		result[p] = h.Percentile(p)
+	}
+	return result
+}
+
+// GetStats returns all statistics at once
+func (h *HDRHistogram) GetStats() HistogramStats {
+	return HistogramStats{
+		Count:  h.Count(),
+		Min:    h.Min(),
+		Max:    h.Max(),
+		Mean:   h.Mean(),
+		StdDev: h.StdDev(),
+		P50:    h.P50(),
+		P90:    h.P90(),
+		P99:    h.P99(),
+		P999:   h.P999(),
+	}
+}
+
+// String returns a formatted string representation
+func (h *HDRHistogram) String() string {
+	return fmt.Sprintf("HDRHistogram(%d digits, up to %v, %d buckets): %v",
+		h.significantDigits, time.Duration(h.highest), len(h.counts), h.GetStats())
+}
@@ -0,0 +1,201 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// testPercentiles are checked against exact values in the distribution tests
+var testPercentiles = []float64{0, 1, 10, 25, 50, 75, 90, 95, 99, 99.9, 100}
+
+// testSamples returns n log-normally distributed RTTs around 20ms, in whole
+// microseconds so LatencyHistogram holds them exactly
+func testSamples(n int, seed int64) []time.Duration {
+	rng := rand.New(rand.NewSource(seed))
+	samples := make([]time.Duration, n)
+	for i := range samples {
+		v := 20e3 * math.Exp(rng.NormFloat64())
+		samples[i] = time.Duration(math.Ceil(v)) * time.Microsecond
+	}
+	return samples
+}
+
+// exactHistogram returns a LatencyHistogram of samples as the reference
+func exactHistogram(samples []time.Duration) *LatencyHistogram {
+	h := NewLatencyHistogram(len(samples))
+	h.AddSamples(samples)
+	return h
+}
+
+// checkRelative fails if any test percentile of got is further than the
+// relative error from the exact value; LatencyHistogram truncates
+// interpolated values to the microsecond, so that much more is allowed
+func checkRelative(t *testing.T, got Distribution, exact *LatencyHistogram, relative float64) {
+	t.Helper()
+
+	for _, p := range testPercentiles {
+		want := exact.Percentile(p)
+		bound := time.Duration(relative*float64(want)) + time.Microsecond
+		if d := got.Percentile(p) - want; d < -bound || d > bound {
+			t.Errorf("p%g = %v, exact %v, off by more than %v", p, got.Percentile(p), want, bound)
+		}
+	}
+}
+
+func TestHDRHistogramPrecision(t *testing.T) {
+	samples := testSamples(20000, 1)
+	exact := exactHistogram(samples)
+
+	for digits := 1; digits <= 4; digits++ {
+		t.Run(fmt.Sprintf("%d digits", digits), func(t *testing.T) {
+			h := NewHDRHistogram(0, digits)
+			h.AddSamples(samples)
+
+			if h.Count() != exact.Count() || h.Min() != exact.Min() || h.Max() != exact.Max() {
+				t.Errorf("count %d range %v to %v, want %d and %v to %v",
+					h.Count(), h.Min(), h.Max(), exact.Count(), exact.Min(), exact.Max())
+			}
+			checkRelative(t, h, exact, math.Pow10(-digits))
+		})
+	}
+}
+
+func TestHDRHistogramMoments(t *testing.T) {
+	h := NewHDRHistogram(0, 0)
+	for _, ms := range []time.Duration{2, 4, 4, 4, 5, 5, 7, 9} {
+		h.AddSample(ms * time.Millisecond)
+	}
+	if h.Mean() != 5*time.Millisecond || h.StdDev() != 2*time.Millisecond {
+		t.Fatalf("mean %v stddev %v, want 5ms and 2ms", h.Mean(), h.StdDev())
+	}
+}
+
+func TestHDRHistogramMerge(t *testing.T) {
+	a, b := testSamples(5000, 2), testSamples(3000, 3)
+	exact := exactHistogram(append(append([]time.Duration{}, a...), b...))
+
+	t.Run("same layout", func(t *testing.T) {
+		h, other, whole := NewHDRHistogram(0, 3), NewHDRHistogram(0, 3), NewHDRHistogram(0, 3)
+		h.AddSamples(a)
+		other.AddSamples(b)
+		whole.AddSamples(a)
+		whole.AddSamples(b)
+		h.Merge(other)
+
+		// Counts add exactly, so the merge matches one histogram of both
+		for p := 0.0; p <= 100; p += 0.5 {
+			if h.Percentile(p) != whole.Percentile(p) {
+				t.Fatalf("p%g = %v, want %v", p, h.Percentile(p), whole.Percentile(p))
+			}
+		}
+		if h.Count() != whole.Count() || h.Min() != whole.Min() || h.Max() != whole.Max() {
+			t.Errorf("count %d range %v to %v, want %d and %v to %v",
+				h.Count(), h.Min(), h.Max(), whole.Count(), whole.Min(), whole.Max())
+		}
+		if d := h.Mean() - whole.Mean(); d < -1 || d > 1 {
+			t.Errorf("mean %v, want %v", h.Mean(), whole.Mean())
+		}
+		if d := h.StdDev() - whole.StdDev(); d < -1 || d > 1 {
+			t.Errorf("stddev %v, want %v", h.StdDev(), whole.StdDev())
+		}
+	})
+
+	t.Run("different layout", func(t *testing.T) {
+		h, other := NewHDRHistogram(0, 3), NewHDRHistogram(10*time.Hour, 2)
+		h.AddSamples(a)
+		other.AddSamples(b)
+		h.Merge(other)
+
+		// Re-bucketed samples keep the precision of the coarser histogram
+		if h.Count() != exact.Count() || h.Min() != exact.Min() || h.Max() != exact.Max() {
+			t.Errorf("count %d range %v to %v, want %d and %v to %v",
+				h.Count(), h.Min(), h.Max(), exact.Count(), exact.Min(), exact.Max())
+		}
+		checkRelative(t, h, exact, 1e-2)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		h := NewHDRHistogram(0, 3)
+		h.AddSamples(a)
+		before := h.GetStats()
+		h.Merge(NewHDRHistogram(0, 3))
+		if h.GetStats() != before {
+			t.Fatalf("merging an empty histogram changed %v to %v", before, h.GetStats())
+		}
+	})
+}
+
+func TestHDRHistogramClamping(t *testing.T) {
+	h := NewHDRHistogram(time.Second, 3)
+	h.AddSample(-time.Millisecond)
+	h.AddSample(10 * time.Millisecond)
+	h.AddSample(5 * time.Second)
+	h.AddSample(time.Hour)
+
+	if h.Count() != 4 {
+		t.Fatalf("Count() = %d, want 4", h.Count())
+	}
+	if h.Min() != 0 || h.Max() != time.Second {
+		t.Fatalf("range %v to %v, want 0 to 1s", h.Min(), h.Max())
+	}
+	if p := h.Percentile(100); p != time.Second {
+		t.Fatalf("p100 = %v, want 1s", p)
+	}
+	if p := h.Percentile(75); p != time.Second {
+		t.Fatalf("p75 = %v, want 1s", p)
+	}
+	if p := h.Percentile(0); p != 0 {
+		t.Fatalf("p0 = %v, want 0", p)
+	}
+}
+
+func TestHDRHistogramEmpty(t *testing.T) {
+	h := NewHDRHistogram(0, 0)
+	if s := h.GetStats(); s != (HistogramStats{}) {
+		t.Fatalf("empty histogram stats %+v", s)
+	}
+
+	h.AddSample(time.Millisecond)
+	h.Reset()
+	if s := h.GetStats(); s != (HistogramStats{}) {
+		t.Fatalf("stats after Reset %+v", s)
+	}
+}
+
+func BenchmarkHDRHistogramAddSample(b *testing.B) {
+	samples := testSamples(4096, 1)
+	h := NewHDRHistogram(0, 3)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.AddSample(samples[i%len(samples)])
+	}
+}
+
+func BenchmarkLatencyHistogramAddSample(b *testing.B) {
+	samples := testSamples(4096, 1)
+	h := NewLatencyHistogram(b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.AddSample(samples[i%len(samples)])
+	}
+}
+
+func BenchmarkHDRHistogramPercentile(b *testing.B) {
+	h := NewHDRHistogram(0, 3)
+	h.AddSamples(testSamples(100000, 1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Percentile(testPercentiles[i%len(testPercentiles)])
+	}
+}
+
+func BenchmarkLatencyHistogramPercentile(b *testing.B) {
+	h := exactHistogram(testSamples(100000, 1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Percentile(testPercentiles[i%len(testPercentiles)])
+	}
+}
@@ -2,24 +2,23 @@ package stats
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"time"
 )
 
 // LatencyHistogram represents latency measurements with percentile computation
 type LatencyHistogram struct {
-	samples    []int64 // RTT samples in microseconds
-	sorted     []int64 // Sorted samples (computed on demand)
-	isDirty    bool    // Whether sorted needs recomputation
-	bucketSize int64   // Bucket size in microseconds
+	samples []int64 // RTT samples in microseconds
+	sorted  []int64 // Sorted samples (computed on demand)
+	isDirty bool    // Whether sorted needs recomputation
 }
 
 // NewLatencyHistogram creates a new latency histogram with pre-allocated capacity
 func NewLatencyHistogram(capacity int) *LatencyHistogram {
 	return &LatencyHistogram{
-		samples:    make([]int64, 0, capacity),
-		bucketSize: 1000, // Default 1ms buckets
-		isDirty:    false,
+		samples: make([]int64, 0, capacity),
+		isDirty: false,
 	}
 }
 
@@ -93,17 +92,16 @@ func (h *LatencyHistogram) StdDev() time.Duration {
 		return 0
 	}
 
-	mean := h.Mean().Microseconds()
-	var sumSquares int64
+	mean := float64(h.Mean().Microseconds())
+	var sumSquares float64
 
 	for _, sample := range h.samples {
-		diff := sample - mean
+		diff := float64(sample) - mean
 		sumSquares += diff * diff
 	}
 
-	variance := sumSquares / int64(len(h.samples))
-	stddev := int64(sqrt(float64(variance)))
-	return time.Duration(stddev) * time.Microsecond
+	variance := sumSquares / float64(len(h.samples))
+	return time.Duration(math.Sqrt(variance) * float64(time.Microsecond))
 }
 
 // Percentile returns the latency at the given percentile (0-100)
@@ -131,6 +129,17 @@ func (h *LatencyHistogram) Percentile(p float64) time.Duration {
 	return time.Duration(int64(interpolated)) * time.Microsecond
 }
 
+// OrderStatistic returns the kth smallest sample (one-based), or 0 if k is
+// out of range
+func (h *LatencyHistogram) OrderStatistic(k int) time.Duration {
+	if k < 1 || k > len(h.samples) {
+		return 0
+	}
+
+	h.ensureSorted()
+	return time.Duration(h.sorted[k-1]) * time.Microsecond
+}
+
 // P50 returns the 50th percentile (median)
 func (h *LatencyHistogram) P50() time.Duration {
 	return h.Percentile(50)
@@ -203,15 +212,3 @@ func (s HistogramStats) String() string {
 		s.P999.Seconds()*1000,
 	)
 }
-
-// sqrt is a simple integer square root
-func sqrt(x float64) float64 {
-	if x < 0 {
-		return 0
-	}
-	z := x
-	for i := 0; i < 10; i++ {
-		z = (z + x/z) / 2
-	}
-	return z
-}
@@ -0,0 +1,82 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+)
+
+// DelayVariationCalculator computes packet delay variation as distributions,
+// in the two forms compared by RFC 5481:
+//
+//   - IPDV (RFC 3393): D(i) - D(i-1) between packets with consecutive
+//     sequence numbers, signed, so a rising delay gives positive values
+//   - PDV (RFC 5481 section 4.2): D(i) - min D over all packets, never
+//     negative, which shows how much buffering the path needs
+//
+// Pairs where either packet was lost have no IPDV, so a loss breaks the
+// chain rather than pairing packets further apart.
+type DelayVariationCalculator struct {
+	delays  []time.Duration // Delay of every packet
+	ipdv    []time.Duration // Delay differences of consecutive pairs
+	lastSeq int             // Sequence number of the previous packet
+	last    time.Duration   // Delay of the previous packet
+	hasLast bool            // Whether a previous packet was added
+}
+
+// NewDelayVariationCalculator creates a new delay variation calculator
+func NewDelayVariationCalculator() *DelayVariationCalculator {
+	return &DelayVariationCalculator{}
+}
+
+// AddSample adds the delay of the packet with the given sequence number.
+// Packets are expected in sequence order.
+func (c *DelayVariationCalculator) AddSample(seq int, delay time.Duration) {
+	if c.hasLast && seq == c.lastSeq+1 {
+		c.ipdv = append(c.ipdv, delay-c.last)
+	}
+	c.delays = append(c.delays, delay)
+	c.lastSeq, c.last, c.hasLast = seq, delay, true
+}
+
+// DelayVariationStats holds IPDV and PDV distributions
+type DelayVariationStats struct {
+	IPDV HistogramStats // Delay differences of consecutive packets
+	PDV  HistogramStats // Delays above the minimum
+}
+
+// Stats computes both distributions
+func (c *DelayVariationCalculator) Stats() DelayVariationStats {
+	ipdv := NewLatencyHistogram(len(c.ipdv))
+	ipdv.AddSamples(c.ipdv)
+
+	pdv := NewLatencyHistogram(len(c.delays))
+	if len(c.delays) > 0 {
+		min := c.delays[0]
+		for _, d := range c.delays[1:] {
+			if d < min {
+				min = d
+			}
+		}
+		for _, d := range c.delays {
+			pdv.AddSample(d - min)
+		}
+	}
+
+	return DelayVariationStats{
+		IPDV: ipdv.GetStats(),
+		PDV:  pdv.GetStats(),
+	}
+}
+
+// String returns a formatted string representation
+func (s DelayVariationStats) String() string {
+	return fmt.Sprintf(
+		"IPDV p50: %.3fms, IPDV p99: %.3fms, IPDV range: %.3fms to %.3fms, PDV p50: %.3fms, PDV p99: %.3fms",
+		s.IPDV.P50.Seconds()*1000,
+		s.IPDV.P99.Seconds()*1000,
+		s.IPDV.Min.Seconds()*1000,
+		s.IPDV.Max.Seconds()*1000,
+		s.PDV.P50.Seconds()*1000,
+		s.PDV.P99.Seconds()*1000,
+	)
+}
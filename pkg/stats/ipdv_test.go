@@ -0,0 +1,112 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+// near reports whether got is within a microsecond of want; LatencyHistogram
+// keeps whole microseconds, and interpolated percentiles can round down
+func near(got, want time.Duration) bool {
+	d := got - want
+	return d >= -time.Microsecond && d <= time.Microsecond
+}
+
+func TestDelayVariation(t *testing.T) {
+	ms := time.Millisecond
+
+	// One-way delays in sequence order; packet 7 was lost, so there is no
+	// IPDV between packets 6 and 8
+	c := NewDelayVariationCalculator()
+	for _, s := range []struct {
+		seq   int
+		delay time.Duration
+	}{
+		{1, 50 * ms}, {2, 52 * ms}, {3, 51 * ms}, {4, 51 * ms}, {5, 55 * ms}, {6, 50 * ms},
+		{8, 60 * ms}, {9, 53 * ms}, {10, 53 * ms}, {11, 54 * ms}, {12, 70 * ms}, {13, 52 * ms}, {14, 52 * ms},
+	} {
+		c.AddSample(s.seq, s.delay)
+	}
+	stats := c.Stats()
+
+	// IPDV: +2 -1 0 +4 -5, then -7 0 +1 +16 -18 0, sorted
+	// -18 -7 -5 -1 0 0 0 1 2 4 16
+	// PDV: delay above the 50ms minimum, sorted
+	// 0 0 1 1 2 2 2 3 3 4 5 10 20
+	tests := []struct {
+		name      string
+		got, want HistogramStats
+	}{
+		{"IPDV", stats.IPDV, HistogramStats{
+			Count: 11,
+			Min:   -18 * ms,
+			Max:   16 * ms,
+			P50:   0,
+			P90:   4 * ms,
+			P99:   14800 * time.Microsecond, // 4 + 0.9 * (16 - 4)
+			P999:  15880 * time.Microsecond, // 4 + 0.99 * (16 - 4)
+		}},
+		{"PDV", stats.PDV, HistogramStats{
+			Count: 13,
+			Min:   0,
+			Max:   20 * ms,
+			P50:   2 * ms,
+			P90:   9 * ms,                   // 5 + 0.8 * (10 - 5)
+			P99:   18800 * time.Microsecond, // 10 + 0.88 * (20 - 10)
+			P999:  19880 * time.Microsecond, // 10 + 0.988 * (20 - 10)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.Count != tt.want.Count || tt.got.Min != tt.want.Min || tt.got.Max != tt.want.Max {
+				t.Errorf("count %d range %v to %v, want %d and %v to %v",
+					tt.got.Count, tt.got.Min, tt.got.Max, tt.want.Count, tt.want.Min, tt.want.Max)
+			}
+			if tt.got.P50 != tt.want.P50 {
+				t.Errorf("p50 = %v, want %v", tt.got.P50, tt.want.P50)
+			}
+			for _, p := range []struct {
+				name      string
+				got, want time.Duration
+			}{
+				{"p90", tt.got.P90, tt.want.P90},
+				{"p99", tt.got.P99, tt.want.P99},
+				{"p99.9", tt.got.P999, tt.want.P999},
+			} {
+				if !near(p.got, p.want) {
+					t.Errorf("%s = %v, want %v", p.name, p.got, p.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDelayVariationConstantDelay(t *testing.T) {
+	c := NewDelayVariationCalculator()
+	for seq := 1; seq <= 5; seq++ {
+		c.AddSample(seq, 30*time.Millisecond)
+	}
+	stats := c.Stats()
+
+	if stats.IPDV.Count != 4 || stats.IPDV.Min != 0 || stats.IPDV.Max != 0 {
+		t.Errorf("IPDV %+v, want four zero differences", stats.IPDV)
+	}
+	if stats.PDV.Count != 5 || stats.PDV.Max != 0 {
+		t.Errorf("PDV %+v, want five zero delays", stats.PDV)
+	}
+}
+
+func TestDelayVariationEmpty(t *testing.T) {
+	stats := NewDelayVariationCalculator().Stats()
+	if stats.IPDV.Count != 0 || stats.PDV.Count != 0 {
+		t.Fatalf("stats of no packets: %+v", stats)
+	}
+
+	// A single packet has a PDV of zero but no IPDV
+	c := NewDelayVariationCalculator()
+	c.AddSample(1, 10*time.Millisecond)
+	if stats := c.Stats(); stats.IPDV.Count != 0 || stats.PDV.Count != 1 || stats.PDV.Max != 0 {
+		t.Fatalf("stats of one packet: %+v", stats)
+	}
+}
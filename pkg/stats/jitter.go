@@ -6,13 +6,12 @@ import (
 
 // JitterCalculator computes RFC 3550 interarrival jitter
 // RFC 3550 defines jitter as the mean deviation (smoothed absolute value)
-// of the difference between consecutive RTP timestamps
+// of the difference between consecutive transit times
 type JitterCalculator struct {
-	lastTimestamp int64  // Last sequence number or timestamp
-	interarrival  int64  // Last interarrival time
-	jitter        int64  // Current jitter estimate
-	count         int    // Number of measurements
-	initialized   bool   // Whether first measurement has been taken
+	lastTransit time.Duration // Last transit time
+	jitter      float64       // Current jitter estimate in nanoseconds
+	count       int           // Number of measurements
+	initialized bool          // Whether first measurement has been taken
 }
 
 // NewJitterCalculator creates a new jitter calculator
@@ -23,44 +22,35 @@ func NewJitterCalculator() *JitterCalculator {
 }
 
 // AddSample adds an RTT sample and updates jitter estimate
-// Implements RFC 3550 algorithm: J = J + (|D(i-1,i)| - J) / 16
-// where D is the interarrival delay
+// Implements RFC 3550 section 6.4.1: J = J + (|D(i-1,i)| - J) / 16
+// where D is the difference between consecutive transit times. J moves
+// towards |D| by a sixteenth of the distance, so it falls again when
+// the delay steadies.
 func (jc *JitterCalculator) AddSample(rtt time.Duration) {
-	rttMicros := rtt.Microseconds()
-
 	if !jc.initialized {
-		jc.lastTimestamp = rttMicros
+		jc.lastTransit = rtt
 		jc.initialized = true
 		return
 	}
 
-	// Calculate interarrival delay
-	arrival := rttMicros
-	d := arrival - jc.lastTimestamp
+	d := rtt - jc.lastTransit
 	if d < 0 {
 		d = -d
 	}
+	jc.jitter += (float64(d) - jc.jitter) / 16
 
-	// Update jitter estimate using exponential smoothing
-	// J = J + (|D| - J) / 16
-	diff := d - jc.jitter
-	if diff < 0 {
-		diff = -diff
-	}
-	jc.jitter = jc.jitter + diff/16
-
-	jc.lastTimestamp = arrival
+	jc.lastTransit = rtt
 	jc.count++
 }
 
 // Jitter returns the current jitter estimate in microseconds
 func (jc *JitterCalculator) Jitter() int64 {
-	return jc.jitter
+	return jc.JitterDuration().Microseconds()
 }
 
 // JitterDuration returns the current jitter estimate as time.Duration
 func (jc *JitterCalculator) JitterDuration() time.Duration {
-	return time.Duration(jc.jitter) * time.Microsecond
+	return time.Duration(jc.jitter + 0.5)
 }
 
 // Count returns the number of samples processed
@@ -70,8 +60,7 @@ func (jc *JitterCalculator) Count() int {
 
 // Reset resets the jitter calculator
 func (jc *JitterCalculator) Reset() {
-	jc.lastTimestamp = 0
-	jc.interarrival = 0
+	jc.lastTransit = 0
 	jc.jitter = 0
 	jc.count = 0
 	jc.initialized = false
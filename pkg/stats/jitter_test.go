@@ -0,0 +1,89 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestJitterCalculator(t *testing.T) {
+	ms := time.Millisecond
+	jc := NewJitterCalculator()
+
+	// Transit times alternating by 2ms: each step moves J a sixteenth of
+	// the way towards |D| = 2ms
+	want := 0.0
+	for i, transit := range []time.Duration{10 * ms, 12 * ms, 10 * ms, 12 * ms, 10 * ms} {
+		jc.AddSample(transit)
+		if i > 0 {
+			want += (float64(2*ms) - want) / 16
+		}
+		if got := jc.JitterDuration(); math.Abs(float64(got)-want) > 1 {
+			t.Fatalf("after sample %d: J = %v, want %v", i+1, got, time.Duration(want))
+		}
+	}
+	// 2ms * (1 - (15/16)^4)
+	if got, want := jc.JitterDuration(), 455048*time.Nanosecond; got != want {
+		t.Fatalf("J = %v after alternating transit times, want %v", got, want)
+	}
+	peak := jc.JitterDuration()
+
+	// Steady transit times give D = 0, so J decays by 15/16 per packet
+	for i := 0; i < 16; i++ {
+		jc.AddSample(10 * ms)
+	}
+	want *= math.Pow(15.0/16, 16)
+	if got := jc.JitterDuration(); got >= peak/2 || math.Abs(float64(got)-want) > 1 {
+		t.Fatalf("J = %v after 16 steady packets, want %v (below %v)", got, time.Duration(want), peak/2)
+	}
+	for i := 0; i < 200; i++ {
+		jc.AddSample(10 * ms)
+	}
+	if got := jc.JitterDuration(); got > time.Microsecond {
+		t.Fatalf("J = %v after 216 steady packets, want under 1µs", got)
+	}
+	if jc.Count() != 220 {
+		t.Fatalf("Count() = %d, want 220", jc.Count())
+	}
+
+	jc.Reset()
+	jc.AddSample(50 * ms)
+	if jc.JitterDuration() != 0 || jc.Count() != 0 {
+		t.Fatalf("after Reset and one sample: J = %v, count %d", jc.JitterDuration(), jc.Count())
+	}
+}
+
+func TestJitterCalculatorConstantOffset(t *testing.T) {
+	// A constant transit time, however large, is no jitter
+	jc := NewJitterCalculator()
+	for i := 0; i < 10; i++ {
+		jc.AddSample(80 * time.Millisecond)
+	}
+	if got := jc.JitterDuration(); got != 0 {
+		t.Fatalf("J = %v for constant transit time, want 0", got)
+	}
+}
+
+func TestCalculateJitterStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		rtts      []time.Duration
+		count     int
+		magnitude string
+	}{
+		{"no samples", nil, 0, "Low"},
+		{"steady", []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}, 2, "Low"},
+		{"moderate", []time.Duration{0, 32 * time.Millisecond}, 1, "Moderate"},
+		{"high", []time.Duration{0, 320 * time.Millisecond}, 1, "High"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := CalculateJitterStats(tt.rtts)
+			if s.Count != tt.count || s.Magnitude != tt.magnitude {
+				t.Fatalf("count %d magnitude %s (J = %v), want %d and %s",
+					s.Count, s.Magnitude, s.Estimate, tt.count, tt.magnitude)
+			}
+		})
+	}
+}
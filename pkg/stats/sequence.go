@@ -0,0 +1,231 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SequenceAnalyzer accounts for loss, duplication and reordering from the
+// sequence numbers of sent probes and the order in which replies arrived.
+// Reordering follows RFC 4737 and loss patterns follow RFC 3357.
+type SequenceAnalyzer struct {
+	sent     []int        // Sequence numbers sent
+	arrivals []int        // First arrival of each sequence number, in arrival order
+	seen     map[int]bool // Sequence numbers that arrived at least once
+	dups     int          // Arrivals of already seen sequence numbers
+}
+
+// NewSequenceAnalyzer creates a new sequence analyzer
+func NewSequenceAnalyzer() *SequenceAnalyzer {
+	return &SequenceAnalyzer{
+		seen: make(map[int]bool),
+	}
+}
+
+// AddSent records that a probe with the given sequence number was sent
+func (a *SequenceAnalyzer) AddSent(seq int) {
+	a.sent = append(a.sent, seq)
+}
+
+// AddArrival records the arrival of a reply, in arrival order. Repeated
+// arrivals count as duplicates and are otherwise ignored.
+func (a *SequenceAnalyzer) AddArrival(seq int) {
+	if a.seen[seq] {
+		a.dups++
+		return
+	}
+	a.seen[seq] = true
+	a.arrivals = append(a.arrivals, seq)
+}
+
+// SequenceStats holds loss, duplication and reordering metrics
+type SequenceStats struct {
+	Sent       int     // Probes sent
+	Received   int     // Distinct probes that arrived
+	Lost       int     // Probes that never arrived
+	LossRate   float64 // Lost probes as a percentage of sent
+	Duplicates int     // Extra arrivals of already received probes
+
+	// RFC 4737 reordering, over first arrivals only
+	Reordered         int     // Probes that arrived after a higher sequence number (Type-P-Reordered)
+	ReorderedRatio    float64 // Reordered probes as a percentage of received
+	MaxExtent         int     // Largest reordering extent, in arrival positions
+	MeanExtent        float64 // Mean reordering extent of reordered probes
+	MaxNReordering    int     // Largest n for which a probe was n-reordered
+	Discontinuities   int     // In-order arrivals that skipped sequence numbers
+	DiscontinuitySize int     // Sequence numbers skipped by all discontinuities
+
+	// RFC 3357 loss patterns
+	LossPeriods      int     // Runs of consecutive lost probes
+	MaxLossPeriod    int     // Longest loss period, in probes
+	MeanLossPeriod   float64 // Mean loss period length, in probes
+	MeanLossDistance float64 // Mean sequence distance between successive losses
+	MeanLossGap      float64 // Mean number of probes received between loss periods
+}
+
+// Stats computes the metrics for everything recorded so far
+func (a *SequenceAnalyzer) Stats() SequenceStats {
+	ss := SequenceStats{
+		Sent:       len(a.sent),
+		Duplicates: a.dups,
+	}
+
+	// Replies to probes that were never recorded as sent still count as
+	// received for reordering, but not for loss
+	sent := make([]int, len(a.sent))
+	copy(sent, a.sent)
+	sort.Ints(sent)
+	for _, seq := range sent {
+		if a.seen[seq] {
+			ss.Received++
+		}
+	}
+	ss.Lost = ss.Sent - ss.Received
+	if ss.Sent > 0 {
+		ss.LossRate = float64(ss.Lost) / float64(ss.Sent) * 100
+	}
+
+	a.reordering(sent, &ss)
+	a.lossPatterns(sent, &ss)
+
+	return ss
+}
+
+// LossPattern returns one flag per sent probe in sequence order, true if
+// it never arrived, for FitGilbertElliott
+func (a *SequenceAnalyzer) LossPattern() []bool {
+	sent := make([]int, len(a.sent))
+	copy(sent, a.sent)
+	sort.Ints(sent)
+
+	lost := make([]bool, len(sent))
+	for i, seq := range sent {
+		lost[i] = !a.seen[seq]
+	}
+	return lost
+}
+
+// reordering computes the RFC 4737 metrics. The next expected sequence
+// number starts at the lowest one sent, or the first to arrive if none
+// were recorded as sent.
+func (a *SequenceAnalyzer) reordering(sent []int, ss *SequenceStats) {
+	if len(a.arrivals) == 0 {
+		return
+	}
+	nextExp := a.arrivals[0]
+	if len(sent) > 0 {
+		nextExp = sent[0]
+	}
+
+	// prefixMax[i] is the highest sequence number among the first i+1
+	// arrivals; it is non-decreasing, so the earliest arrival with a higher
+	// sequence number than a reordered probe can be found by binary search
+	prefixMax := make([]int, len(a.arrivals))
+	totalExtent := 0
+	for i, seq := range a.arrivals {
+		prefixMax[i] = seq
+		if i > 0 && prefixMax[i-1] > seq {
+			prefixMax[i] = prefixMax[i-1]
+		}
+
+		if seq >= nextExp {
+			// In order; a jump past the next expected number is a discontinuity
+			if seq > nextExp {
+				ss.Discontinuities++
+				ss.DiscontinuitySize += seq - nextExp
+			}
+			nextExp = seq + 1
+			continue
+		}
+
+		// Reordered: extent is the distance back to the first arrival
+		// that overtook it
+		ss.Reordered++
+		first := sort.Search(i, func(j int) bool { return prefixMax[j] > seq })
+		extent := i - first
+		totalExtent += extent
+		if extent > ss.MaxExtent {
+			ss.MaxExtent = extent
+		}
+
+		// n-reordering: the n arrivals immediately before all overtook it
+		n := 0
+		for k := i - 1; k >= 0 && a.arrivals[k] > seq; k-- {
+			n++
+		}
+		if n > ss.MaxNReordering {
+			ss.MaxNReordering = n
+		}
+	}
+
+	if ss.Reordered > 0 {
+		ss.MeanExtent = float64(totalExtent) / float64(ss.Reordered)
+	}
+	ss.ReorderedRatio = float64(ss.Reordered) / float64(len(a.arrivals)) * 100
+}
+
+// lossPatterns computes the RFC 3357 loss distance and loss period metrics
+// over the sent sequence numbers in order
+func (a *SequenceAnalyzer) lossPatterns(sent []int, ss *SequenceStats) {
+	var periods, gaps []int
+	lastLost := -1
+	distanceSum, distances := 0, 0
+	run, gap := 0, 0
+
+	for _, seq := range sent {
+		if a.seen[seq] {
+			if run > 0 {
+				periods = append(periods, run)
+				run = 0
+			}
+			gap++
+			continue
+		}
+
+		if lastLost >= 0 {
+			distanceSum += seq - lastLost
+			distances++
+		}
+		lastLost = seq
+
+		// A gap only counts between two loss periods
+		if run == 0 && len(periods) > 0 {
+			gaps = append(gaps, gap)
+		}
+		gap = 0
+		run++
+	}
+	if run > 0 {
+		periods = append(periods, run)
+	}
+
+	ss.LossPeriods = len(periods)
+	total := 0
+	for _, p := range periods {
+		total += p
+		if p > ss.MaxLossPeriod {
+			ss.MaxLossPeriod = p
+		}
+	}
+	if len(periods) > 0 {
+		ss.MeanLossPeriod = float64(total) / float64(len(periods))
+	}
+	if distances > 0 {
+		ss.MeanLossDistance = float64(distanceSum) / float64(distances)
+	}
+	if len(gaps) > 0 {
+		total = 0
+		for _, g := range gaps {
+			total += g
+		}
+		ss.MeanLossGap = float64(total) / float64(len(gaps))
+	}
+}
+
+// String returns a formatted string representation
+func (s SequenceStats) String() string {
+	return fmt.Sprintf(
+		"Sent: %d, Received: %d, Lost: %d (%.1f%%), Duplicates: %d, Reordered: %d (%.1f%%), Max extent: %d, Loss periods: %d",
+		s.Sent, s.Received, s.Lost, s.LossRate, s.Duplicates, s.Reordered, s.ReorderedRatio, s.MaxExtent, s.LossPeriods,
+	)
+}
@@ -0,0 +1,166 @@
+package stats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSequenceAnalyzer(t *testing.T) {
+	tests := []struct {
+		name     string
+		sent     int   // Probes 1..sent were sent
+		arrivals []int // Replies in arrival order
+		want     SequenceStats
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "in order",
+			sent:     5,
+			arrivals: []int{1, 2, 3, 4, 5},
+			want:     SequenceStats{Sent: 5, Received: 5},
+		},
+		{
+			name:     "duplicates",
+			sent:     3,
+			arrivals: []int{1, 2, 2, 3, 1},
+			want:     SequenceStats{Sent: 3, Received: 3, Duplicates: 2},
+		},
+		{
+			// 3 arrives after 4, 5 and 6: overtaken by the three arrivals
+			// before it, and the skip from 2 to 4 is a discontinuity
+			name:     "late arrival",
+			sent:     6,
+			arrivals: []int{1, 2, 4, 5, 6, 3},
+			want: SequenceStats{
+				Sent: 6, Received: 6,
+				Reordered: 1, ReorderedRatio: 100.0 / 6,
+				MaxExtent: 3, MeanExtent: 3, MaxNReordering: 3,
+				Discontinuities: 1, DiscontinuitySize: 1,
+			},
+		},
+		{
+			// 2 is 1-reordered with extent 1; 3 is only 1-reordered, since
+			// 2 arrived just before it, but 4 overtook it three arrivals
+			// earlier
+			name:     "extent beyond n-reordering",
+			sent:     5,
+			arrivals: []int{1, 4, 2, 5, 3},
+			want: SequenceStats{
+				Sent: 5, Received: 5,
+				Reordered: 2, ReorderedRatio: 40,
+				MaxExtent: 3, MeanExtent: 2, MaxNReordering: 1,
+				Discontinuities: 1, DiscontinuitySize: 2,
+			},
+		},
+		{
+			// 4 and 7 are lost; 3 arrives after 5, which skipped two
+			name:     "gap then reorder",
+			sent:     8,
+			arrivals: []int{1, 2, 5, 3, 6, 8},
+			want: SequenceStats{
+				Sent: 8, Received: 6, Lost: 2, LossRate: 25,
+				Reordered: 1, ReorderedRatio: 100.0 / 6,
+				MaxExtent: 1, MeanExtent: 1, MaxNReordering: 1,
+				Discontinuities: 2, DiscontinuitySize: 3,
+				LossPeriods: 2, MaxLossPeriod: 1, MeanLossPeriod: 1,
+				MeanLossDistance: 3, MeanLossGap: 2,
+			},
+		},
+		{
+			// Lost: 3-5, 8 and 11-12. Distances 1, 1, 3, 3, 1; two
+			// probes received between each loss period. The trailing
+			// losses are not a discontinuity, since nothing followed them.
+			name:     "loss periods",
+			sent:     12,
+			arrivals: []int{1, 2, 6, 7, 9, 10},
+			want: SequenceStats{
+				Sent: 12, Received: 6, Lost: 6, LossRate: 50,
+				Discontinuities: 2, DiscontinuitySize: 4,
+				LossPeriods: 3, MaxLossPeriod: 3, MeanLossPeriod: 2,
+				MeanLossDistance: 1.8, MeanLossGap: 2,
+			},
+		},
+		{
+			name: "all lost",
+			sent: 4,
+			want: SequenceStats{
+				Sent: 4, Lost: 4, LossRate: 100,
+				LossPeriods: 1, MaxLossPeriod: 4, MeanLossPeriod: 4, MeanLossDistance: 1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewSequenceAnalyzer()
+			for seq := 1; seq <= tt.sent; seq++ {
+				a.AddSent(seq)
+			}
+			for _, seq := range tt.arrivals {
+				a.AddArrival(seq)
+			}
+
+			got := a.Stats()
+			// Compare the ratios and means separately, within rounding
+			floats := []struct {
+				name      string
+				got, want float64
+			}{
+				{"LossRate", got.LossRate, tt.want.LossRate},
+				{"ReorderedRatio", got.ReorderedRatio, tt.want.ReorderedRatio},
+				{"MeanExtent", got.MeanExtent, tt.want.MeanExtent},
+				{"MeanLossPeriod", got.MeanLossPeriod, tt.want.MeanLossPeriod},
+				{"MeanLossDistance", got.MeanLossDistance, tt.want.MeanLossDistance},
+				{"MeanLossGap", got.MeanLossGap, tt.want.MeanLossGap},
+			}
+			for _, f := range floats {
+				if math.Abs(f.got-f.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", f.name, f.got, f.want)
+				}
+			}
+			got.LossRate, got.ReorderedRatio, got.MeanExtent = 0, 0, 0
+			got.MeanLossPeriod, got.MeanLossDistance, got.MeanLossGap = 0, 0, 0
+			want := tt.want
+			want.LossRate, want.ReorderedRatio, want.MeanExtent = 0, 0, 0
+			want.MeanLossPeriod, want.MeanLossDistance, want.MeanLossGap = 0, 0, 0
+			if got != want {
+				t.Errorf("Stats() = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestSequenceAnalyzerUnsent(t *testing.T) {
+	// A reply to a probe never recorded as sent counts for reordering but
+	// not for loss
+	a := NewSequenceAnalyzer()
+	a.AddSent(1)
+	a.AddSent(2)
+	a.AddArrival(2)
+	a.AddArrival(9)
+	a.AddArrival(1)
+
+	ss := a.Stats()
+	if ss.Sent != 2 || ss.Received != 2 || ss.Lost != 0 {
+		t.Errorf("sent %d received %d lost %d, want 2, 2 and 0", ss.Sent, ss.Received, ss.Lost)
+	}
+	if ss.Reordered != 1 || ss.MaxExtent != 2 || ss.MaxNReordering != 2 {
+		t.Errorf("reordered %d extent %d n %d, want 1, 2 and 2", ss.Reordered, ss.MaxExtent, ss.MaxNReordering)
+	}
+}
+
+func TestSequenceAnalyzerLossPattern(t *testing.T) {
+	a := NewSequenceAnalyzer()
+	for _, seq := range []int{3, 1, 4, 2, 5} {
+		a.AddSent(seq)
+	}
+	a.AddArrival(4)
+	a.AddArrival(1)
+
+	if got, want := a.LossPattern(), []bool{false, true, true, false, true}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("LossPattern() = %v, want %v", got, want)
+	}
+}
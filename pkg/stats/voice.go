@@ -0,0 +1,154 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// CodecProfile holds the E-model impairment values of a voice codec
+type CodecProfile struct {
+	Name        string        // Codec name
+	Ie          float64       // Equipment impairment factor without loss
+	Bpl         float64       // Packet-loss robustness factor
+	Delay       time.Duration // Packetization and look-ahead delay for 20ms packets
+	Provisional bool          // Ie and Bpl are estimates rather than ITU-T values
+}
+
+// Built-in codec profiles. G.711 and G.729 use the ITU-T G.113 Appendix I
+// values (G.711 with packet loss concealment, G.729A with VAD). Opus is not
+// listed in G.113 and has no published Ie or Bpl, so its profile is marked
+// provisional: the values are our own conservative estimate for narrowband
+// use at around 24 kb/s with its own loss concealment, placed between G.711
+// and G.729A, and scores computed with them are only indicative.
+var (
+	CodecG711 = CodecProfile{Name: "G.711", Ie: 0, Bpl: 25.1, Delay: 20 * time.Millisecond}
+	CodecOpus = CodecProfile{Name: "Opus", Ie: 5, Bpl: 20, Delay: 26500 * time.Microsecond, Provisional: true}
+	CodecG729 = CodecProfile{Name: "G.729", Ie: 11, Bpl: 19, Delay: 25 * time.Millisecond}
+)
+
+// Codecs lists the built-in codec profiles
+var Codecs = []CodecProfile{CodecG711, CodecOpus, CodecG729}
+
+// defaultR is the G.107 R-factor with all parameters at their defaults,
+// Ro - Is - Idte with no delay, loss or advantage factor
+const defaultR = 93.2
+
+// VoiceQuality estimates call quality on a path with the ITU-T G.107
+// E-model, R = Ro - Is - Id - Ie,eff + A, using the default values for
+// everything a probe cannot measure. Talker echo is assumed cancelled, so
+// delay only enters through Idd, and the advantage factor A is zero.
+type VoiceQuality struct {
+	Codec CodecProfile // Codec impairment profile
+}
+
+// NewVoiceQuality creates a new voice quality calculator for a codec
+func NewVoiceQuality(codec CodecProfile) *VoiceQuality {
+	return &VoiceQuality{Codec: codec}
+}
+
+// VoiceScore holds an E-model estimate for one codec
+type VoiceScore struct {
+	Codec       string        // Codec name
+	OneWayDelay time.Duration // Mouth-to-ear delay Ta
+	Ppl         float64       // Packet loss, as a percentage
+	BurstR      float64       // Burst ratio, 1 for random loss
+	Id          float64       // Delay impairment
+	IeEff       float64       // Effective equipment impairment with loss
+	R           float64       // Transmission rating factor
+	MOS         float64       // Estimated mean opinion score, 1 to 4.5
+	Rating      string        // G.109 user satisfaction category
+	Provisional bool          // The codec profile is an estimate, see CodecProfile
+}
+
+// Score computes the R-factor and MOS from the mean round-trip time, the
+// RFC 3550 jitter, the loss rate as a percentage and the burst ratio.
+//
+// The mouth-to-ear delay is half the round trip plus a jitter buffer of
+// twice the jitter plus the codec delay.
+func (vq *VoiceQuality) Score(rtt, jitter time.Duration, lossRate, burstR float64) VoiceScore {
+	if burstR < 1 {
+		burstR = 1
+	}
+	ta := rtt/2 + 2*jitter + vq.Codec.Delay
+
+	vs := VoiceScore{
+		Codec:       vq.Codec.Name,
+		OneWayDelay: ta,
+		Ppl:         lossRate,
+		BurstR:      burstR,
+		Id:          delayImpairment(ta),
+		IeEff:       vq.Codec.Ie + (95-vq.Codec.Ie)*lossRate/(lossRate/burstR+vq.Codec.Bpl),
+		Provisional: vq.Codec.Provisional,
+	}
+	vs.R = defaultR - vs.Id - vs.IeEff
+	vs.MOS = mosFromR(vs.R)
+	vs.Rating = assessRFactor(vs.R)
+
+	return vs
+}
+
+// delayImpairment computes Idd of G.107 section 7.3.2 for an absolute
+// one-way delay Ta
+func delayImpairment(ta time.Duration) float64 {
+	ms := ta.Seconds() * 1000
+	if ms <= 100 {
+		return 0
+	}
+	x := math.Log2(ms / 100)
+	return 25 * (math.Pow(1+math.Pow(x, 6), 1.0/6) - 3*math.Pow(1+math.Pow(x/3, 6), 1.0/6) + 2)
+}
+
+// mosFromR converts an R-factor to MOS (G.107 Annex B)
+func mosFromR(r float64) float64 {
+	switch {
+	case r < 0:
+		return 1
+	case r > 100:
+		return 4.5
+	default:
+		return 1 + 0.035*r + r*(r-60)*(100-r)*7e-6
+	}
+}
+
+// assessRFactor maps an R-factor to the G.109 user satisfaction categories
+func assessRFactor(r float64) string {
+	switch {
+	case r >= 90:
+		return "Very satisfied"
+	case r >= 80:
+		return "Satisfied"
+	case r >= 70:
+		return "Some users dissatisfied"
+	case r >= 60:
+		return "Many users dissatisfied"
+	case r >= 50:
+		return "Nearly all users dissatisfied"
+	default:
+		return "Not recommended"
+	}
+}
+
+// BurstRatio estimates the G.107 BurstR from sequence statistics: the mean
+// observed loss period divided by the mean loss period expected if the same
+// share of probes were lost at random, 1/(1-loss). It is 1 when there are
+// no losses and at least 1 otherwise.
+func BurstRatio(ss SequenceStats) float64 {
+	burstR := ss.MeanLossPeriod * (1 - ss.LossRate/100)
+	if burstR < 1 {
+		return 1
+	}
+	return burstR
+}
+
+// String returns a formatted string representation
+func (vs VoiceScore) String() string {
+	codec := vs.Codec
+	if vs.Provisional {
+		codec += " (provisional)"
+	}
+	return fmt.Sprintf(
+		"Codec: %s, Delay: %.1fms, Loss: %.1f%%, BurstR: %.2f, R: %.1f, MOS: %.2f (%s)",
+		codec, vs.OneWayDelay.Seconds()*1000, vs.Ppl, vs.BurstR, vs.R, vs.MOS, vs.Rating,
+	)
+}
@@ -0,0 +1,122 @@
+package stats
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDelayImpairment(t *testing.T) {
+	tests := []struct {
+		ta   time.Duration
+		want float64
+	}{
+		{50 * time.Millisecond, 0},
+		{100 * time.Millisecond, 0},
+		{150 * time.Millisecond, 0.1635},
+		{200 * time.Millisecond, 3.0444},
+		{400 * time.Millisecond, 24.0701},
+	}
+
+	for _, tt := range tests {
+		if got := delayImpairment(tt.ta); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("delayImpairment(%v) = %.4f, want %.4f", tt.ta, got, tt.want)
+		}
+	}
+}
+
+func TestEffectiveEquipmentImpairment(t *testing.T) {
+	tests := []struct {
+		name   string
+		codec  CodecProfile
+		ppl    float64
+		burstR float64
+		want   float64
+	}{
+		{"G.711 no loss", CodecG711, 0, 1, 0},
+		{"G.711 2%", CodecG711, 2, 1, 190 / 27.1},
+		{"G.711 10% bursty", CodecG711, 10, 2, 950 / 30.1},
+		{"G.729A no loss", CodecG729, 0, 1, 11},
+		{"G.729A 2%", CodecG729, 2, 1, 19},
+		// BurstR below 1 is treated as random loss
+		{"G.729A 2% burst ratio below 1", CodecG729, 2, 0.5, 19},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vs := NewVoiceQuality(tt.codec).Score(0, 0, tt.ppl, tt.burstR)
+			if math.Abs(vs.IeEff-tt.want) > 1e-9 {
+				t.Errorf("IeEff = %.4f, want %.4f", vs.IeEff, tt.want)
+			}
+			if want := defaultR - tt.want; math.Abs(vs.R-want) > 1e-9 {
+				t.Errorf("R = %.4f, want %.4f", vs.R, want)
+			}
+		})
+	}
+}
+
+func TestMOSFromR(t *testing.T) {
+	tests := []struct {
+		r    float64
+		want float64
+	}{
+		{-10, 1},
+		{0, 1},
+		{50, 2.575},
+		{defaultR, 4.409286},
+		{100, 4.5},
+		{110, 4.5},
+	}
+
+	for _, tt := range tests {
+		if got := mosFromR(tt.r); math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("mosFromR(%v) = %.6f, want %.6f", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestVoiceQualityScore(t *testing.T) {
+	// 300ms RTT, 5ms jitter and the 20ms G.711 delay give Ta = 180ms
+	vs := NewVoiceQuality(CodecG711).Score(300*time.Millisecond, 5*time.Millisecond, 0, 1)
+	if vs.OneWayDelay != 180*time.Millisecond {
+		t.Errorf("OneWayDelay = %v, want 180ms", vs.OneWayDelay)
+	}
+	if want := defaultR - delayImpairment(180*time.Millisecond); vs.R != want {
+		t.Errorf("R = %.4f, want %.4f", vs.R, want)
+	}
+	if vs.Rating != "Very satisfied" {
+		t.Errorf("Rating = %q, want %q", vs.Rating, "Very satisfied")
+	}
+
+	if vs.Provisional {
+		t.Error("G.711 score marked provisional")
+	}
+	opus := NewVoiceQuality(CodecOpus).Score(0, 0, 0, 1)
+	if !opus.Provisional || !strings.Contains(opus.String(), "provisional") {
+		t.Errorf("Opus score %q not marked provisional", opus.String())
+	}
+}
+
+func TestBurstRatio(t *testing.T) {
+	tests := []struct {
+		name string
+		ss   SequenceStats
+		want float64
+	}{
+		{"no loss", SequenceStats{}, 1},
+		// With 20% random loss a loss period lasts 1/(1-0.2) probes on average
+		{"random loss", SequenceStats{LossRate: 20, MeanLossPeriod: 1.25}, 1},
+		// Isolated losses are more spread out than random ones
+		{"isolated losses", SequenceStats{LossRate: 20, MeanLossPeriod: 1}, 1},
+		{"bursty loss", SequenceStats{LossRate: 20, MeanLossPeriod: 4}, 3.2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BurstRatio(tt.ss); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("BurstRatio() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+)
+
+// Window aggregator defaults
+const (
+	DefaultWindowInterval   = 10 * time.Second // Length of each interval
+	DefaultRollingIntervals = 6                // Intervals in the rolling window
+)
+
+// WindowAggregator splits a run into fixed intervals by send time and keeps
+// latency, loss and jitter for each, so that a bad stretch of a long run
+// shows up as a point in a time series rather than disappearing into the
+// run as a whole. Each interval holds a DDSketch rather than raw samples,
+// and a rolling window over the last few intervals is computed by merging
+// them.
+//
+// Jitter is computed per interval as the mean |D| between consecutive
+// replies, the quantity RFC 3550 jitter smooths. The smoothed estimate takes
+// dozens of packets to settle and would carry earlier intervals into later
+// ones, so it is only used for the run as a whole.
+type WindowAggregator struct {
+	interval time.Duration // Length of each interval
+	rolling  int           // Intervals in the rolling window
+	start    time.Time     // Start of the first interval
+	windows  []*window     // Intervals since start, including empty ones
+}
+
+// window accumulates the probes sent during one interval
+type window struct {
+	sent    int
+	lost    int
+	latency *DDSketch
+	first   time.Duration // RTT of the first reply
+	last    time.Duration // RTT of the latest reply
+	changes time.Duration // Sum of |D| between consecutive replies
+	pairs   int           // Consecutive replies summed in changes
+}
+
+// NewWindowAggregator creates an aggregator with the given interval length
+// and number of intervals in the rolling window. Zero arguments select
+// DefaultWindowInterval and DefaultRollingIntervals.
+func NewWindowAggregator(interval time.Duration, rolling int) *WindowAggregator {
+	if interval <= 0 {
+		interval = DefaultWindowInterval
+	}
+	if rolling <= 0 {
+		rolling = DefaultRollingIntervals
+	}
+
+	return &WindowAggregator{
+		interval: interval,
+		rolling:  rolling,
+	}
+}
+
+// Interval returns the length of each interval
+func (w *WindowAggregator) Interval() time.Duration {
+	return w.interval
+}
+
+// Rolling returns the number of intervals in the rolling window
+func (w *WindowAggregator) Rolling() int {
+	return w.rolling
+}
+
+// Add records a probe sent at t, with its RTT if it succeeded. Probes are
+// expected in send order; the first one starts the first interval, and
+// anything sent before it is counted in that interval. Probes that failed
+// before being sent, with a zero t, belong to no interval and are ignored.
+func (w *WindowAggregator) Add(t time.Time, rtt time.Duration, success bool) {
+	if t.IsZero() {
+		return
+	}
+	if w.start.IsZero() {
+		w.start = t
+	}
+
+	i := 0
+	if t.After(w.start) {
+		i = int(t.Sub(w.start) / w.interval)
+	}
+	for len(w.windows) <= i {
+		w.windows = append(w.windows, &window{latency: NewDDSketch(0, 0)})
+	}
+
+	win := w.windows[i]
+	win.sent++
+	if !success {
+		win.lost++
+		return
+	}
+	if win.latency.Count() > 0 {
+		win.changes += absDuration(rtt - win.last)
+		win.pairs++
+	} else {
+		win.first = rtt
+	}
+	win.latency.AddSample(rtt)
+	win.last = rtt
+}
+
+// jitter returns the mean |D| between consecutive replies, or 0 with fewer
+// than two replies
+func (win *window) jitter() time.Duration {
+	if win.pairs == 0 {
+		return 0
+	}
+	return win.changes / time.Duration(win.pairs)
+}
+
+// absDuration returns the absolute value of d
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// WindowStats holds the statistics of one interval and of the rolling
+// window that ends with it
+type WindowStats struct {
+	Start    time.Time      // Start of the interval
+	Sent     int            // Probes sent during the interval
+	Lost     int            // Probes that failed
+	LossRate float64        // Lost probes as a percentage of sent
+	Latency  HistogramStats // RTTs of successful probes
+	Jitter   time.Duration  // Mean RTT change between consecutive replies, 0 with fewer than two
+
+	RollingSent     int            // Probes sent during the rolling window
+	RollingLossRate float64        // Loss over the rolling window, as a percentage
+	RollingLatency  HistogramStats // RTTs over the rolling window
+	RollingJitter   time.Duration  // Mean RTT change between consecutive replies over the rolling window
+}
+
+// Series returns one entry per interval from the first probe to the last,
+// including intervals in which nothing was sent
+func (w *WindowAggregator) Series() []WindowStats {
+	series := make([]WindowStats, len(w.windows))
+
+	for i, win := range w.windows {
+		ws := WindowStats{
+			Start:    w.start.Add(time.Duration(i) * w.interval),
+			Sent:     win.sent,
+			Lost:     win.lost,
+			LossRate: lossRate(win.lost, win.sent),
+			Latency:  win.latency.GetStats(),
+			Jitter:   win.jitter(),
+		}
+
+		// Replies either side of an interval boundary form a pair too
+		rolling := NewDDSketch(0, 0)
+		lost, pairs := 0, 0
+		var changes time.Duration
+		var prev *window
+		for j := max(0, i-w.rolling+1); j <= i; j++ {
+			wj := w.windows[j]
+			_ = rolling.Merge(wj.latency)
+			ws.RollingSent += wj.sent
+			lost += wj.lost
+			changes += wj.changes
+			pairs += wj.pairs
+			if wj.latency.Count() == 0 {
+				continue
+			}
+			if prev != nil {
+				changes += absDuration(wj.first - prev.last)
+				pairs++
+			}
+			prev = wj
+		}
+		ws.RollingLossRate = lossRate(lost, ws.RollingSent)
+		ws.RollingLatency = rolling.GetStats()
+		if pairs > 0 {
+			ws.RollingJitter = changes / time.Duration(pairs)
+		}
+
+		series[i] = ws
+	}
+
+	return series
+}
+
+// lossRate returns lost as a percentage of sent
+func lossRate(lost, sent int) float64 {
+	if sent == 0 {
+		return 0
+	}
+	return float64(lost) / float64(sent) * 100
+}
+
+// String returns a formatted string representation
+func (ws WindowStats) String() string {
+	return fmt.Sprintf(
+		"Start: %s, Sent: %d, Loss: %.1f%%, P50: %.3fms, P99: %.3fms, Jitter: %.3fms, Rolling P99: %.3fms, Rolling loss: %.1f%%, Rolling jitter: %.3fms",
+		ws.Start.Format(time.RFC3339), ws.Sent, ws.LossRate,
+		ws.Latency.P50.Seconds()*1000, ws.Latency.P99.Seconds()*1000, ws.Jitter.Seconds()*1000,
+		ws.RollingLatency.P99.Seconds()*1000, ws.RollingLossRate, ws.RollingJitter.Seconds()*1000,
+	)
+}
@@ -0,0 +1,83 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowAggregator(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	ms := time.Millisecond
+	w := NewWindowAggregator(10*time.Second, 2)
+
+	// Probes every 2s over 40s; the interval from 20s to 30s gets no
+	// replies and the one from 30s a single reply
+	probes := []struct {
+		offset  time.Duration
+		rtt     time.Duration
+		success bool
+	}{
+		{0, 10 * ms, true}, {2 * time.Second, 14 * ms, true}, {4 * time.Second, 0, false},
+		{6 * time.Second, 12 * ms, true}, {8 * time.Second, 12 * ms, true},
+		{10 * time.Second, 20 * ms, true}, {12 * time.Second, 20 * ms, true}, {14 * time.Second, 20 * ms, true},
+		{20 * time.Second, 0, false}, {22 * time.Second, 0, false},
+		{32 * time.Second, 30 * ms, true},
+	}
+	// A probe that failed before being sent has no interval
+	w.Add(time.Time{}, 0, false)
+	for _, p := range probes {
+		w.Add(start.Add(p.offset), p.rtt, p.success)
+	}
+
+	series := w.Series()
+	want := []struct {
+		sent, lost    int
+		jitter        time.Duration
+		p50           time.Duration
+		rollingSent   int
+		rollingJitter time.Duration
+	}{
+		{5, 1, 2 * ms, 12 * ms, 5, 2 * ms}, // |D|: 4, 2, 0
+		{3, 0, 0, 20 * ms, 8, 14 * ms / 6}, // Steady, but 8ms up from the last reply before
+		{2, 2, 0, 0, 5, 0},                 // No replies
+		{1, 0, 0, 30 * ms, 3, 0},           // One reply, no pair
+	}
+	if len(series) != len(want) {
+		t.Fatalf("got %d intervals, want %d", len(series), len(want))
+	}
+
+	for i, ws := range series {
+		if !ws.Start.Equal(start.Add(time.Duration(i) * 10 * time.Second)) {
+			t.Errorf("interval %d starts at %v", i, ws.Start)
+		}
+		if ws.Sent != want[i].sent || ws.Lost != want[i].lost || ws.RollingSent != want[i].rollingSent {
+			t.Errorf("interval %d: sent %d lost %d rolling sent %d, want %d, %d and %d",
+				i, ws.Sent, ws.Lost, ws.RollingSent, want[i].sent, want[i].lost, want[i].rollingSent)
+		}
+		if ws.Jitter != want[i].jitter || ws.RollingJitter != want[i].rollingJitter {
+			t.Errorf("interval %d: jitter %v rolling %v, want %v and %v",
+				i, ws.Jitter, ws.RollingJitter, want[i].jitter, want[i].rollingJitter)
+		}
+		if d := ws.Latency.P50 - want[i].p50; d < -want[i].p50/100 || d > want[i].p50/100 {
+			t.Errorf("interval %d: p50 %v, want %v", i, ws.Latency.P50, want[i].p50)
+		}
+	}
+
+	if got := series[2].RollingLossRate; got != 40 {
+		t.Errorf("rolling loss over intervals 1 and 2 = %v%%, want 40%%", got)
+	}
+	if got := series[0].LossRate; got != 20 {
+		t.Errorf("loss in interval 0 = %v%%, want 20%%", got)
+	}
+}
+
+func TestWindowAggregatorEmpty(t *testing.T) {
+	w := NewWindowAggregator(0, 0)
+	w.Add(time.Time{}, 0, false)
+	if series := w.Series(); len(series) != 0 {
+		t.Fatalf("got %d intervals from probes never sent", len(series))
+	}
+	if w.Interval() != DefaultWindowInterval || w.Rolling() != DefaultRollingIntervals {
+		t.Fatalf("interval %v rolling %d, want the defaults", w.Interval(), w.Rolling())
+	}
+}